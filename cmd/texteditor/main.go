@@ -6,7 +6,10 @@ import (
 
 	"example.com/texteditor/internal/app"
 	"example.com/texteditor/pkg/config"
+	"example.com/texteditor/pkg/editor"
+	"example.com/texteditor/pkg/history"
 	"example.com/texteditor/pkg/logs"
+	"example.com/texteditor/pkg/swap"
 )
 
 // main wires the CLI to the application runner which supports typing,
@@ -17,12 +20,53 @@ func main() {
 	// Initialize logger from env for CLI runs
 	r.Logger = logs.NewFromEnv()
 
+    storage := ""
+    backup, backupDir := "", ""
+    clip, clipCopy, clipPaste := "", "", ""
+    undoFile, undoDir, undoMax := true, "", config.DefaultUndoMaxSize
+    undoLimits := history.Limits{MaxOps: config.DefaultUndoMaxOps, MaxBytes: config.DefaultUndoMaxBytes}
     if cfg, err := config.LoadDefault(); err != nil {
         fmt.Fprintf(os.Stderr, "config error: %v\n", err)
     } else {
         r.Keymap = cfg.Keymap
         r.Theme = cfg.Theme
+        storage = cfg.Storage
+        backup, backupDir = cfg.Backup, cfg.BackupDir
+        r.AutoReload = cfg.AutoReload
+        undoFile, undoDir, undoMax = cfg.UndoFile, cfg.UndoDir, cfg.UndoMaxSize
+        r.UndoExclude = cfg.UndoExclude
+        undoLimits = history.Limits{MaxOps: cfg.UndoMaxOps, MaxBytes: cfg.UndoMaxBytes}
+        r.KillRing.SetMax(cfg.KillRingSize)
+        clip, clipCopy, clipPaste = cfg.Clipboard, cfg.ClipboardCopy, cfg.ClipboardPaste
+        r.ClipboardMirror = cfg.ClipboardMirror
     }
+	// TEXTEDITOR_STORAGE overrides the configured storage backend
+	if env := os.Getenv("TEXTEDITOR_STORAGE"); env != "" {
+		storage = env
+	}
+	if err := r.SetStorage(storage); err != nil {
+		fmt.Fprintf(os.Stderr, "storage error: %v\n", err)
+	}
+	if err := r.SetBackup(backup, backupDir); err != nil {
+		fmt.Fprintf(os.Stderr, "backup error: %v\n", err)
+	}
+	if err := r.SetClipboard(clip, clipCopy, clipPaste); err != nil {
+		fmt.Fprintf(os.Stderr, "clipboard error: %v\n", err)
+	}
+
+	r.SwapDir = swap.DefaultDir()
+	if undoFile {
+		if undoDir == "" {
+			undoDir = history.DefaultDir()
+		}
+		r.UndoDir, r.UndoMaxSize = undoDir, undoMax
+	}
+	r.SetUndoLimits(undoLimits)
+	r.RegistersPath = history.DefaultRegistersPath()
+	r.MarksPath = editor.DefaultMarksPath()
+	r.KillRingPath = history.DefaultKillRingPath()
+	r.PromptHistoryPath = history.DefaultPromptHistoryPath()
+	r.LoadState()
 
 	// Load optional file path argument
 	if len(os.Args) > 1 {
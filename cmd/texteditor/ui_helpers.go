@@ -40,6 +40,7 @@ func drawHelp(s tcell.Screen) {
 		"- dd: Delete line (normal mode)",
 		"- Ctrl+U/Ctrl+Y: Paste",
 		"- Ctrl+Z / Ctrl+Y: Undo / Redo (u / Ctrl+R in normal mode)",
+		"- g- / g+, :earlier 5m, :later 2m: Undo tree time travel",
 		"- Ctrl+A/Ctrl+E: Line start/end (insert)",
 		"- Enter: New line; Backspace/Delete: Remove",
 		"- Typing: Inserts characters",
@@ -5,6 +5,7 @@ go 1.22
 require (
 	github.com/gdamore/tcell/v2 v2.8.1
 	github.com/smacker/go-tree-sitter v0.0.0-20240827094217-dd81d9e9be82
+	golang.org/x/text v0.21.0
 )
 
 require (
@@ -14,5 +15,4 @@ require (
 	github.com/rivo/uniseg v0.4.3 // indirect
 	golang.org/x/sys v0.29.0 // indirect
 	golang.org/x/term v0.28.0 // indirect
-	golang.org/x/text v0.21.0 // indirect
 )
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"example.com/texteditor/pkg/buffer"
+	"example.com/texteditor/pkg/editor"
+	"example.com/texteditor/pkg/search"
+)
+
+// bufferUI is the per-buffer runner state kept in editor.BufferState.UI while
+// another buffer has focus.
+type bufferUI struct {
+	mode         Mode
+	visualAnchor *buffer.Marker
+	visualLine   bool
+	multiEdit    *multiEditState
+	editSeq      int64
+	syntaxAsync  *SyntaxState
+	syntaxSrc    string
+	syntaxCache  []search.Range
+	spell        spellView
+	// yank-pop only continues within the buffer that was yanked into
+	lastYank      buffer.Span
+	lastYankCount int
+	lastYankValid bool
+	marks         map[rune]*buffer.Marker
+}
+
+// bumpEditSeq marks the current buffer as changed. Sequence numbers are
+// unique across buffers, so results computed for one buffer never look
+// current for another.
+func (r *Runner) bumpEditSeq() {
+	r.seqClock++
+	r.editSeq = r.seqClock
+}
+
+// bufferState captures the focused buffer, including its history and view.
+func (r *Runner) bufferState() editor.BufferState {
+	ui := &bufferUI{
+		mode:          r.Mode,
+		visualAnchor:  r.visualAnchor,
+		visualLine:    r.VisualLine,
+		multiEdit:     r.MultiEdit,
+		editSeq:       r.editSeq,
+		syntaxAsync:   r.SyntaxAsync,
+		syntaxSrc:     r.syntaxSrc,
+		syntaxCache:   r.syntaxCache,
+		lastYank:      r.lastYank,
+		lastYankCount: r.lastYankCount,
+		lastYankValid: r.lastYankValid,
+		marks:         r.marks,
+	}
+	if r.Spell != nil {
+		ui.spell = r.Spell.spellView
+	}
+	return editor.BufferState{
+		FilePath:   r.FilePath,
+		Buf:        r.Buf,
+		Cursor:     r.Cursor,
+		Dirty:      r.Dirty,
+		Format:     r.Format,
+		Encoding:   r.Encoding,
+		Disk:       r.Disk,
+		History:    r.History,
+		CursorLine: r.CursorLine,
+		TopLine:    r.TopLine,
+		UI:         ui,
+	}
+}
+
+// applyBufferState focuses bs. A buffer that never had focus starts in
+// normal mode with an empty history.
+func (r *Runner) applyBufferState(bs editor.BufferState) {
+	r.closeKeyGroup()
+	r.FilePath = bs.FilePath
+	r.Buf = bs.Buf
+	r.Cursor = bs.Cursor
+	r.Dirty = bs.Dirty
+	r.Format = bs.Format
+	r.Encoding = bs.Encoding
+	r.Disk = bs.Disk
+	r.History = bs.History
+	if r.History == nil {
+		r.History = r.newHistory()
+	}
+	r.CursorLine = bs.CursorLine
+	r.TopLine = bs.TopLine
+	ui, _ := bs.UI.(*bufferUI)
+	if ui == nil {
+		ui = &bufferUI{mode: ModeNormal}
+		r.bumpEditSeq()
+		ui.editSeq = r.editSeq
+	}
+	r.Mode = ui.mode
+	r.visualAnchor = ui.visualAnchor
+	r.VisualLine = ui.visualLine
+	r.MultiEdit = ui.multiEdit
+	r.editSeq = ui.editSeq
+	r.SyntaxAsync = ui.syntaxAsync
+	r.syntaxSrc = ui.syntaxSrc
+	r.syntaxCache = ui.syntaxCache
+	if r.Spell != nil {
+		r.Spell.spellView = ui.spell
+	}
+	r.lastYank = ui.lastYank
+	r.lastYankCount = ui.lastYankCount
+	r.lastYankValid = ui.lastYankValid
+	r.marks = ui.marks
+	r.PendingG = false
+	r.PendingD = false
+	r.PendingY = false
+	r.PendingC = false
+	r.PendingTextObject = false
+	r.TextObjectAround = false
+	r.PendingCount = 0
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+
+	"example.com/texteditor/pkg/clipboard"
+)
+
+// osc52 copies through the terminal with OSC 52 escape sequences, which
+// also works over SSH. Reading asks the terminal; its answer arrives as a
+// tcell.EventClipboard, and many terminals never answer.
+type osc52 struct{ r *Runner }
+
+func (o osc52) Write(_ clipboard.Selection, text string) error {
+	if o.r.Screen == nil {
+		return clipboard.ErrUnsupported
+	}
+	o.r.Screen.SetClipboard([]byte(text))
+	return nil
+}
+
+func (o osc52) Read(clipboard.Selection) (string, error) {
+	if o.r.Screen == nil {
+		return "", clipboard.ErrUnsupported
+	}
+	o.r.Screen.GetClipboard()
+	return "", clipboard.ErrPending
+}
+
+// pendingPaste is a p or P waiting for the terminal to send the clipboard.
+type pendingPaste struct {
+	before bool
+	count  int
+}
+
+// SetClipboard selects how registers '+' and '*' reach the system
+// clipboard. mode is "auto" (or ""), "osc52", "command" or "none". copyCmd
+// and pasteCmd override the commands "auto" and "command" otherwise detect.
+func (r *Runner) SetClipboard(mode, copyCmd, pasteCmd string) error {
+	custom := copyCmd != "" || pasteCmd != ""
+	cmd := clipboard.Command{Copy: clipboard.ParseCommand(copyCmd), Paste: clipboard.ParseCommand(pasteCmd)}
+	if !custom {
+		var ok bool
+		cmd, ok = clipboard.Detect()
+		custom = ok
+	}
+	switch mode {
+	case "", "auto":
+		r.Clipboard = osc52{r}
+		if custom {
+			r.Clipboard = cmd
+		}
+	case "osc52":
+		r.Clipboard = osc52{r}
+	case "command":
+		if !custom {
+			r.Clipboard = nil
+			return errors.New("no clipboard command found; set clipboard_copy and clipboard_paste")
+		}
+		r.Clipboard = cmd
+	case "none", "off":
+		r.Clipboard = nil
+	default:
+		return fmt.Errorf("unknown clipboard mode %q", mode)
+	}
+	return nil
+}
+
+func isClipboardRegister(name rune) bool { return name == '+' || name == '*' }
+
+func selectionFor(name rune) clipboard.Selection {
+	if name == '*' {
+		return clipboard.Primary
+	}
+	return clipboard.Clipboard
+}
+
+// copyToClipboard writes text to the selection of register name. Failures
+// are logged rather than shown so a missing clipboard does not get in the
+// way of mirrored kills.
+func (r *Runner) copyToClipboard(name rune, text string) {
+	if r.Clipboard == nil {
+		return
+	}
+	if err := r.Clipboard.Write(selectionFor(name), text); err != nil {
+		r.logStateError("clipboard.write.error", err)
+	}
+}
+
+// mirrorKill copies text to the clipboard when every kill is mirrored.
+func (r *Runner) mirrorKill(text string) {
+	if r.ClipboardMirror {
+		r.copyToClipboard('+', text)
+	}
+}
+
+// clipboardPaste pastes from register '+' or '*'. When the terminal has to
+// answer first, the paste waits for onClipboard.
+func (r *Runner) clipboardPaste(name rune, before bool, count int) {
+	if r.Clipboard == nil {
+		r.showDialog("Clipboard is disabled")
+		return
+	}
+	text, err := r.Clipboard.Read(selectionFor(name))
+	switch {
+	case errors.Is(err, clipboard.ErrPending):
+		r.pendingPaste = &pendingPaste{before: before, count: count}
+	case err != nil:
+		r.showDialog("Clipboard: " + err.Error())
+	case text != "":
+		r.insertPaste(text, before, count)
+	}
+}
+
+// onClipboard receives the clipboard the terminal sent for a pending paste.
+// The paste undoes as one step, like the key that asked for it.
+func (r *Runner) onClipboard(data []byte) {
+	p := r.pendingPaste
+	r.pendingPaste = nil
+	if p == nil || len(data) == 0 {
+		return
+	}
+	r.beginKeyGroup()
+	r.insertPaste(string(data), p.before, p.count)
+	r.endKeyGroup()
+}
+
+// toggleClipboardMirror switches copying every kill and yank to the
+// clipboard on or off.
+func (r *Runner) toggleClipboardMirror() {
+	r.ClipboardMirror = !r.ClipboardMirror
+	state := "off"
+	if r.ClipboardMirror {
+		state = "on"
+		if r.KillRing.HasData() {
+			r.copyToClipboard('+', r.KillRing.Get())
+		}
+	}
+	r.showDialog("Mirror kills to clipboard: " + state)
+}
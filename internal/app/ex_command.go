@@ -0,0 +1,97 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// exCommand is a command entered at the ':' prompt in normal mode.
+type exCommand struct {
+	name  string
+	alias string // shortest accepted abbreviation
+	run   func(arg string) error
+}
+
+func (r *Runner) exCommands() []exCommand {
+	return []exCommand{
+		{name: "earlier", alias: "ea", run: func(arg string) error { return r.undoTimeTravel(arg, -1) }},
+		{name: "later", alias: "lat", run: func(arg string) error { return r.undoTimeTravel(arg, 1) }},
+		{name: "undotree", alias: "undot", run: func(string) error { r.runUndoTree(); return nil }},
+		{name: "undomem", alias: "undom", run: func(string) error { r.showUndoMem(); return nil }},
+		{name: "nohlsearch", alias: "noh", run: func(string) error { r.noHighlightSearch(); return nil }},
+		{name: "grep", alias: "gr", run: r.exGrep},
+		{name: "cnext", alias: "cn", run: func(string) error { r.grepStep(1); return nil }},
+		{name: "cprevious", alias: "cp", run: func(string) error { r.grepStep(-1); return nil }},
+	}
+}
+
+// runExCommand runs one command line such as "earlier 5m". Commands may be
+// abbreviated down to their alias.
+func (r *Runner) runExCommand(line string) error {
+	line = strings.TrimSpace(line)
+	name, arg, _ := strings.Cut(line, " ")
+	if name == "" {
+		return nil
+	}
+	for _, c := range r.exCommands() {
+		if strings.HasPrefix(c.name, name) && strings.HasPrefix(name, c.alias) {
+			if r.Logger != nil {
+				r.Logger.Event("action", map[string]any{"name": "ex." + c.name, "arg": arg})
+			}
+			return c.run(arg)
+		}
+	}
+	return fmt.Errorf("not an editor command: %s", name)
+}
+
+// runExPrompt reads a command line in the mini-buffer and runs it.
+func (r *Runner) runExPrompt() {
+	if r.Screen == nil {
+		return
+	}
+	input := ""
+	recall := r.Prompts.Recall(historyEx)
+	for {
+		r.setMiniBuffer([]string{":" + input})
+		r.draw(nil)
+
+		ev := r.waitEvent()
+		if ev == nil {
+			r.clearMiniBuffer()
+			return
+		}
+		kev, ok := ev.(*tcell.EventKey)
+		if !ok {
+			continue
+		}
+		switch {
+		case r.isCancelKey(kev):
+			r.clearMiniBuffer()
+			r.draw(nil)
+			return
+		case recallKey(recall, kev, &input, true):
+		case kev.Key() == tcell.KeyEnter:
+			r.clearMiniBuffer()
+			r.Prompts.Add(historyEx, input)
+			if err := r.runExCommand(input); err != nil {
+				r.showDialog(err.Error())
+			}
+			r.draw(nil)
+			return
+		case kev.Key() == tcell.KeyBackspace || kev.Key() == tcell.KeyBackspace2:
+			if input == "" {
+				r.clearMiniBuffer()
+				r.draw(nil)
+				return
+			}
+			runes := []rune(input)
+			input = string(runes[:len(runes)-1])
+			recall.Reset()
+		case kev.Key() == tcell.KeyRune && kev.Modifiers()&^tcell.ModShift == 0:
+			input += string(kev.Rune())
+			recall.Reset()
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"example.com/texteditor/pkg/editor"
+	"github.com/gdamore/tcell/v2"
+)
+
+// fileInfo returns the status line summary of the current file's format, or
+// an empty string for buffers without a file.
+func (r *Runner) fileInfo() string {
+	if r.FilePath == "" || r.View == ViewFileManager {
+		return ""
+	}
+	return r.Encoding.String() + " " + r.Format.Describe()
+}
+
+// statusInfo is what the status line shows after the file name: the file
+// info and the search match counter.
+func (r *Runner) statusInfo() string {
+	info, counter := r.fileInfo(), r.searchCounter()
+	if info == "" || counter == "" {
+		return info + counter
+	}
+	return info + " " + counter
+}
+
+// setLineEnding converts the buffer's on-disk line endings on the next save.
+// The line endings a mixed file was loaded with are normalized in the
+// buffer, as one undoable edit.
+func (r *Runner) setLineEnding(le editor.LineEnding) {
+	if r.Format.LineEnding != le || r.Format.Mixed {
+		if deletes := r.Format.LineEndingEdits(r.Buf.String()); len(deletes) > 0 {
+			r.beginEdit()
+			// from the end, so the positions before stay valid
+			for j := len(deletes) - 1; j >= 0; j-- {
+				r.replaceRange(deletes[j], deletes[j]+1, "")
+			}
+			r.endEdit()
+		}
+		r.Format.LineEnding = le
+		r.Format.Mixed = false
+		r.Dirty = true
+		r.saveBufferState()
+	}
+	if r.Logger != nil {
+		r.Logger.Event("action", map[string]any{"name": "format.line_ending", "value": le.String()})
+	}
+	r.draw(nil)
+}
+
+// toggleBOM adds or removes the byte order mark on the next save. Encodings
+// without a BOM ignore the setting.
+func (r *Runner) toggleBOM() {
+	r.Format.BOM = !r.Format.BOM
+	r.Dirty = true
+	r.saveBufferState()
+	if r.Logger != nil {
+		r.Logger.Event("action", map[string]any{"name": "format.bom", "value": r.Format.BOM})
+	}
+	r.draw(nil)
+}
+
+// toggleFinalNewline adds a trailing newline when the buffer lacks one and
+// removes it otherwise. The change is a regular, undoable edit.
+func (r *Runner) toggleFinalNewline() {
+	if r.Buf == nil {
+		return
+	}
+	n := r.Buf.Len()
+	if n > 0 && r.Buf.RuneAt(n-1) == '\n' {
+		_ = r.deleteRange(n-1, n, "\n")
+	} else {
+		cursor := r.Cursor
+		r.Cursor = n
+		r.insertText("\n")
+		r.Cursor = cursor
+		r.recomputeCursorLine()
+	}
+	r.Format.FinalNewline = r.Buf.Len() > 0 && r.Buf.RuneAt(r.Buf.Len()-1) == '\n'
+	r.saveBufferState()
+	if r.Logger != nil {
+		r.Logger.Event("action", map[string]any{"name": "format.final_newline", "value": r.Format.FinalNewline})
+	}
+	r.draw(nil)
+}
+
+// confirmLossySave asks whether to save although some characters cannot be
+// represented in the file's encoding. Without a screen it declines so the
+// caller reports the error instead.
+func (r *Runner) confirmLossySave(lossy *editor.UnencodableError) bool {
+	sample := lossy.Runes
+	if len(sample) > 10 {
+		sample = sample[:10]
+	}
+	return r.runChoicePrompt([]string{
+		fmt.Sprintf("Saving as %s will lose %d characters: %s", lossy.Encoding, len(lossy.Runes), string(sample)),
+		"Save anyway with substitutes? (y/n)",
+	}, "yn") == 'y'
+}
+
+// reopenWithEncoding re-reads FilePath from disk decoded as enc, replacing
+// the buffer contents and discarding undo history. Saving afterwards writes
+// the file in enc.
+func (r *Runner) reopenWithEncoding(enc editor.Encoding) error {
+	if r.FilePath == "" || r.View == ViewFileManager {
+		return os.ErrInvalid
+	}
+	data, err := os.ReadFile(r.FilePath)
+	if err != nil {
+		return err
+	}
+	text, format, err := editor.DecodeFileAs(data, enc)
+	if err != nil {
+		return err
+	}
+	r.replaceContents(text)
+	r.Format = format
+	r.Encoding = enc
+	r.Disk = editor.DiskInfoFor(r.FilePath, data)
+	r.Dirty = false
+	r.saveBufferState()
+	if r.Logger != nil {
+		r.Logger.Event("action", map[string]any{"name": "format.reopen_encoding", "value": enc.String()})
+	}
+	return nil
+}
+
+// runReopenEncodingPrompt asks for an encoding name and reloads the file in
+// it, confirming first when unsaved changes would be lost.
+func (r *Runner) runReopenEncodingPrompt() {
+	if r.Screen == nil || r.FilePath == "" || r.View == ViewFileManager {
+		return
+	}
+	names := make([]string, len(editor.Encodings))
+	for i, enc := range editor.Encodings {
+		names[i] = enc.String()
+	}
+	input := ""
+	errMsg := ""
+	for {
+		lines := []string{"Reopen with encoding: " + input}
+		if errMsg != "" {
+			lines = append(lines, errMsg)
+		} else {
+			lines = append(lines, strings.Join(names, ", "))
+		}
+		r.setMiniBuffer(lines)
+		r.draw(nil)
+
+		ev := r.waitEvent()
+		switch ev := ev.(type) {
+		case *tcell.EventKey:
+			if r.isCancelKey(ev) {
+				r.clearMiniBuffer()
+				r.draw(nil)
+				return
+			}
+			if ev.Key() == tcell.KeyEnter {
+				enc, err := editor.ParseEncoding(input)
+				if err != nil {
+					errMsg = err.Error()
+					continue
+				}
+				if r.Dirty && !r.runDiscardChangesPrompt() {
+					return
+				}
+				if err := r.reopenWithEncoding(enc); err != nil {
+					r.clearMiniBuffer()
+					r.showDialog("Reopen failed: " + err.Error())
+					return
+				}
+				r.clearMiniBuffer()
+				r.draw(nil)
+				return
+			}
+			if ev.Key() == tcell.KeyBackspace || ev.Key() == tcell.KeyBackspace2 {
+				if len(input) > 0 {
+					input = input[:len(input)-1]
+				}
+				continue
+			}
+			if ev.Key() == tcell.KeyRune && ev.Modifiers() == 0 {
+				input += string(ev.Rune())
+				errMsg = ""
+				continue
+			}
+		}
+	}
+}
+
+// runDiscardChangesPrompt confirms throwing away unsaved edits.
+func (r *Runner) runDiscardChangesPrompt() bool {
+	return r.runChoicePrompt([]string{"Unsaved changes. Discard them? (y/n)"}, "yn") == 'y'
+}
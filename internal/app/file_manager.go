@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"example.com/texteditor/pkg/buffer"
+	"example.com/texteditor/pkg/editor"
 	"example.com/texteditor/pkg/history"
 	"github.com/gdamore/tcell/v2"
 )
@@ -23,23 +24,9 @@ const (
 type fileManagerState struct {
 	Dir     string
 	Entries []fileEntry
-	Return  fileManagerReturnState
-}
-
-type fileManagerReturnState struct {
-	FilePath    string
-	Buf         *buffer.GapBuffer
-	Cursor      int
-	CursorLine  int
-	TopLine     int
-	Dirty       bool
-	Mode        Mode
-	VisualStart int
-	VisualLine  bool
-	MultiEdit   *multiEditState
-	History     *history.History
-	KillRing    history.KillRing
-	EditSeq     int64
+	// Return is the buffer to go back to on exit.
+	Return   editor.BufferState
+	KillRing history.KillRing
 }
 
 type fileEntry struct {
@@ -123,7 +110,7 @@ func (r *Runner) handleFileManagerKey(ev *tcell.EventKey) bool {
 	}
 	if r.Mode == ModeNormal && ev.Key() == tcell.KeyRune && ev.Rune() == 'v' && ev.Modifiers() == 0 {
 		r.Mode = ModeVisual
-		r.VisualStart = r.Cursor
+		r.setVisualStart(r.Cursor)
 		r.VisualLine = false
 		r.draw(nil)
 		return false
@@ -132,14 +119,14 @@ func (r *Runner) handleFileManagerKey(ev *tcell.EventKey) bool {
 		start, _ := r.currentLineBounds()
 		r.Cursor = start
 		r.Mode = ModeVisual
-		r.VisualStart = start
+		r.setVisualStart(start)
 		r.VisualLine = true
 		r.draw(nil)
 		return false
 	}
 	if r.Mode == ModeVisual && ev.Key() == tcell.KeyRune && ev.Rune() == 'v' && ev.Modifiers() == 0 {
 		r.Mode = ModeNormal
-		r.VisualStart = -1
+		r.setVisualStart(-1)
 		r.VisualLine = false
 		r.draw(nil)
 		return false
@@ -333,7 +320,7 @@ func (r *Runner) handleFileManagerVisualKey(ev *tcell.EventKey) bool {
 	switch {
 	case r.isCancelKey(ev) || (ev.Key() == tcell.KeyRune && ev.Rune() == 'v' && ev.Modifiers() == 0):
 		r.Mode = ModeNormal
-		r.VisualStart = -1
+		r.setVisualStart(-1)
 		r.VisualLine = false
 		r.PendingG = false
 		r.draw(nil)
@@ -435,33 +422,20 @@ func (r *Runner) enterFileManager(dir string) {
 	if r.FileManager == nil {
 		r.saveBufferState()
 	}
-	returnState := fileManagerReturnState{
-		FilePath:    r.FilePath,
-		Buf:         r.Buf,
-		Cursor:      r.Cursor,
-		CursorLine:  r.CursorLine,
-		TopLine:     r.TopLine,
-		Dirty:       r.Dirty,
-		Mode:        r.Mode,
-		VisualStart: r.VisualStart,
-		VisualLine:  r.VisualLine,
-		MultiEdit:   r.MultiEdit,
-		History:     r.History,
-		KillRing:    r.KillRing,
-		EditSeq:     r.editSeq,
-	}
+	returnState := r.bufferState()
 	fm := r.FileManager
 	if fm != nil {
 		fm.Return = returnState
 	}
-	r.FileManager = &fileManagerState{Dir: dir, Return: returnState}
-	r.History = history.New()
+	r.closeKeyGroup()
+	r.FileManager = &fileManagerState{Dir: dir, Return: returnState, KillRing: r.KillRing}
+	r.History = r.newHistory()
 	r.KillRing = history.KillRing{}
-	r.editSeq = 0
+	r.bumpEditSeq()
 	r.View = ViewFileManager
 	r.FilePath = "[File Manager] " + dir
 	r.Mode = ModeNormal
-	r.VisualStart = -1
+	r.setVisualStart(-1)
 	r.VisualLine = false
 	r.MultiEdit = nil
 	r.PendingG = false
@@ -484,22 +458,11 @@ func (r *Runner) exitFileManager() {
 	if r.FileManager == nil {
 		return
 	}
-	ret := r.FileManager.Return
+	fm := r.FileManager
 	r.FileManager = nil
 	r.View = ViewEditor
-	r.FilePath = ret.FilePath
-	r.Buf = ret.Buf
-	r.Cursor = ret.Cursor
-	r.CursorLine = ret.CursorLine
-	r.TopLine = ret.TopLine
-	r.Dirty = ret.Dirty
-	r.Mode = ret.Mode
-	r.VisualStart = ret.VisualStart
-	r.VisualLine = ret.VisualLine
-	r.MultiEdit = ret.MultiEdit
-	r.History = ret.History
-	r.KillRing = ret.KillRing
-	r.editSeq = ret.EditSeq
+	r.applyBufferState(fm.Return)
+	r.KillRing = fm.KillRing
 	r.clearMiniBuffer()
 	r.draw(nil)
 }
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"os"
+
+	"example.com/texteditor/pkg/buffer"
+	"example.com/texteditor/pkg/editor"
+)
+
+// readDiskText decodes the current file from disk in the buffer's encoding.
+func (r *Runner) readDiskText() (string, editor.FileFormat, []byte, error) {
+	data, err := os.ReadFile(r.FilePath)
+	if err != nil {
+		return "", editor.FileFormat{}, nil, err
+	}
+	text, format, err := editor.DecodeFileAs(data, r.Encoding)
+	return text, format, data, err
+}
+
+// checkDiskChange runs on every tick and compares the files of the open
+// buffers with the versions they were loaded from or last saved as. A change
+// to the focused file is dealt with right away; other buffers are marked
+// stale and dealt with once they have focus.
+func (r *Runner) checkDiskChange() {
+	stale := map[buffer.TextStorage]bool{}
+	for _, bs := range r.openBuffers() {
+		if bs.Buf == r.Buf && r.View != ViewFileManager || bs.FilePath == "" || !bs.Disk.Known() {
+			continue
+		}
+		if r.stale[bs.Buf] {
+			stale[bs.Buf] = true
+			continue
+		}
+		if changed, _, err := bs.Disk.CheckDisk(bs.FilePath); err == nil && changed {
+			stale[bs.Buf] = true
+			if r.Logger != nil {
+				r.Logger.Event("disk.stale", map[string]any{"file": bs.FilePath})
+			}
+		}
+	}
+	r.stale = stale
+	r.checkFocusedDiskChange()
+}
+
+// checkStaleFocus checks the focused file if it changed on disk while its
+// buffer was in the background. The event loop calls it after every event.
+func (r *Runner) checkStaleFocus() {
+	if r.View == ViewFileManager || !r.stale[r.Buf] {
+		return
+	}
+	delete(r.stale, r.Buf)
+	r.checkFocusedDiskChange()
+}
+
+// checkFocusedDiskChange compares the focused file with the version it was
+// loaded from or last saved as. Clean buffers are reloaded when AutoReload is
+// set; otherwise the user chooses what to do.
+func (r *Runner) checkFocusedDiskChange() {
+	if r.FilePath == "" || r.View == ViewFileManager || !r.Disk.Known() {
+		return
+	}
+	changed, now, err := r.Disk.CheckDisk(r.FilePath)
+	if err != nil {
+		if r.Logger != nil {
+			r.Logger.Event("disk.check.error", map[string]any{"file": r.FilePath, "error": err.Error()})
+		}
+		return
+	}
+	if !changed {
+		if now != r.Disk {
+			// touched without changing contents
+			r.Disk = now
+			r.saveBufferState()
+		}
+		return
+	}
+	if r.Logger != nil {
+		r.Logger.Event("disk.changed", map[string]any{"file": r.FilePath, "exists": now.Exists})
+	}
+	if !now.Exists {
+		r.Disk = editor.DiskInfo{}
+		r.saveBufferState()
+		r.showDialog(r.FilePath + " was deleted on disk; saving will recreate it")
+		return
+	}
+	if !r.Dirty && r.AutoReload {
+		if err := r.reloadFromDisk(); err != nil {
+			r.showDialog("Reload failed: " + err.Error())
+		}
+		return
+	}
+	r.runDiskChangePrompt(now)
+}
+
+// runDiskChangePrompt asks whether to reload a file changed by another
+// program, keep the buffer, or look at the differences first.
+func (r *Runner) runDiskChangePrompt(now editor.DiskInfo) {
+	head := r.FilePath + " changed on disk."
+	if r.Dirty {
+		head += " Reloading discards your unsaved changes."
+	}
+	for {
+		switch r.runChoicePrompt([]string{head, "r reload, k keep buffer, d show diff"}, "rkd") {
+		case 'r':
+			if err := r.reloadFromDisk(); err != nil {
+				r.showDialog("Reload failed: " + err.Error())
+			}
+			r.draw(nil)
+			return
+		case 'd':
+			r.showDiskDiff()
+		default:
+			// keep ours: remember this version so we only ask again for the
+			// next change; saving will overwrite it
+			r.Disk = now
+			r.saveBufferState()
+			r.draw(nil)
+			return
+		}
+	}
+}
+
+// showDiskDiff shows how the file on disk differs from the buffer.
+func (r *Runner) showDiskDiff() {
+	text, _, _, err := r.readDiskText()
+	if err != nil {
+		r.showDialog("Diff failed: " + err.Error())
+		return
+	}
+	r.showDiff(r.Buf.String(), text)
+}
+
+// reloadFromDisk replaces the buffer with the file's current contents,
+// keeping the cursor on the same line and column where possible.
+func (r *Runner) reloadFromDisk() error {
+	text, format, data, err := r.readDiskText()
+	if err != nil {
+		return err
+	}
+	line := r.CursorLine
+	col := 0
+	if r.Buf != nil {
+		col = r.Cursor - r.Buf.LineStart(line)
+	}
+	r.replaceContents(text)
+	if line >= r.Buf.LineCount() {
+		line = r.Buf.LineCount() - 1
+	}
+	start, end := r.Buf.LineAt(line)
+	if end > start && r.Buf.RuneAt(end-1) == '\n' {
+		end--
+	}
+	r.Cursor = min(start+col, end)
+	r.recomputeCursorLine()
+	r.ensureCursorVisible()
+	r.Format = format
+	r.Disk = editor.DiskInfoFor(r.FilePath, data)
+	r.Dirty = false
+	r.saveBufferState()
+	if r.Logger != nil {
+		r.Logger.Event("disk.reload", map[string]any{"file": r.FilePath, "line": line})
+	}
+	return nil
+}
+
+// confirmOverwriteChanged asks before Save overwrites a file that another
+// program changed since it was loaded. Without a screen it declines.
+func (r *Runner) confirmOverwriteChanged() bool {
+	for {
+		lines := []string{r.FilePath + " changed on disk since it was loaded.", "y overwrite, n cancel, d show diff"}
+		switch r.runChoicePrompt(lines, "ynd") {
+		case 'y':
+			return true
+		case 'd':
+			r.showDiskDiff()
+		default:
+			r.draw(nil)
+			return false
+		}
+	}
+}
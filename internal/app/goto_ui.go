@@ -14,6 +14,7 @@ func (r *Runner) runGoToPrompt() {
 		return
 	}
 	input := ""
+	recall := r.Prompts.Recall(historyGoto)
 	for {
 		r.setMiniBuffer([]string{"Go to line: " + input})
 		r.draw(nil)
@@ -37,30 +38,30 @@ func (r *Runner) runGoToPrompt() {
 				if n <= 0 {
 					continue
 				}
-				text := r.Buf.String()
-				lines := strings.Split(text, "\n")
-				if n > len(lines) {
-					n = len(lines)
+				if n > r.Buf.LineCount() {
+					n = r.Buf.LineCount()
 				}
-				bytePos := 0
-				for i := 0; i < n-1 && i < len(lines); i++ {
-					bytePos += len(lines[i]) + 1
-				}
-				r.Cursor = byteOffsetToRuneIndex(text, bytePos)
+				r.Cursor = r.Buf.LineStart(n - 1)
 				// we jumped to start of line n -> set CursorLine = n-1
 				r.CursorLine = n - 1
+				r.Prompts.Add(historyGoto, strings.TrimSpace(input))
 				r.clearMiniBuffer()
 				r.draw(nil)
 				return
 			}
+			if recallKey(recall, ev, &input, true) {
+				continue
+			}
 			if ev.Key() == tcell.KeyBackspace || ev.Key() == tcell.KeyBackspace2 {
 				if len(input) > 0 {
 					input = input[:len(input)-1]
 				}
+				recall.Reset()
 				continue
 			}
 			if ev.Key() == tcell.KeyRune && ev.Modifiers() == 0 {
 				input += string(ev.Rune())
+				recall.Reset()
 				continue
 			}
 		}
@@ -0,0 +1,364 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"example.com/texteditor/pkg/buffer"
+	"example.com/texteditor/pkg/editor"
+	"example.com/texteditor/pkg/grep"
+	"example.com/texteditor/pkg/search"
+	"github.com/gdamore/tcell/v2"
+)
+
+// grepState is the last project search and its results buffer, which holds
+// a header line and then one "path:line:col: text" line per hit.
+type grepState struct {
+	buf     buffer.TextStorage
+	root    string
+	query   string
+	cancel  context.CancelFunc
+	running bool
+	stats   grep.Stats
+	err     error
+	cur     int // results line of the hit last visited
+	// lines holds each line with a hit as it was found, and disk each
+	// file's version then, so edits of the results can be written back.
+	lines map[grepKey]string
+	disk  map[string]editor.DiskInfo
+}
+
+// grepKey identifies a line with a hit.
+type grepKey struct {
+	path string
+	line int
+}
+
+// grepBatch is the payload of the interrupt events carrying the hits of a
+// file from a running grep to the event loop; done marks the last one.
+type grepBatch struct {
+	g     *grepState
+	hits  []grep.Hit
+	disk  editor.DiskInfo
+	done  bool
+	stats grep.Stats
+	err   error
+}
+
+// runGrepPrompt asks for a query and searches the project for it, with the
+// search prompt's regex and whole-word settings (Alt+R, Alt+W) and smart
+// case.
+func (r *Runner) runGrepPrompt() {
+	if r.Screen == nil {
+		return
+	}
+	input := ""
+	recall := r.Prompts.Recall(historyGrep)
+	for {
+		opt := r.grepOptions()
+		r.setMiniBuffer([]string{"Grep " + strings.TrimPrefix(searchPromptLabel(opt, input), "Search ") + ": " + input, "Alt+R regex  Alt+W whole word"})
+		r.draw(nil)
+
+		ev := r.waitEvent()
+		if ev == nil {
+			r.clearMiniBuffer()
+			return
+		}
+		kev, ok := ev.(*tcell.EventKey)
+		if !ok {
+			continue
+		}
+		switch {
+		case r.isCancelKey(kev):
+			r.clearMiniBuffer()
+			r.draw(nil)
+			return
+		case kev.Key() == tcell.KeyEnter:
+			r.clearMiniBuffer()
+			if input == "" {
+				r.draw(nil)
+				return
+			}
+			if opt.Regex {
+				if _, err := search.Compile(input, opt); err != nil {
+					r.showDialog(searchErrorLine(err))
+					continue
+				}
+			}
+			r.Prompts.Add(historyGrep, input)
+			r.startGrep(r.projectRoot(), input, opt)
+			return
+		case recallKey(recall, kev, &input, true):
+		case kev.Key() == tcell.KeyBackspace || kev.Key() == tcell.KeyBackspace2:
+			if rs := []rune(input); len(rs) > 0 {
+				input = string(rs[:len(rs)-1])
+			}
+			recall.Reset()
+		case kev.Key() == tcell.KeyRune && kev.Modifiers() == tcell.ModAlt && kev.Rune() == 'r':
+			r.searchRegex = !r.searchRegex
+		case kev.Key() == tcell.KeyRune && kev.Modifiers() == tcell.ModAlt && kev.Rune() == 'w':
+			r.searchWord = !r.searchWord
+		case kev.Key() == tcell.KeyRune && kev.Modifiers() == 0:
+			input += string(kev.Rune())
+			recall.Reset()
+		}
+	}
+}
+
+// exGrep runs ":grep pattern" like the grep prompt.
+func (r *Runner) exGrep(arg string) error {
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		return fmt.Errorf("grep: no pattern")
+	}
+	opt := r.grepOptions()
+	if opt.Regex {
+		if _, err := search.Compile(arg, opt); err != nil {
+			return err
+		}
+	}
+	r.Prompts.Add(historyGrep, arg)
+	r.startGrep(r.projectRoot(), arg, opt)
+	return nil
+}
+
+func (r *Runner) grepOptions() search.Options {
+	return search.Options{Regex: r.searchRegex, WholeWord: r.searchWord, SmartCase: true}
+}
+
+// projectRoot returns the project holding the current file, or the working
+// directory.
+func (r *Runner) projectRoot() string {
+	dir := "."
+	if r.FilePath != "" && r.View != ViewFileManager {
+		dir = filepath.Dir(r.FilePath)
+	} else if cwd, err := os.Getwd(); err == nil {
+		dir = cwd
+	}
+	return grep.FindRoot(dir)
+}
+
+// startGrep searches the files below root for query in the background and
+// focuses the results buffer, replacing the previous results. Hits are
+// appended as they are found.
+func (r *Runner) startGrep(root, query string, opt search.Options) {
+	if old := r.grep; old != nil && old.cancel != nil {
+		old.cancel()
+	}
+	if r.Ed == nil {
+		r.Ed = editor.New()
+		r.Ed.AddBuffer(r.bufferState())
+	}
+	r.saveBufferState()
+	g := &grepState{root: root, query: query, running: true, lines: map[grepKey]string{}, disk: map[string]editor.DiskInfo{}}
+	g.buf = buffer.NewFromString(r.Ed.Storage, fmt.Sprintf("grep %q in %s\n", query, root))
+	bs := editor.BufferState{Buf: g.buf}
+	if i := r.grepBufferIndex(); i >= 0 {
+		r.Ed.Buffers[i] = bs
+		r.Ed.Focus(i)
+	} else {
+		r.Ed.AddBuffer(bs)
+	}
+	r.grep = g
+	r.applyBufferState(r.Ed.CurrentBuffer())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancel = cancel
+	go func() {
+		stats, err := grep.Run(ctx, root, query, grep.Options{Search: opt}, func(f grep.File) {
+			disk := editor.DiskInfoFor(filepath.Join(root, f.Path), f.Data)
+			r.postEvent(ctx, tcell.NewEventInterrupt(grepBatch{g: g, hits: f.Hits, disk: disk}))
+		})
+		if ctx.Err() == nil {
+			r.postEvent(ctx, tcell.NewEventInterrupt(grepBatch{g: g, done: true, stats: stats, err: err}))
+		}
+	}()
+	if r.Logger != nil {
+		r.Logger.Event("action", map[string]any{"name": "grep.start", "root": root, "query": query, "regex": opt.Regex})
+	}
+	if r.Screen != nil {
+		r.draw(nil)
+	}
+}
+
+// applyGrepBatch appends the hits of b to the results buffer. Batches of an
+// earlier search are dropped.
+func (r *Runner) applyGrepBatch(b grepBatch) {
+	g := r.grep
+	if g == nil || b.g != g {
+		return
+	}
+	if b.done {
+		g.running, g.stats, g.err = false, b.stats, b.err
+		g.cancel()
+		if r.Logger != nil {
+			r.Logger.Event("grep.done", map[string]any{"query": g.query, "files": b.stats.Files, "hits": b.stats.Hits})
+		}
+		return
+	}
+	var sb strings.Builder
+	for _, h := range b.hits {
+		sb.WriteString(h.String())
+		sb.WriteByte('\n')
+		g.lines[grepKey{h.Path, h.Line}] = h.Text
+		g.disk[h.Path] = b.disk
+	}
+	_ = g.buf.Insert(g.buf.Len(), []rune(sb.String()))
+	r.touchBuffer(g.buf)
+}
+
+// touchBuffer marks buf as changed after an edit made outside the undo
+// history, whether or not it has focus.
+func (r *Runner) touchBuffer(buf buffer.TextStorage) {
+	if r.Buf == buf {
+		r.bumpEditSeq()
+		return
+	}
+	if r.Ed == nil {
+		return
+	}
+	for _, bs := range r.Ed.Buffers {
+		if ui, ok := bs.UI.(*bufferUI); ok && bs.Buf == buf {
+			r.seqClock++
+			ui.editSeq = r.seqClock
+		}
+	}
+}
+
+// grepBufferIndex returns the index of the results buffer among the open
+// buffers, or -1.
+func (r *Runner) grepBufferIndex() int {
+	if r.grep == nil || r.Ed == nil {
+		return -1
+	}
+	for i, bs := range r.Ed.Buffers {
+		if bs.Buf == r.grep.buf {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *Runner) isGrepBuffer() bool {
+	return r.grep != nil && r.Buf != nil && r.Buf == r.grep.buf
+}
+
+// title is the status line name of the results buffer.
+func (g *grepState) title() string {
+	name := fmt.Sprintf("[Grep] %q", g.query)
+	switch {
+	case g.running:
+		return name + " searching…"
+	case g.err != nil:
+		return name + " " + g.err.Error()
+	}
+	return fmt.Sprintf("%s %d hits in %d files", name, g.stats.Hits, g.stats.Files)
+}
+
+// bufferName is the name of the focused buffer in the status line.
+func (r *Runner) bufferName() string {
+	if r.isGrepBuffer() {
+		return r.grep.title()
+	}
+	return r.FilePath
+}
+
+// hit parses line i of the results buffer; line 0 is the header.
+func (g *grepState) hit(i int) (grep.Hit, bool) {
+	if i < 1 || i >= g.buf.LineCount() {
+		return grep.Hit{}, false
+	}
+	start, end := g.buf.LineAt(i)
+	return grep.Parse(strings.TrimSuffix(string(g.buf.Slice(start, end)), "\n"))
+}
+
+// openGrepHitAtCursor opens the hit on the cursor line of the results
+// buffer. It reports false if that line is not a hit.
+func (r *Runner) openGrepHitAtCursor() bool {
+	line := r.Buf.LineOf(r.Cursor)
+	h, ok := r.grep.hit(line)
+	if !ok {
+		return false
+	}
+	r.openGrepHit(line, h)
+	return true
+}
+
+// grepStep opens the next hit of the last grep, or the previous one when
+// delta is negative, from any buffer. In the results buffer it starts from
+// the cursor line.
+func (r *Runner) grepStep(delta int) {
+	g := r.grep
+	if g == nil {
+		r.showDialog("No grep results")
+		return
+	}
+	from := g.cur
+	if r.isGrepBuffer() {
+		from = r.Buf.LineOf(r.Cursor)
+	}
+	for i := from + delta; i >= 1 && i < g.buf.LineCount(); i += delta {
+		if h, ok := g.hit(i); ok {
+			r.openGrepHit(i, h)
+			return
+		}
+	}
+	if delta > 0 {
+		r.showDialog("No more hits")
+	} else {
+		r.showDialog("No earlier hits")
+	}
+}
+
+// openGrepHit opens the file of h, the hit on results line line, with the
+// cursor on the match. The results buffer keeps its cursor on the line.
+func (r *Runner) openGrepHit(line int, h grep.Hit) {
+	g := r.grep
+	g.cur = line
+	if r.isGrepBuffer() {
+		r.Cursor, r.CursorLine = g.buf.LineStart(line), line
+	} else if i := r.grepBufferIndex(); i >= 0 {
+		r.Ed.Buffers[i].Cursor, r.Ed.Buffers[i].CursorLine = g.buf.LineStart(line), line
+	}
+	path := h.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(g.root, path)
+	}
+	if err := r.focusFile(path); err != nil {
+		r.showDialog("Open failed: " + err.Error())
+		return
+	}
+	if r.Logger != nil {
+		r.Logger.Event("action", map[string]any{"name": "grep.open", "file": path, "line": h.Line, "col": h.Col})
+	}
+	n := min(h.Line, r.Buf.LineCount()) - 1
+	start, end := r.Buf.LineAt(n)
+	if end > start && r.Buf.RuneAt(end-1) == '\n' {
+		end--
+	}
+	r.Cursor = min(start+h.Col-1, end)
+	r.CursorLine = n
+	r.ensureCursorVisible()
+	if r.Screen != nil {
+		r.draw(nil)
+	}
+}
+
+// handleGrepKeys handles F4 and Shift+F4, which step through the hits of
+// the last grep from any buffer, and Enter on a hit in the results buffer.
+func (r *Runner) handleGrepKeys(ev *tcell.EventKey) bool {
+	switch {
+	case ev.Key() == tcell.KeyF4 && ev.Modifiers() == 0:
+		r.grepStep(1)
+	case ev.Key() == tcell.KeyF4 && ev.Modifiers() == tcell.ModShift, ev.Key() == tcell.KeyF16:
+		r.grepStep(-1)
+	case ev.Key() == tcell.KeyEnter && ev.Modifiers() == 0 && r.Mode == ModeNormal && r.isGrepBuffer() && !r.operatorPending():
+		return r.openGrepHitAtCursor()
+	default:
+		return false
+	}
+	return true
+}
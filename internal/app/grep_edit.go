@@ -0,0 +1,301 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"example.com/texteditor/pkg/editor"
+	"github.com/gdamore/tcell/v2"
+)
+
+// errGrepConflict reports a file whose lines no longer read as the search
+// found them.
+var errGrepConflict = errors.New("changed since the search")
+
+// grepLineEdit is a line changed in the grep results.
+type grepLineEdit struct {
+	line     int // counting from 1
+	old, new string
+}
+
+// grepFileEdit collects the changed lines of one file, in order.
+type grepFileEdit struct {
+	path  string // as listed in the results
+	edits []grepLineEdit
+}
+
+// grepEditChanges compares the hit lines of the results buffer with the
+// lines the search found, by file. Lines that no longer read as hits are
+// left out; a line listed for several hits must not be changed two ways.
+func (r *Runner) grepEditChanges() ([]grepFileEdit, error) {
+	g := r.grep
+	edited := map[grepKey]string{}
+	for i := 1; i < g.buf.LineCount(); i++ {
+		h, ok := g.hit(i)
+		if !ok {
+			continue
+		}
+		key := grepKey{h.Path, h.Line}
+		old, ok := g.lines[key]
+		if !ok {
+			return nil, fmt.Errorf("line %d: the search found no %s:%d", i+1, h.Path, h.Line)
+		}
+		if h.Text == old {
+			continue
+		}
+		if prev, ok := edited[key]; ok && prev != h.Text {
+			return nil, fmt.Errorf("%s:%d is changed in two ways", h.Path, h.Line)
+		}
+		edited[key] = h.Text
+	}
+	byPath := map[string]*grepFileEdit{}
+	var changes []*grepFileEdit
+	for key, text := range edited {
+		fe := byPath[key.path]
+		if fe == nil {
+			fe = &grepFileEdit{path: key.path}
+			byPath[key.path] = fe
+			changes = append(changes, fe)
+		}
+		fe.edits = append(fe.edits, grepLineEdit{line: key.line, old: g.lines[key], new: text})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].path < changes[j].path })
+	out := make([]grepFileEdit, len(changes))
+	for i, fe := range changes {
+		sort.Slice(fe.edits, func(a, b int) bool { return fe.edits[a].line < fe.edits[b].line })
+		out[i] = *fe
+	}
+	return out, nil
+}
+
+// applyGrepEdits writes the lines changed in the grep results back to their
+// files, showing each file's diff first:
+//
+//	y  write this file     n      skip it
+//	!  write all the rest  q/Esc  stop
+//
+// Open buffers are changed in place, as one undo step each, and left to be
+// saved; other files are rewritten on disk. A file is skipped as a conflict
+// if it changed on disk since the search or its lines no longer read as
+// found.
+func (r *Runner) applyGrepEdits() {
+	if !r.isGrepBuffer() {
+		return
+	}
+	g := r.grep
+	changes, err := r.grepEditChanges()
+	if err != nil {
+		r.showDialog("Grep edit: " + err.Error())
+		return
+	}
+	if len(changes) == 0 {
+		r.Dirty = false
+		r.showDialog("No changes to write")
+		return
+	}
+	var written, updated, skipped []string
+	var failed []string
+	all := false
+	for i, fe := range changes {
+		if !all {
+			switch r.confirmGrepFileEdit(fe, i, len(changes)) {
+			case 'n':
+				skipped = append(skipped, fe.path)
+				continue
+			case 'q':
+				for _, rest := range changes[i:] {
+					skipped = append(skipped, rest.path)
+				}
+				goto done
+			case '!':
+				all = true
+			}
+		}
+		switch inBuffer, err := r.applyGrepFileEdit(fe); {
+		case err != nil:
+			failed = append(failed, fe.path+": "+err.Error())
+		case inBuffer:
+			updated = append(updated, fe.path)
+		default:
+			written = append(written, fe.path)
+		}
+		if err == nil {
+			for _, e := range fe.edits {
+				g.lines[grepKey{fe.path, e.line}] = e.new
+			}
+		}
+	}
+done:
+	if len(skipped) == 0 && len(failed) == 0 {
+		r.Dirty = false
+		r.saveBufferState()
+	}
+	if r.Logger != nil {
+		r.Logger.Event("action", map[string]any{"name": "grep.apply", "written": len(written), "buffers": len(updated), "skipped": len(skipped), "failed": len(failed)})
+	}
+	lines := []string{fmt.Sprintf("Wrote %d file(s), changed %d open buffer(s)", len(written), len(updated))}
+	if len(skipped) > 0 {
+		lines = append(lines, "Skipped: "+strings.Join(skipped, ", "))
+	}
+	lines = append(lines, failed...)
+	r.showDialogLines(lines)
+}
+
+// confirmGrepFileEdit shows the diff of fe, the n'th of count files, and
+// returns the answer: 'y', 'n', '!' or 'q'.
+func (r *Runner) confirmGrepFileEdit(fe grepFileEdit, n, count int) rune {
+	if r.Screen == nil {
+		return 'y'
+	}
+	lines := r.grepDiffLines(fe)
+	lines = append(lines, fmt.Sprintf("Write %s (%d of %d)? (y/n/!/q)", fe.path, n+1, count))
+	r.setMiniBuffer(lines)
+	r.draw(nil)
+	defer r.clearMiniBuffer()
+	for {
+		ev := r.waitEvent()
+		if ev == nil {
+			return 'q'
+		}
+		kev, ok := ev.(*tcell.EventKey)
+		if !ok {
+			continue
+		}
+		if r.isCancelKey(kev) {
+			return 'q'
+		}
+		if kev.Key() != tcell.KeyRune {
+			continue
+		}
+		switch c := kev.Rune(); c {
+		case 'y', 'n', '!', 'q':
+			return c
+		case 'Y', 'N', 'Q':
+			return c + 'a' - 'A'
+		}
+	}
+}
+
+// grepDiffLines shows the changed lines of fe as a diff, as many as fit on
+// the screen.
+func (r *Runner) grepDiffLines(fe grepFileEdit) []string {
+	width, height := 0, 0
+	if r.Screen != nil {
+		width, height = r.Screen.Size()
+	}
+	clip := func(line string) string {
+		if runes := []rune(line); width > 0 && len(runes) > width {
+			return string(runes[:width])
+		}
+		return line
+	}
+	lines := []string{clip("--- " + fe.path)}
+	// keep room for the prompt, the status line and a line of text
+	limit := len(fe.edits)
+	if height > 0 {
+		limit = max(1, min(limit, (height-4)/2))
+	}
+	for _, e := range fe.edits[:limit] {
+		lines = append(lines, clip(fmt.Sprintf("%d - %s", e.line, e.old)), clip(fmt.Sprintf("%d + %s", e.line, e.new)))
+	}
+	if limit < len(fe.edits) {
+		lines = append(lines, fmt.Sprintf("... and %d more", len(fe.edits)-limit))
+	}
+	return lines
+}
+
+// applyGrepFileEdit applies fe to the buffer editing its file, if there is
+// one, or else to the file on disk. It reports which it did.
+func (r *Runner) applyGrepFileEdit(fe grepFileEdit) (inBuffer bool, err error) {
+	path := fe.path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.grep.root, path)
+	}
+	if r.Ed != nil {
+		if i := r.Ed.Find(path); i >= 0 {
+			return true, r.applyGrepEditToBuffer(i, fe)
+		}
+	}
+	return false, r.applyGrepEditToFile(path, fe)
+}
+
+// applyGrepEditToBuffer changes the lines of open buffer i, then gives the
+// focus back.
+func (r *Runner) applyGrepEditToBuffer(i int, fe grepFileEdit) error {
+	back := r.Ed.Current
+	r.saveBufferState()
+	r.applyBufferState(r.Ed.Focus(i))
+	defer func() {
+		r.saveBufferState()
+		r.applyBufferState(r.Ed.Focus(back))
+	}()
+	bounds := make([][2]int, len(fe.edits))
+	for j, e := range fe.edits {
+		if e.line > r.Buf.LineCount() {
+			return errGrepConflict
+		}
+		start, end := r.Buf.LineAt(e.line - 1)
+		if end > start && r.Buf.RuneAt(end-1) == '\n' {
+			end--
+		}
+		// the '\r' of a line in a file with mixed endings is kept
+		if end > start && r.Buf.RuneAt(end-1) == '\r' {
+			end--
+		}
+		if string(r.Buf.Slice(start, end)) != e.old {
+			return errGrepConflict
+		}
+		bounds[j] = [2]int{start, end}
+	}
+	r.beginEdit()
+	defer r.endEdit()
+	// from the bottom up, so the bounds above stay valid
+	for j := len(fe.edits) - 1; j >= 0; j-- {
+		r.replaceRange(bounds[j][0], bounds[j][1], fe.edits[j].new)
+	}
+	return nil
+}
+
+// applyGrepEditToFile rewrites the file at path with fe applied, keeping its
+// encoding and line endings.
+func (r *Runner) applyGrepEditToFile(path string, fe grepFileEdit) error {
+	if changed, _, err := r.grep.disk[fe.path].CheckDisk(path); err != nil {
+		return err
+	} else if changed {
+		return errGrepConflict
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	text, format, enc := editor.DecodeFile(data)
+	lines := strings.Split(text, "\n")
+	for _, e := range fe.edits {
+		if e.line > len(lines) {
+			return errGrepConflict
+		}
+		// the lines are decoded as at search time, and keep the '\r' of a
+		// file with mixed endings
+		line, cr := strings.CutSuffix(lines[e.line-1], "\r")
+		if line != e.old {
+			return errGrepConflict
+		}
+		lines[e.line-1] = e.new
+		if cr {
+			lines[e.line-1] += "\r"
+		}
+	}
+	out, err := editor.EncodeFile(strings.Join(lines, "\n"), format, enc)
+	if err != nil {
+		return err
+	}
+	if err := editor.WriteFile(path, out, r.SaveOptions); err != nil {
+		return err
+	}
+	r.grep.disk[fe.path] = editor.DiskInfoFor(path, out)
+	return nil
+}
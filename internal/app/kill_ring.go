@@ -1,7 +1,9 @@
 package app
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"strings"
 
 	"github.com/gdamore/tcell/v2"
@@ -27,7 +29,7 @@ func (r *Runner) killRingStatusLines() []string {
 	}
 	lines := []string{
 		"Kill ring (Esc/Ctrl+G or Enter to accept)",
-		"Use Ctrl+N/P or arrows to cycle",
+		"Use Ctrl+N/P or arrows to cycle, Tab to browse",
 	}
 	entries := r.KillRing.EntriesFromCurrent()
 	width := 0
@@ -100,16 +102,34 @@ func (r *Runner) yankPop(direction int) {
 		r.showDialog("Kill ring has no alternate entries")
 		return
 	}
-	start := r.lastYankStart
-	end := r.lastYankEnd
+	if !r.replaceLastYank() {
+		r.showDialog("Unable to cycle yank")
+		return
+	}
+	if r.Logger != nil {
+		r.Logger.Event("action", map[string]any{"name": "yank.pop", "text": r.KillRing.Get(), "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
+	}
+	if r.Screen != nil {
+		r.draw(nil)
+	}
+	r.showKillRingStatus()
+}
+
+// replaceLastYank replaces the text of the last yank with the current kill
+// ring entry, repeated as often as the yank was. It reports false, and
+// forgets the yank, when the yanked range is gone.
+func (r *Runner) replaceLastYank() bool {
+	start, end := r.lastYank.Bounds()
+	if !r.lastYank.Start.Attached(r.Buf.Markers()) {
+		start = -1
+	}
 	count := r.lastYankCount
 	if count < 1 {
 		count = 1
 	}
 	if start < 0 || end < start || end > r.Buf.Len() {
 		r.clearYankState()
-		r.showDialog("Unable to cycle yank")
-		return
+		return false
 	}
 	r.yankInProgress = true
 	r.Cursor = start
@@ -120,17 +140,28 @@ func (r *Runner) yankPop(direction int) {
 		r.insertText(text)
 	}
 	r.yankInProgress = false
-	r.lastYankStart = start
-	r.lastYankEnd = r.Cursor
+	r.setLastYank(start, r.Cursor)
 	r.lastYankCount = count
 	r.lastYankValid = true
-	if r.Logger != nil {
-		r.Logger.Event("action", map[string]any{"name": "yank.pop", "text": text, "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
+	return true
+}
+
+// yankEntry makes entry i of the kill ring current and yanks it: over the
+// text just yanked while that yank can still be cycled, at the cursor
+// otherwise.
+func (r *Runner) yankEntry(i int) {
+	if r.Buf == nil || !r.KillRing.Select(i) {
+		return
 	}
-	if r.Screen != nil {
-		r.draw(nil)
+	if !r.lastYankValid || !r.replaceLastYank() {
+		start := r.beginYankTracking()
+		r.insertText(r.KillRing.Get())
+		r.endYankTracking(start, 1)
+	}
+	r.recomputeCursorLine()
+	if r.Logger != nil {
+		r.Logger.Event("action", map[string]any{"name": "yank.browse", "text": r.KillRing.Get(), "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
 	}
-	r.showKillRingStatus()
 }
 
 func (r *Runner) runKillRingCycle() {
@@ -166,6 +197,164 @@ func (r *Runner) runKillRingCycle() {
 			r.yankPop(1)
 		case kev.Key() == tcell.KeyRune && kev.Rune() == 'p' && kev.Modifiers() == tcell.ModCtrl:
 			r.yankPop(-1)
+		case kev.Key() == tcell.KeyTab:
+			r.runKillRingBrowser()
+			return
+		}
+	}
+}
+
+// killRingMatches returns the indexes in KillRing.Entries of the entries
+// that contain filter, ignoring case.
+func (r *Runner) killRingMatches(filter string) []int {
+	filter = strings.ToLower(filter)
+	var out []int
+	for i, e := range r.KillRing.Entries() {
+		if strings.Contains(strings.ToLower(e), filter) {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// killRingBrowserLines lays out the kill ring browser for a screen of the
+// given size: a header and the filter, the matching entries around sel,
+// and below them as much of the selected entry as fits.
+func (r *Runner) killRingBrowserLines(filter string, matches []int, sel, width, height int) []string {
+	rows := max(height-1, 4) // the status bar stays
+	listRows := max((rows-3)/2, 1)
+	entries := r.KillRing.Entries()
+	lines := []string{
+		"Kill ring: type to filter, Up/Down select, Enter yank, Ctrl+D delete entry, Esc close",
+		"Filter: " + filter,
+	}
+	top := max(0, min(sel-listRows/2, len(matches)-listRows))
+	for i := top; i < top+listRows; i++ {
+		switch {
+		case i < len(matches):
+			prefix := "  "
+			if i == sel {
+				prefix = "> "
+			}
+			lines = append(lines, fmt.Sprintf("%s%3d  %s", prefix, matches[i]+1, r.killRingPreview(entries[matches[i]])))
+		case i == 0:
+			lines = append(lines, "  (no matching entries)")
+		default:
+			lines = append(lines, "")
+		}
+	}
+	var preview []string
+	if sel < len(matches) {
+		text := entries[matches[sel]]
+		preview = strings.Split(strings.ReplaceAll(text, "\t", "    "), "\n")
+		lines = append(lines, fmt.Sprintf("-- entry %d: %d lines, %d characters --", matches[sel]+1, len(preview), len([]rune(text))))
+	} else {
+		lines = append(lines, "--")
+	}
+	previewRows := rows - len(lines)
+	if len(preview) > previewRows && previewRows > 0 {
+		more := len(preview) - previewRows + 1
+		preview = append(preview[:previewRows-1:previewRows-1], fmt.Sprintf("... %d more lines", more))
+	}
+	for i := 0; i < previewRows; i++ {
+		line := ""
+		if i < len(preview) {
+			line = preview[i]
+		}
+		lines = append(lines, line)
+	}
+	for i, line := range lines {
+		if runes := []rune(line); width > 0 && len(runes) > width {
+			lines[i] = string(runes[:width])
 		}
 	}
+	return lines
+}
+
+// runKillRingBrowser shows the kill ring full screen. Typing filters the
+// entries, Up/Down or Ctrl+N/P select one and Enter yanks it, replacing the
+// text just yanked when opened from the kill ring cycle. Ctrl+D deletes
+// the selected entry from the ring.
+func (r *Runner) runKillRingBrowser() {
+	if !r.KillRing.HasData() {
+		r.showDialog("Kill ring is empty")
+		return
+	}
+	if r.Screen == nil {
+		return
+	}
+	defer func() {
+		r.clearMiniBuffer()
+		r.draw(nil)
+	}()
+	filter := ""
+	sel := r.KillRing.Index()
+	for {
+		matches := r.killRingMatches(filter)
+		sel = max(0, min(sel, len(matches)-1))
+		width, height := r.Screen.Size()
+		r.setMiniBuffer(r.killRingBrowserLines(filter, matches, sel, width, height))
+		r.draw(nil)
+		ev := r.waitEvent()
+		if ev == nil {
+			return
+		}
+		kev, ok := ev.(*tcell.EventKey)
+		if !ok {
+			continue
+		}
+		switch {
+		case r.isCancelKey(kev):
+			return
+		case kev.Key() == tcell.KeyEnter:
+			if len(matches) > 0 {
+				r.yankEntry(matches[sel])
+			}
+			return
+		case kev.Key() == tcell.KeyDown || kev.Key() == tcell.KeyCtrlN || (kev.Key() == tcell.KeyRune && kev.Rune() == 'n' && kev.Modifiers() == tcell.ModCtrl):
+			sel++
+		case kev.Key() == tcell.KeyUp || kev.Key() == tcell.KeyCtrlP || (kev.Key() == tcell.KeyRune && kev.Rune() == 'p' && kev.Modifiers() == tcell.ModCtrl):
+			sel--
+		case kev.Key() == tcell.KeyCtrlD || (kev.Key() == tcell.KeyRune && kev.Rune() == 'd' && kev.Modifiers() == tcell.ModCtrl):
+			if len(matches) > 0 {
+				r.KillRing.Remove(matches[sel])
+				if r.Logger != nil {
+					r.Logger.Event("action", map[string]any{"name": "killring.remove", "entry": matches[sel]})
+				}
+				if !r.KillRing.HasData() {
+					return
+				}
+			}
+		case kev.Key() == tcell.KeyBackspace || kev.Key() == tcell.KeyBackspace2:
+			if runes := []rune(filter); len(runes) > 0 {
+				filter = string(runes[:len(runes)-1])
+				sel = 0
+			}
+		case kev.Key() == tcell.KeyCtrlU:
+			filter = ""
+			sel = 0
+		case kev.Key() == tcell.KeyRune && kev.Modifiers()&(tcell.ModCtrl|tcell.ModAlt) == 0:
+			filter += string(kev.Rune())
+			sel = 0
+		}
+	}
+}
+
+// loadKillRing restores the kill ring kept by the previous session.
+func (r *Runner) loadKillRing() {
+	if r.KillRingPath == "" {
+		return
+	}
+	if err := r.KillRing.ReadFile(r.KillRingPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		r.logStateError("killring.read.error", err)
+	}
+}
+
+func (r *Runner) writeKillRing() {
+	if r.KillRingPath == "" {
+		return
+	}
+	if err := r.KillRing.WriteFile(r.KillRingPath); err != nil {
+		r.logStateError("killring.write.error", err)
+	}
 }
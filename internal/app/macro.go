@@ -7,12 +7,15 @@ type macroEvent struct {
 	Key       tcell.Key
 	Rune      rune
 	Modifiers tcell.ModMask
+	Text      string
 }
 
 type macroEventKind int
 
 const (
 	macroEventKey macroEventKind = iota
+	// macroEventPaste is a bracketed paste, replayed as one insert.
+	macroEventPaste
 )
 
 type macroStartResult int
@@ -104,11 +107,22 @@ func (r *Runner) recordMacroEvent(ev *tcell.EventKey) {
 	})
 }
 
+// recordMacroPaste records a bracketed paste as a single insert of text.
+func (r *Runner) recordMacroPaste(text string) {
+	if text == "" || !r.macroRecording || r.macroPlaying || r.macroPendingRecord || r.macroPendingPlay || r.macroRepeatPending || r.macroRepeatAwaitAt || r.macroRecordRegister == "" {
+		return
+	}
+	r.macroRegisters[r.macroRecordRegister] = append(r.macroRegisters[r.macroRecordRegister], macroEvent{
+		Kind: macroEventPaste,
+		Text: text,
+	})
+}
+
 func (r *Runner) macroEventFromKey(ev *tcell.EventKey) macroEvent {
 	return macroEvent{Kind: macroEventKey, Key: ev.Key(), Rune: ev.Rune(), Modifiers: ev.Modifiers()}
 }
 
-func (r *Runner) consumeMacroEvent() (*tcell.EventKey, bool) {
+func (r *Runner) consumeMacroEvent() (tcell.Event, bool) {
 	if len(r.macroPlayback) == 0 {
 		r.macroPlaying = false
 		r.macroRepeatPending = true
@@ -121,6 +135,8 @@ func (r *Runner) consumeMacroEvent() (*tcell.EventKey, bool) {
 	switch ev.Kind {
 	case macroEventKey:
 		return tcell.NewEventKey(ev.Key, ev.Rune, ev.Modifiers), true
+	case macroEventPaste:
+		return newPasteEvent(ev.Text), true
 	default:
 		return nil, false
 	}
@@ -134,7 +150,7 @@ func (r *Runner) clearMacroPending() {
 }
 
 func (r *Runner) isMacroCaptureAllowed(ev *tcell.EventKey) bool {
-	if !r.macroRecording || r.macroPlaying || r.macroRepeatPending || r.macroRepeatAwaitAt {
+	if !r.macroRecording || r.pasting || r.macroPlaying || r.macroRepeatPending || r.macroRepeatAwaitAt {
 		return false
 	}
 	if r.matchCommand(ev, "save") || r.matchCommand(ev, "quit") || r.matchCommand(ev, "menu") {
@@ -0,0 +1,309 @@
+package app
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"unicode"
+
+	"example.com/texteditor/pkg/buffer"
+	"example.com/texteditor/pkg/editor"
+)
+
+// globalMark is a file mark A-Z. marker is nil until the file is loaded;
+// until then pos holds the position read from the marks file.
+type globalMark struct {
+	path   string
+	pos    int
+	marker *buffer.Marker
+}
+
+func (g *globalMark) position() int {
+	if p := g.marker.Pos(); p >= 0 {
+		return p
+	}
+	return g.pos
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// markKey finishes a mark command: kind is 'm' to set the mark, or ' or `
+// to jump to it (linewise or exactly) or to end a pending operator there.
+func (r *Runner) markKey(kind, name rune) {
+	if !unicode.IsLetter(name) || name > unicode.MaxASCII {
+		r.cancelOperator()
+		return
+	}
+	if kind == 'm' {
+		r.setMark(name)
+		return
+	}
+	linewise := kind == '\''
+	if r.operatorPending() {
+		pos, ok := r.markInBuffer(name)
+		if !ok {
+			r.cancelOperator()
+			r.showDialog("Mark not set in this buffer: " + string(name))
+			return
+		}
+		r.operateToMark(pos, linewise)
+		return
+	}
+	r.jumpToMark(name, linewise)
+}
+
+// setMark places mark name at the cursor. Lowercase marks belong to the
+// buffer; uppercase ones remember the file too.
+func (r *Runner) setMark(name rune) {
+	if r.Buf == nil {
+		return
+	}
+	if unicode.IsLower(name) {
+		if r.marks == nil {
+			r.marks = map[rune]*buffer.Marker{}
+		}
+		if old := r.marks[name]; old.Attached(r.Buf.Markers()) {
+			old.SetPos(r.Cursor)
+			return
+		}
+		r.marks[name] = r.Buf.Markers().Add(r.Cursor, buffer.RightGravity)
+		return
+	}
+	if r.FilePath == "" || r.View == ViewFileManager {
+		r.showDialog("File marks need a file name")
+		return
+	}
+	if r.globalMarks == nil {
+		r.globalMarks = map[rune]*globalMark{}
+	}
+	// from whichever buffer holds it
+	if old := r.globalMarks[name]; old != nil {
+		old.marker.Remove()
+	}
+	r.globalMarks[name] = &globalMark{path: absPath(r.FilePath), pos: r.Cursor, marker: r.Buf.Markers().Add(r.Cursor, buffer.RightGravity)}
+}
+
+// markInBuffer returns the position of mark name if it is in the focused
+// buffer.
+func (r *Runner) markInBuffer(name rune) (int, bool) {
+	if r.Buf == nil {
+		return 0, false
+	}
+	if unicode.IsLower(name) {
+		m := r.marks[name]
+		if !m.Attached(r.Buf.Markers()) {
+			return 0, false
+		}
+		return m.Pos(), true
+	}
+	g := r.globalMarks[name]
+	if g == nil || !g.marker.Attached(r.Buf.Markers()) {
+		return 0, false
+	}
+	return g.marker.Pos(), true
+}
+
+// jumpToMark moves the cursor to mark name, switching to its file for an
+// uppercase mark. A linewise jump lands on the first non-blank of the line.
+func (r *Runner) jumpToMark(name rune, linewise bool) {
+	r.PendingCount = 0
+	pos, ok := r.markInBuffer(name)
+	if !ok && unicode.IsUpper(name) {
+		if g := r.globalMarks[name]; g != nil {
+			if err := r.focusFile(g.path); err != nil {
+				r.showDialog("Mark " + string(name) + ": " + err.Error())
+				return
+			}
+			pos, ok = r.markInBuffer(name)
+		}
+	}
+	if !ok {
+		r.showDialog("Mark not set: " + string(name))
+		return
+	}
+	r.Cursor = min(pos, r.Buf.Len())
+	if linewise {
+		r.Cursor = r.Buf.LineStart(r.Buf.LineOf(r.Cursor))
+		for r.Cursor < r.Buf.Len() && (r.Buf.RuneAt(r.Cursor) == ' ' || r.Buf.RuneAt(r.Cursor) == '\t') {
+			r.Cursor++
+		}
+	}
+	r.recomputeCursorLine()
+	r.ensureCursorVisible()
+	if r.Logger != nil {
+		r.Logger.Event("action", map[string]any{"name": "mark.jump", "mark": string(name), "cursor": r.Cursor})
+	}
+	if r.Screen != nil {
+		r.draw(nil)
+	}
+}
+
+// operateToMark applies the pending d, c or y from the cursor to pos,
+// covering whole lines when linewise.
+func (r *Runner) operateToMark(pos int, linewise bool) {
+	start, end := min(r.Cursor, pos), max(r.Cursor, pos)
+	if linewise {
+		start = r.Buf.LineStart(r.Buf.LineOf(start))
+		_, end = r.Buf.LineAt(r.Buf.LineOf(end))
+	}
+	r.PendingCount = 0
+	text := string(r.Buf.Slice(start, end))
+	switch {
+	case r.PendingY:
+		r.PendingY = false
+		r.clearYankState()
+		r.storeYank(text)
+		r.Cursor = start
+	case r.PendingD:
+		r.PendingD = false
+		_ = r.deleteRange(start, end, text)
+		r.storeDelete(text)
+	case r.PendingC:
+		r.PendingC = false
+		_ = r.deleteRange(start, end, text)
+		r.storeDelete(text)
+		r.Mode = ModeInsert
+	}
+	r.recomputeCursorLine()
+	if r.Screen != nil {
+		r.draw(nil)
+	}
+}
+
+// focusFile switches to the buffer editing path, loading it if needed.
+func (r *Runner) focusFile(path string) error {
+	if r.Ed != nil {
+		if i := r.Ed.Find(path); i >= 0 {
+			if i != r.Ed.Current {
+				r.saveBufferState()
+				r.applyBufferState(r.Ed.Focus(i))
+			}
+			return nil
+		}
+	}
+	return r.LoadFile(path)
+}
+
+// restoreMarks attaches the marks kept for the file just loaded.
+func (r *Runner) restoreMarks() {
+	if r.Buf == nil || r.FilePath == "" {
+		return
+	}
+	path := absPath(r.FilePath)
+	if r.savedMarks != nil {
+		for key, pos := range r.savedMarks.Local[path] {
+			if name := []rune(key); len(name) == 1 && unicode.IsLower(name[0]) {
+				if r.marks == nil {
+					r.marks = map[rune]*buffer.Marker{}
+				}
+				r.marks[name[0]] = r.Buf.Markers().Add(min(pos, r.Buf.Len()), buffer.RightGravity)
+			}
+		}
+	}
+	for _, g := range r.globalMarks {
+		if g.path == path && g.marker.Pos() < 0 {
+			g.marker = r.Buf.Markers().Add(min(g.pos, r.Buf.Len()), buffer.RightGravity)
+		}
+	}
+	r.saveBufferState()
+}
+
+// moveMarks carries the marks of old over to r.Buf after its contents were
+// replaced, keeping their positions where the new text allows.
+func (r *Runner) moveMarks(old buffer.TextStorage) {
+	if old == nil || old == r.Buf {
+		return
+	}
+	for name, m := range r.marks {
+		if m.Attached(old.Markers()) {
+			r.marks[name] = r.Buf.Markers().Add(min(m.Pos(), r.Buf.Len()), buffer.RightGravity)
+		}
+	}
+	for _, g := range r.globalMarks {
+		if g.marker.Attached(old.Markers()) {
+			g.marker = r.Buf.Markers().Add(min(g.marker.Pos(), r.Buf.Len()), buffer.RightGravity)
+		}
+	}
+}
+
+// loadMarks reads the marks kept by the previous session. Lowercase marks
+// are attached when their file is loaded.
+func (r *Runner) loadMarks() {
+	if r.MarksPath == "" {
+		return
+	}
+	m, err := editor.ReadMarks(r.MarksPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			r.logStateError("marks.read.error", err)
+		}
+		return
+	}
+	r.savedMarks = m
+	for key, fm := range m.Global {
+		if name := []rune(key); len(name) == 1 && unicode.IsUpper(name[0]) {
+			if r.globalMarks == nil {
+				r.globalMarks = map[rune]*globalMark{}
+			}
+			r.globalMarks[name[0]] = &globalMark{path: fm.Path, pos: fm.Pos}
+		}
+	}
+}
+
+// writeMarks stores the marks of every open file, keeping those read for
+// files that were not opened this session.
+func (r *Runner) writeMarks() {
+	if r.MarksPath == "" {
+		return
+	}
+	out := &editor.Marks{Global: map[string]editor.FileMark{}, Local: map[string]map[string]int{}}
+	if r.savedMarks != nil {
+		for path, marks := range r.savedMarks.Local {
+			out.Local[path] = marks
+		}
+	}
+	r.saveBufferState()
+	for _, bs := range r.openBuffers() {
+		ui, _ := bs.UI.(*bufferUI)
+		if bs.FilePath == "" || ui == nil {
+			continue
+		}
+		marks := map[string]int{}
+		for name, m := range ui.marks {
+			if p := m.Pos(); p >= 0 {
+				marks[string(name)] = p
+			}
+		}
+		out.Local[absPath(bs.FilePath)] = marks
+	}
+	for name, g := range r.globalMarks {
+		out.Global[string(name)] = editor.FileMark{Path: g.path, Pos: g.position()}
+	}
+	if err := out.WriteFile(r.MarksPath); err != nil {
+		r.logStateError("marks.write.error", err)
+	}
+}
+
+// LoadState restores the registers, marks, kill ring and prompt history
+// kept by the previous session. Call it before loading files so their
+// marks are attached.
+func (r *Runner) LoadState() {
+	r.loadRegisters()
+	r.loadMarks()
+	r.loadKillRing()
+	r.loadPromptHistory()
+}
+
+// writeState keeps registers, marks, the kill ring and prompt history for
+// the next session; it runs on quit.
+func (r *Runner) writeState() {
+	r.writeRegisters()
+	r.writeMarks()
+	r.writeKillRing()
+	r.writePromptHistory()
+}
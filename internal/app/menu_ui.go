@@ -4,6 +4,7 @@ import (
 	"os"
 	"strings"
 
+	"example.com/texteditor/pkg/editor"
 	"github.com/gdamore/tcell/v2"
 )
 
@@ -16,7 +17,9 @@ func (r *Runner) commandList() []command {
 	return []command{
 		{name: "open file manager", action: func() bool { r.runFileManager(); return false }},
 		{name: "save", action: func() bool {
-			if r.FilePath == "" {
+			if r.isGrepBuffer() {
+				r.applyGrepEdits()
+			} else if r.FilePath == "" {
 				r.runSaveAsPrompt()
 			} else {
 				if err := r.Save(); err == nil {
@@ -28,6 +31,12 @@ func (r *Runner) commandList() []command {
 			}
 			return false
 		}},
+		{name: "format: LF line endings", action: func() bool { r.setLineEnding(editor.LineEndingLF); return false }},
+		{name: "format: CRLF line endings", action: func() bool { r.setLineEnding(editor.LineEndingCRLF); return false }},
+		{name: "format: CR line endings", action: func() bool { r.setLineEnding(editor.LineEndingCR); return false }},
+		{name: "format: toggle BOM", action: func() bool { r.toggleBOM(); return false }},
+		{name: "format: toggle final newline", action: func() bool { r.toggleFinalNewline(); return false }},
+		{name: "format: reopen with encoding", action: func() bool { r.runReopenEncodingPrompt(); return false }},
 		{name: "spell: toggle", action: func() bool {
 			if r.Spell != nil && r.Spell.Enabled {
 				r.DisableSpellCheck()
@@ -56,9 +65,21 @@ func (r *Runner) commandList() []command {
 		{name: "theme: next", action: func() bool { r.NextTheme(); return false }},
 		{name: "theme: previous", action: func() bool { r.PrevTheme(); return false }},
 		{name: "clipboard: cycle", action: func() bool { r.runKillRingCycle(); return false }},
+		{name: "clipboard: browse kill ring", action: func() bool { r.runKillRingBrowser(); return false }},
+		{name: "clipboard: mirror kills to system clipboard (toggle)", action: func() bool { r.toggleClipboardMirror(); return false }},
 		{name: "multi-edit", action: func() bool { r.toggleMultiEdit(); return false }},
 		{name: "search", action: func() bool { r.runSearchPrompt(); return false }},
+		{name: "query replace", action: func() bool { r.runQueryReplace(); return false }},
+		{name: "grep project", action: func() bool { r.runGrepPrompt(); return false }},
+		{name: "grep: next hit", action: func() bool { r.grepStep(1); return false }},
+		{name: "grep: previous hit", action: func() bool { r.grepStep(-1); return false }},
+		{name: "grep: apply edits", action: func() bool { r.applyGrepEdits(); return false }},
 		{name: "go to line", action: func() bool { r.runGoToPrompt(); return false }},
+		{name: "undo: tree", action: func() bool { r.runUndoTree(); return false }},
+		{name: "undo: next branch", action: func() bool { r.switchUndoBranch(1); return false }},
+		{name: "undo: previous branch", action: func() bool { r.switchUndoBranch(-1); return false }},
+		{name: "undo: command line (:earlier, :later)", action: func() bool { r.runExPrompt(); return false }},
+		{name: "undo: history memory use", action: func() bool { r.showUndoMem(); return false }},
 		{name: "macro: record", action: r.maybeMacroMenuAction(func() bool { r.startMacroRecording(""); r.draw(nil); return false })},
 		{name: "macro: stop", action: r.maybeMacroMenuAction(func() bool { r.stopMacroRecording(); r.draw(nil); return false })},
 		{name: "macro: play", action: r.maybeMacroMenuAction(func() bool { r.beginMacroPlayback(""); r.draw(nil); return false })},
@@ -86,6 +107,9 @@ func (r *Runner) runCommandMenu() bool {
 	query := ""
 	sel := 0
 	filtered := cmds
+	// Up and Down recall commands run before; the recalled one is selected
+	recall := r.Prompts.Recall(historyCommand)
+	recalled := false
 	for {
 		if query != "" {
 			tmp := make([]command, 0, len(cmds))
@@ -101,6 +125,14 @@ func (r *Runner) runCommandMenu() bool {
 		if len(filtered) == 0 {
 			filtered = []command{}
 		}
+		if recalled {
+			for i, c := range filtered {
+				if c.name == query {
+					sel = i
+				}
+			}
+			recalled = false
+		}
 		if sel >= len(filtered) {
 			sel = len(filtered) - 1
 		}
@@ -137,6 +169,7 @@ func (r *Runner) runCommandMenu() bool {
 				return false
 			case kev.Key() == tcell.KeyEnter:
 				if len(filtered) > 0 {
+					r.Prompts.Add(historyCommand, filtered[sel].name)
 					r.clearMiniBuffer()
 					r.Overlay = OverlayNone
 					return filtered[sel].action()
@@ -150,6 +183,9 @@ func (r *Runner) runCommandMenu() bool {
 					query = query[:len(query)-1]
 					sel = 0
 				}
+				recall.Reset()
+			case recallKey(recall, kev, &query, true):
+				recalled = true
 			case kev.Key() == tcell.KeyCtrlP || (kev.Key() == tcell.KeyRune && kev.Rune() == 'p' && kev.Modifiers() == tcell.ModCtrl):
 				if sel > 0 {
 					sel--
@@ -161,6 +197,7 @@ func (r *Runner) runCommandMenu() bool {
 			case kev.Key() == tcell.KeyRune && kev.Modifiers() == 0:
 				query += string(kev.Rune())
 				sel = 0
+				recall.Reset()
 			}
 		}
 	}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"example.com/texteditor/pkg/editor"
 	"github.com/gdamore/tcell/v2"
 )
 
@@ -25,7 +26,9 @@ func (r *Runner) mnemonicMenu() []*mnemonicNode {
 					return false
 				}},
 				{key: 's', name: "save", action: func() bool {
-					if r.FilePath == "" {
+					if r.isGrepBuffer() {
+						r.applyGrepEdits()
+					} else if r.FilePath == "" {
 						r.runSaveAsPrompt()
 					} else {
 						if err := r.Save(); err == nil {
@@ -41,6 +44,14 @@ func (r *Runner) mnemonicMenu() []*mnemonicNode {
 					r.runSaveAsPrompt()
 					return false
 				}},
+				{key: 'e', name: "line endings", children: []*mnemonicNode{
+					{key: 'l', name: "LF (unix)", action: func() bool { r.setLineEnding(editor.LineEndingLF); return false }},
+					{key: 'w', name: "CRLF (windows)", action: func() bool { r.setLineEnding(editor.LineEndingCRLF); return false }},
+					{key: 'm', name: "CR (classic mac)", action: func() bool { r.setLineEnding(editor.LineEndingCR); return false }},
+				}},
+				{key: 'b', name: "toggle BOM", action: func() bool { r.toggleBOM(); return false }},
+				{key: 'n', name: "toggle final newline", action: func() bool { r.toggleFinalNewline(); return false }},
+				{key: 'c', name: "reopen with encoding", action: func() bool { r.runReopenEncodingPrompt(); return false }},
 			},
 		},
 		{
@@ -86,6 +97,8 @@ func (r *Runner) mnemonicMenu() []*mnemonicNode {
 			name: "clipboard",
 			children: []*mnemonicNode{
 				{key: 'c', name: "cycle kill ring", action: func() bool { r.runKillRingCycle(); return false }},
+				{key: 'b', name: "browse kill ring", action: func() bool { r.runKillRingBrowser(); return false }},
+				{key: 'm', name: "mirror kills to system clipboard", action: func() bool { r.toggleClipboardMirror(); return false }},
 			},
 		},
 		{
@@ -104,7 +117,7 @@ func (r *Runner) mnemonicMenu() []*mnemonicNode {
 			key:  's',
 			name: "search",
 			children: []*mnemonicNode{
-				{key: 's', name: "search (case-insensitive)", action: func() bool {
+				{key: 's', name: "search (smart case)", action: func() bool {
 					r.runSearchPromptCase(false)
 					return false
 				}},
@@ -112,6 +125,37 @@ func (r *Runner) mnemonicMenu() []*mnemonicNode {
 					r.runSearchPromptCase(true)
 					return false
 				}},
+				{key: 'r', name: "query replace", action: func() bool {
+					r.runQueryReplace()
+					return false
+				}},
+				{key: 'g', name: "grep project", action: func() bool {
+					r.runGrepPrompt()
+					return false
+				}},
+				{key: 'n', name: "next grep hit", action: func() bool {
+					r.grepStep(1)
+					return false
+				}},
+				{key: 'p', name: "previous grep hit", action: func() bool {
+					r.grepStep(-1)
+					return false
+				}},
+				{key: 'a', name: "apply grep edits", action: func() bool {
+					r.applyGrepEdits()
+					return false
+				}},
+			},
+		},
+		{
+			key:  'u',
+			name: "undo",
+			children: []*mnemonicNode{
+				{key: 't', name: "tree", action: func() bool { r.runUndoTree(); return false }},
+				{key: 'n', name: "next branch", action: func() bool { r.switchUndoBranch(1); return false }},
+				{key: 'p', name: "previous branch", action: func() bool { r.switchUndoBranch(-1); return false }},
+				{key: 'e', name: "earlier/later (:)", action: func() bool { r.runExPrompt(); return false }},
+				{key: 'm', name: "memory use", action: func() bool { r.showUndoMem(); return false }},
 			},
 		},
 		{
@@ -3,25 +3,47 @@ package app
 import (
 	"fmt"
 
+	"example.com/texteditor/pkg/buffer"
 	"example.com/texteditor/pkg/search"
 )
 
 type multiEditState struct {
-	target       string
-	primaryStart int
-	primaryEnd   int
-	applying     bool
-	matches      []search.Range
+	target string
+	// primary is the match being edited; it grows with text typed at its
+	// edges. matches keep to the text they cover, primary first.
+	primary  buffer.Span
+	applying bool
+	matches  []buffer.Span
 }
 
-func (r *Runner) multiEditPrimaryIndex(text string) int {
-	st := r.MultiEdit
-	if st == nil || len(st.matches) == 0 {
-		return -1
+// matchRanges returns the matches as byte ranges of buf.
+func (st *multiEditState) matchRanges(buf buffer.TextStorage) []search.Range {
+	out := make([]search.Range, 0, len(st.matches))
+	for _, sp := range st.matches {
+		start, end := sp.Bounds()
+		out = append(out, search.Range{Start: buf.ByteOffset(start), End: buf.ByteOffset(end)})
+	}
+	return out
+}
+
+// setMatches tracks matches, byte ranges of text, in place of the current
+// ones.
+func (st *multiEditState) setMatches(buf buffer.TextStorage, text string, matches []search.Range) {
+	for _, sp := range st.matches {
+		sp.Remove()
+	}
+	st.matches = st.matches[:0]
+	for _, m := range matches {
+		start := byteOffsetToRuneIndex(text, m.Start)
+		end := byteOffsetToRuneIndex(text, m.End)
+		st.matches = append(st.matches, buf.Markers().AddSpan(start, end, true))
 	}
-	primaryStart := runeIndexToByteOffset(text, st.primaryStart)
-	primaryEnd := runeIndexToByteOffset(text, st.primaryEnd)
-	return searchPrimaryIndex(st.matches, primaryStart, primaryEnd)
+}
+
+// release stops tracking the matches.
+func (st *multiEditState) release() {
+	st.setMatches(nil, "", nil)
+	st.primary.Remove()
 }
 
 func reorderMatchesForPrimary(matches []search.Range, primaryStart, primaryEnd int) []search.Range {
@@ -35,57 +57,6 @@ func reorderMatchesForPrimary(matches []search.Range, primaryStart, primaryEnd i
 	return matches
 }
 
-func (r *Runner) adjustMultiEditMatchesForInsert(pos int, inserted string) {
-	st := r.MultiEdit
-	if st == nil || r.Buf == nil || inserted == "" {
-		return
-	}
-	text := r.Buf.String()
-	posByte := runeIndexToByteOffset(text, pos)
-	insertBytes := len([]byte(inserted))
-	for i, m := range st.matches {
-		switch {
-		case posByte <= m.Start:
-			m.Start += insertBytes
-			m.End += insertBytes
-		case posByte < m.End:
-			m.End += insertBytes
-		}
-		st.matches[i] = m
-	}
-}
-
-func (r *Runner) adjustMultiEditMatchesForDelete(start int, deleted string) {
-	st := r.MultiEdit
-	if st == nil || r.Buf == nil || deleted == "" {
-		return
-	}
-	text := r.Buf.String()
-	startByte := runeIndexToByteOffset(text, start)
-	deletedBytes := len([]byte(deleted))
-	endByte := startByte + deletedBytes
-	for i, m := range st.matches {
-		newStart := offsetAfterDelete(m.Start, startByte, endByte)
-		newEnd := offsetAfterDelete(m.End, startByte, endByte)
-		if newEnd < newStart {
-			newEnd = newStart
-		}
-		m.Start = newStart
-		m.End = newEnd
-		st.matches[i] = m
-	}
-}
-
-func offsetAfterDelete(pos, start, end int) int {
-	if pos < start {
-		return pos
-	}
-	if pos >= end {
-		return pos - (end - start)
-	}
-	return start
-}
-
 func searchPrimaryIndex(matches []search.Range, primaryStart, primaryEnd int) int {
 	if len(matches) == 0 {
 		return -1
@@ -127,7 +98,7 @@ func (r *Runner) startMultiEdit() {
 	if r.Mode == ModeInsert {
 		r.finalizeInsertCapture()
 	}
-	if r.Mode == ModeVisual && r.VisualStart >= 0 {
+	if r.Mode == ModeVisual && r.visualStart() >= 0 {
 		start, end := r.visualSelectionBounds()
 		if end <= start {
 			r.showDialog("Multi-edit needs a selection")
@@ -191,7 +162,7 @@ func (r *Runner) enterMultiEdit(text string, start, end int) {
 	r.PendingTextObject = false
 	r.TextObjectAround = false
 	r.PendingCount = 0
-	r.VisualStart = -1
+	r.setVisualStart(-1)
 	r.VisualLine = false
 	r.Mode = ModeMultiEdit
 	bufText := r.Buf.String()
@@ -204,18 +175,18 @@ func (r *Runner) enterMultiEdit(text string, start, end int) {
 	primaryStart := runeIndexToByteOffset(bufText, start)
 	primaryEnd := runeIndexToByteOffset(bufText, end)
 	matches = reorderMatchesForPrimary(matches, primaryStart, primaryEnd)
-	r.MultiEdit = &multiEditState{
-		target:       text,
-		primaryStart: start,
-		primaryEnd:   end,
-		matches:      matches,
-	}
+	st := &multiEditState{target: text, primary: r.Buf.Markers().AddSpan(start, end, false)}
+	st.setMatches(r.Buf, bufText, matches)
+	r.MultiEdit = st
 	if r.Screen != nil {
 		r.draw(nil)
 	}
 }
 
 func (r *Runner) exitMultiEdit() {
+	if r.MultiEdit != nil {
+		r.MultiEdit.release()
+	}
 	r.Mode = ModeNormal
 	r.MultiEdit = nil
 	r.clearMiniBuffer()
@@ -234,9 +205,10 @@ func (r *Runner) refreshMultiEditState() bool {
 	if len(matches) == 0 {
 		return false
 	}
-	primaryStart := runeIndexToByteOffset(text, st.primaryStart)
-	primaryEnd := runeIndexToByteOffset(text, st.primaryEnd)
-	st.matches = reorderMatchesForPrimary(matches, primaryStart, primaryEnd)
+	start, end := st.primary.Bounds()
+	primaryStart := runeIndexToByteOffset(text, start)
+	primaryEnd := runeIndexToByteOffset(text, end)
+	st.setMatches(r.Buf, text, reorderMatchesForPrimary(matches, primaryStart, primaryEnd))
 	r.setMiniBuffer(r.multiEditStatusLines(text))
 	return true
 }
@@ -257,13 +229,12 @@ func (r *Runner) multiEditHighlights() []search.Range {
 	if len(st.matches) == 0 {
 		return nil
 	}
-	out := make([]search.Range, 0, len(st.matches))
-	for i, m := range st.matches {
-		group := "bg.multiedit"
+	out := st.matchRanges(r.Buf)
+	for i := range out {
+		out[i].Group = "bg.multiedit"
 		if i == 0 {
-			group = "bg.multiedit.current"
+			out[i].Group = "bg.multiedit.current"
 		}
-		out = append(out, search.Range{Start: m.Start, End: m.End, Group: group})
 	}
 	return out
 }
@@ -292,8 +263,9 @@ func (r *Runner) multiEditStatusLines(text string) []string {
 	if maxEntries > len(st.matches) {
 		maxEntries = len(st.matches)
 	}
+	ranges := st.matchRanges(r.Buf)
 	for i := 0; i < maxEntries; i++ {
-		m := st.matches[i]
+		m := ranges[i]
 		if m.Start < 0 {
 			m.Start = 0
 		}
@@ -328,8 +300,7 @@ func (r *Runner) multiEditPrimaryText() string {
 	if st == nil || r.Buf == nil {
 		return ""
 	}
-	start := st.primaryStart
-	end := st.primaryEnd
+	start, end := st.primary.Bounds()
 	if start < 0 {
 		start = 0
 	}
@@ -350,17 +321,10 @@ func (r *Runner) handleMultiEditInsert(inserted string, pos int) {
 	if inserted == "" {
 		return
 	}
+	// the primary and the matches already followed the edit
 	oldTarget := st.target
-	insertLen := len([]rune(inserted))
-	if pos < st.primaryStart {
-		st.primaryStart += insertLen
-		st.primaryEnd += insertLen
-	} else if pos <= st.primaryEnd {
-		st.primaryEnd += insertLen
-	}
 	newTarget := r.multiEditPrimaryText()
 	if newTarget == oldTarget {
-		r.adjustMultiEditMatchesForInsert(pos, inserted)
 		r.updateMultiEditStatus()
 		return
 	}
@@ -381,30 +345,8 @@ func (r *Runner) handleMultiEditDelete(start, end int, deleted string) {
 		return
 	}
 	oldTarget := st.target
-	deletedLen := end - start
-	if end <= st.primaryStart {
-		st.primaryStart -= deletedLen
-		st.primaryEnd -= deletedLen
-	} else if start < st.primaryEnd && end > st.primaryStart {
-		if start < st.primaryStart {
-			st.primaryStart = start
-		}
-		overlapStart := start
-		if overlapStart < st.primaryStart {
-			overlapStart = st.primaryStart
-		}
-		overlapEnd := end
-		if overlapEnd > st.primaryEnd {
-			overlapEnd = st.primaryEnd
-		}
-		st.primaryEnd -= overlapEnd - overlapStart
-		if st.primaryEnd < st.primaryStart {
-			st.primaryEnd = st.primaryStart
-		}
-	}
 	newTarget := r.multiEditPrimaryText()
 	if newTarget == oldTarget {
-		r.adjustMultiEditMatchesForDelete(start, deleted)
 		r.updateMultiEditStatus()
 		return
 	}
@@ -422,11 +364,14 @@ func (r *Runner) applyMultiEditReplace(oldTarget, newTarget string) {
 		return
 	}
 	text := r.Buf.String()
-	primaryStart := runeIndexToByteOffset(text, st.primaryStart)
-	primaryEnd := runeIndexToByteOffset(text, st.primaryEnd)
+	start, end := st.primary.Bounds()
+	primaryStart := runeIndexToByteOffset(text, start)
+	primaryEnd := runeIndexToByteOffset(text, end)
 	matches := search.SearchAll(text, oldTarget)
 	st.applying = true
 	defer func() { st.applying = false }()
+	r.beginEdit()
+	defer r.endEdit()
 	for i := len(matches) - 1; i >= 0; i-- {
 		m := matches[i]
 		if m.Start < primaryEnd && m.End > primaryStart {
@@ -442,8 +387,10 @@ func (r *Runner) applyMultiEditReplace(oldTarget, newTarget string) {
 		r.exitMultiEdit()
 		return
 	}
-	primaryStart = runeIndexToByteOffset(updatedText, st.primaryStart)
-	primaryEnd = runeIndexToByteOffset(updatedText, st.primaryEnd)
+	// the primary span moved with the replacements before it
+	start, end = st.primary.Bounds()
+	primaryStart = runeIndexToByteOffset(updatedText, start)
+	primaryEnd = runeIndexToByteOffset(updatedText, end)
 	primaryIndex := searchPrimaryIndex(updatedMatches, primaryStart, primaryEnd)
 	if primaryIndex < 0 {
 		primaryStart = runeIndexToByteOffset(updatedText, r.Cursor)
@@ -457,6 +404,6 @@ func (r *Runner) applyMultiEditReplace(oldTarget, newTarget string) {
 		updatedMatches[0], updatedMatches[primaryIndex] = updatedMatches[primaryIndex], updatedMatches[0]
 	}
 	st.target = newTarget
-	st.matches = updatedMatches
+	st.setMatches(r.Buf, updatedText, updatedMatches)
 	r.updateMultiEditStatus()
 }
@@ -12,6 +12,7 @@ func (r *Runner) runOpenPrompt() {
 	}
 	input := ""
 	errMsg := ""
+	recall := r.Prompts.Recall(historyOpen)
 	for {
 		lines := []string{"Open: " + input}
 		if errMsg != "" {
@@ -48,6 +49,7 @@ func (r *Runner) runOpenPrompt() {
 					}
 					continue
 				}
+				r.Prompts.Add(historyOpen, path)
 				if r.Logger != nil {
 					r.Logger.Event("open.prompt.success", map[string]any{"file": path})
 				}
@@ -55,17 +57,24 @@ func (r *Runner) runOpenPrompt() {
 				r.draw(nil)
 				return
 			}
+			// History
+			if recallKey(recall, ev, &input, true) {
+				errMsg = ""
+				continue
+			}
 			// Backspace
 			if ev.Key() == tcell.KeyBackspace || ev.Key() == tcell.KeyBackspace2 {
 				if len(input) > 0 {
 					input = input[:len(input)-1]
 				}
+				recall.Reset()
 				continue
 			}
 			// Type
 			if ev.Key() == tcell.KeyRune && ev.Modifiers() == 0 {
 				input += string(ev.Rune())
 				errMsg = ""
+				recall.Reset()
 				continue
 			}
 		}
@@ -0,0 +1,91 @@
+package app
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// pasteEvent replays a bracketed paste recorded in a macro.
+type pasteEvent struct {
+	tcell.EventTime
+	text string
+}
+
+func newPasteEvent(text string) *pasteEvent {
+	ev := &pasteEvent{text: text}
+	ev.SetEventNow()
+	return ev
+}
+
+// readPaste collects the keys of a bracketed paste until the terminal ends
+// it, then inserts them as one edit. The keys never reach handleKeyEvent, so
+// they cannot run commands, and a macro being recorded gets the paste as a
+// single literal insert instead of its keys.
+func (r *Runner) readPaste() {
+	r.pasting = true
+	var b strings.Builder
+	cr := false
+	for {
+		ev := r.waitEvent()
+		if ev == nil {
+			break
+		}
+		if p, ok := ev.(*tcell.EventPaste); ok && p.End() {
+			break
+		}
+		kev, ok := ev.(*tcell.EventKey)
+		if !ok {
+			continue
+		}
+		switch kev.Key() {
+		case tcell.KeyRune:
+			b.WriteRune(kev.Rune())
+		case tcell.KeyEnter:
+			b.WriteByte('\n')
+		case tcell.KeyLF:
+			// CR LF line endings
+			if !cr {
+				b.WriteByte('\n')
+			}
+		case tcell.KeyTab:
+			b.WriteByte('\t')
+		}
+		cr = kev.Key() == tcell.KeyEnter
+	}
+	r.pasting = false
+	text := b.String()
+	r.recordMacroPaste(text)
+	r.insertPasted(text)
+}
+
+// insertPasted inserts pasted text at the cursor in a single insertText, as
+// is, whatever the mode. A visual selection is dropped first; the file
+// manager only takes pastes while a name is being edited.
+func (r *Runner) insertPasted(text string) {
+	if text == "" || r.Buf == nil {
+		return
+	}
+	if r.View == ViewFileManager && !r.isInsertMode() {
+		return
+	}
+	if r.Mode == ModeVisual {
+		r.Mode = ModeNormal
+		r.setVisualStart(-1)
+		r.VisualLine = false
+	}
+	r.PendingG, r.PendingD, r.PendingC, r.PendingY = false, false, false, false
+	r.PendingTextObject = false
+	r.PendingCount = 0
+	r.register = 0
+	r.beginKeyGroup()
+	r.insertText(text)
+	r.endKeyGroup()
+	r.ensureCursorVisible()
+	if r.Logger != nil {
+		r.Logger.Event("action", map[string]any{"name": "paste.bracketed", "runes": len([]rune(text)), "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
+	}
+	if r.Screen != nil {
+		r.draw(nil)
+	}
+}
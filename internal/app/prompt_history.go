@@ -0,0 +1,57 @@
+package app
+
+import (
+	"errors"
+	"io/fs"
+
+	"example.com/texteditor/pkg/history"
+	"github.com/gdamore/tcell/v2"
+)
+
+// Names of the prompt history rings.
+const (
+	historySearch  = "search"  // search prompt, / and ?
+	historyReplace = "replace" // query-replace strings
+	historyOpen    = "open"    // opened paths
+	historyGoto    = "goto"    // line numbers
+	historyCommand = "command" // command menu entries
+	historyEx      = "ex"      // : command lines
+	historyGrep    = "grep"    // project searches
+)
+
+// recallKey handles the history keys of a prompt: Alt+P and Alt+N, and Up
+// and Down when arrows is set, replace input with an older or newer entry
+// that starts with what was typed. It reports whether ev was one of them.
+func recallKey(c *history.Recall, ev *tcell.EventKey, input *string, arrows bool) bool {
+	switch {
+	case arrows && ev.Key() == tcell.KeyUp, ev.Key() == tcell.KeyRune && ev.Rune() == 'p' && ev.Modifiers() == tcell.ModAlt:
+		if e, ok := c.Prev(*input); ok {
+			*input = e
+		}
+		return true
+	case arrows && ev.Key() == tcell.KeyDown, ev.Key() == tcell.KeyRune && ev.Rune() == 'n' && ev.Modifiers() == tcell.ModAlt:
+		if e, ok := c.Next(); ok {
+			*input = e
+		}
+		return true
+	}
+	return false
+}
+
+func (r *Runner) loadPromptHistory() {
+	if r.PromptHistoryPath == "" {
+		return
+	}
+	if err := r.Prompts.ReadFile(r.PromptHistoryPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		r.logStateError("history.read.error", err)
+	}
+}
+
+func (r *Runner) writePromptHistory() {
+	if r.PromptHistoryPath == "" {
+		return
+	}
+	if err := r.Prompts.WriteFile(r.PromptHistoryPath); err != nil {
+		r.logStateError("history.write.error", err)
+	}
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// runChoicePrompt shows lines in the mini-buffer and waits for one of the
+// runes in choices (case-insensitive). It returns the chosen rune in lower
+// case, or 0 when cancelled or when no screen is attached.
+func (r *Runner) runChoicePrompt(lines []string, choices string) rune {
+	if r.Screen == nil {
+		return 0
+	}
+	r.setMiniBuffer(lines)
+	r.draw(nil)
+	for {
+		ev := r.waitEvent()
+		if ev == nil {
+			return 0
+		}
+		kev, ok := ev.(*tcell.EventKey)
+		if !ok {
+			continue
+		}
+		if r.isCancelKey(kev) {
+			r.clearMiniBuffer()
+			r.draw(nil)
+			return 0
+		}
+		if kev.Key() != tcell.KeyRune {
+			continue
+		}
+		ch := unicode.ToLower(kev.Rune())
+		for _, c := range choices {
+			if c == ch {
+				r.clearMiniBuffer()
+				return ch
+			}
+		}
+	}
+}
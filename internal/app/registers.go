@@ -0,0 +1,230 @@
+package app
+
+import (
+	"errors"
+	"io/fs"
+
+	"example.com/texteditor/pkg/history"
+	"github.com/gdamore/tcell/v2"
+)
+
+// handleRegisterKeys handles '"' register selection and the m, ' and `
+// mark commands in normal and visual mode, including the key that names
+// the register or mark. It runs before the operator keys so a pending d, c
+// or y survives until the mark is known.
+func (r *Runner) handleRegisterKeys(ev *tcell.EventKey) bool {
+	if r.Mode != ModeNormal && r.Mode != ModeVisual {
+		r.pendingRegister = false
+		r.pendingMark = 0
+		return false
+	}
+	if r.macroPendingRecord || r.macroPendingPlay || r.macroRepeatPending {
+		return false
+	}
+	isRune := ev.Key() == tcell.KeyRune && ev.Modifiers() == 0
+	if r.pendingRegister {
+		r.pendingRegister = false
+		if isRune && history.IsRegister(ev.Rune()) {
+			r.register = ev.Rune()
+			r.registerFresh = true
+		} else {
+			r.register = 0
+		}
+		return true
+	}
+	if r.pendingMark != 0 {
+		kind := r.pendingMark
+		r.pendingMark = 0
+		if isRune {
+			r.markKey(kind, ev.Rune())
+		} else {
+			r.cancelOperator()
+		}
+		return true
+	}
+	if !isRune || r.PendingTextObject {
+		return false
+	}
+	switch ev.Rune() {
+	case '"':
+		r.pendingRegister = true
+		return true
+	case 'm':
+		if r.Mode == ModeNormal && !r.operatorPending() {
+			r.pendingMark = 'm'
+			return true
+		}
+	case '\'', '`':
+		if r.Mode == ModeNormal {
+			r.pendingMark = ev.Rune()
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Runner) operatorPending() bool {
+	return r.PendingD || r.PendingC || r.PendingY
+}
+
+func (r *Runner) cancelOperator() {
+	r.PendingD = false
+	r.PendingC = false
+	r.PendingY = false
+	r.PendingCount = 0
+	r.register = 0
+}
+
+// expireRegister forgets the chosen register once a key neither chose it
+// nor left a command waiting for more keys, so "a only applies to the
+// command that follows it.
+func (r *Runner) expireRegister() {
+	if r.registerFresh {
+		r.registerFresh = false
+		return
+	}
+	if r.pendingRegister || r.pendingMark != 0 || r.operatorPending() || r.PendingTextObject || r.PendingCount > 0 {
+		return
+	}
+	r.register = 0
+}
+
+// takeRegister returns the register chosen for this command, 0 if none,
+// and clears the choice.
+func (r *Runner) takeRegister() rune {
+	name := r.register
+	r.register = 0
+	return name
+}
+
+// storeYank records yanked text in the chosen register. Like Vim, the
+// unnamed register, here the kill ring, gets it too unless the black hole
+// register was chosen.
+func (r *Runner) storeYank(text string) {
+	name := r.takeRegister()
+	if name == '_' {
+		return
+	}
+	r.Registers.Yank(name, text)
+	r.pushUnnamed(name, text)
+}
+
+// storeDelete records deleted or cut text in the chosen register, or in
+// the numbered delete registers when none was chosen.
+func (r *Runner) storeDelete(text string) {
+	name := r.takeRegister()
+	if name == '_' {
+		return
+	}
+	r.Registers.Delete(name, text)
+	r.pushUnnamed(name, text)
+}
+
+// storeKill records text cut by Ctrl+K. A kill right after another one
+// extends the same kill ring entry and register 1, as in Emacs.
+func (r *Runner) storeKill(text string) {
+	if r.killAppend && r.register == 0 {
+		r.KillRing.Append(text)
+		r.Registers.AppendDelete(text)
+		r.mirrorKill(r.KillRing.Get())
+	} else {
+		r.storeDelete(text)
+	}
+	r.lastKill = true
+}
+
+// pushUnnamed puts text, or the whole register after an appending write,
+// on the kill ring. Registers '+' and '*' also copy it to the clipboard.
+func (r *Runner) pushUnnamed(name rune, text string) {
+	if name >= 'A' && name <= 'Z' {
+		text, _ = r.Registers.Get(name)
+	}
+	r.KillRing.Push(text)
+	if isClipboardRegister(name) {
+		r.copyToClipboard(name, text)
+	} else {
+		r.mirrorKill(text)
+	}
+}
+
+// registerText returns the text of register name for p and P: the current
+// kill ring entry for the unnamed register.
+func (r *Runner) registerText(name rune) (string, bool) {
+	if name == 0 || name == '"' {
+		return r.KillRing.Get(), r.KillRing.HasData()
+	}
+	return r.Registers.Get(name)
+}
+
+// paste implements p (after the cursor) and P (before) with the chosen
+// register.
+func (r *Runner) paste(before bool, count int) {
+	name := r.takeRegister()
+	if isClipboardRegister(name) {
+		r.clipboardPaste(name, before, count)
+		return
+	}
+	if text, ok := r.registerText(name); ok {
+		r.insertPaste(text, before, count)
+	}
+}
+
+// insertPaste inserts count copies of text after or before the cursor as
+// one yank, so it can be cycled through the kill ring.
+func (r *Runner) insertPaste(text string, before bool, count int) {
+	if r.Buf == nil {
+		return
+	}
+	if !before && r.Cursor < r.Buf.Len() {
+		// paste after the cursor position
+		if r.Buf.RuneAt(r.Cursor) == '\n' {
+			r.CursorLine++
+		}
+		r.Cursor++
+	}
+	start := r.beginYankTracking()
+	for i := 0; i < count; i++ {
+		r.insertText(text)
+	}
+	r.endYankTracking(start, count)
+	if r.Logger != nil {
+		name := "paste.normal"
+		if before {
+			name = "paste.before"
+		}
+		r.Logger.Event("action", map[string]any{"name": name, "text": text, "count": count, "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
+	}
+	if r.Screen != nil {
+		r.draw(nil)
+	}
+}
+
+// loadRegisters restores the registers kept by the previous session.
+func (r *Runner) loadRegisters() {
+	if r.RegistersPath == "" {
+		return
+	}
+	rs, err := history.ReadRegisters(r.RegistersPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			r.logStateError("registers.read.error", err)
+		}
+		return
+	}
+	r.Registers = *rs
+}
+
+func (r *Runner) writeRegisters() {
+	if r.RegistersPath == "" {
+		return
+	}
+	if err := r.Registers.WriteFile(r.RegistersPath); err != nil {
+		r.logStateError("registers.write.error", err)
+	}
+}
+
+func (r *Runner) logStateError(event string, err error) {
+	if r.Logger != nil {
+		r.Logger.Event(event, map[string]any{"error": err.Error()})
+	}
+}
@@ -0,0 +1,329 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+
+	"example.com/texteditor/pkg/buffer"
+	"example.com/texteditor/pkg/search"
+	"github.com/gdamore/tcell/v2"
+)
+
+// replaceEdit is a replacement made by query-replace, kept so u can put the
+// original text back.
+type replaceEdit struct {
+	start       int // rune offset
+	original    string
+	replacement string
+}
+
+// replaceMatch is a match as rune offsets with its replacement expanded.
+// text and groups are the matched text and the offsets of its groups in it,
+// kept so the replacement can be expanded again after it is edited.
+type replaceMatch struct {
+	start, end  int
+	replacement string
+	replaced    bool
+	text        string
+	groups      []int
+}
+
+// expand returns template expanded for the match in regex mode, and
+// template itself otherwise.
+func (m replaceMatch) expand(re *regexp.Regexp, regex bool, template string) string {
+	if !regex {
+		return template
+	}
+	return string(re.ExpandString(nil, template, m.text, m.groups))
+}
+
+// compileReplaceQuery compiles the query of a query-replace. Literal queries
+// are quoted so both kinds share the regexp code path; either is smart-case.
+func compileReplaceQuery(query string, regex bool) (*regexp.Regexp, error) {
+	opt := search.Options{Regex: true, SmartCase: true}
+	if !regex {
+		opt.CaseSensitive = search.HasUpper(query, false)
+		query = regexp.QuoteMeta(query)
+	}
+	return search.Compile(query, opt)
+}
+
+// runQueryReplace asks for a query and its replacement, then steps through
+// the matches after the cursor, or inside the visual selection, asking what
+// to do with each:
+//
+//	y or Space  replace and go on      n or Delete  skip
+//	!           replace all the rest    q or Esc     stop
+//	u           undo the last replace  e            edit the replacement
+//
+// In regex mode (Alt+R at the first prompt) the replacement may refer to
+// groups as $1 or ${name}. The whole session undoes as one step.
+func (r *Runner) runQueryReplace() {
+	if r.Screen == nil || r.Buf == nil {
+		return
+	}
+	var scope *buffer.Span
+	if r.Mode == ModeVisual && r.visualStart() >= 0 {
+		start, end := r.visualSelectionBounds()
+		sp := r.Buf.Markers().AddSpan(start, end, false)
+		scope = &sp
+		defer sp.Remove()
+		r.Mode = ModeNormal
+		r.setVisualStart(-1)
+		r.VisualLine = false
+	}
+	var re *regexp.Regexp
+	query, ok := r.readReplaceInput(func() string {
+		label := "Query replace"
+		if r.searchRegex {
+			label += " regexp"
+		}
+		if scope != nil {
+			label += " in selection"
+		}
+		return label
+	}, "", true, func(q string) error {
+		var err error
+		re, err = compileReplaceQuery(q, r.searchRegex)
+		return err
+	})
+	if !ok || query == "" {
+		r.clearMiniBuffer()
+		r.draw(nil)
+		return
+	}
+	regex := r.searchRegex
+	replacement, ok := r.readReplaceInput(func() string {
+		return fmt.Sprintf("Query replace %q with", query)
+	}, "", false, nil)
+	if !ok {
+		r.clearMiniBuffer()
+		r.draw(nil)
+		return
+	}
+
+	r.beginEdit()
+	defer r.endEdit()
+	pos := r.Cursor
+	if scope != nil {
+		pos, _ = scope.Bounds()
+	}
+	var done []replaceEdit
+	all := false
+	// matches are found once; shift is the rune length change the
+	// replacements made since then add to matches[idx:]
+	matches := r.replaceMatches(re, scope)
+	idx, shift := 0, 0
+	rescan := func() {
+		matches = r.replaceMatches(re, scope)
+		idx, shift = 0, 0
+	}
+	apply := func(m replaceMatch) {
+		original := string(r.Buf.Slice(m.start, m.end))
+		r.replaceRange(m.start, m.end, m.replacement)
+		done = append(done, replaceEdit{start: m.start, original: original, replacement: m.replacement})
+		n := len([]rune(m.replacement))
+		pos = m.start + n
+		shift += n - (m.end - m.start)
+		matches[idx].replaced = true
+	}
+loop:
+	for {
+		for idx < len(matches) && matches[idx].start+shift < pos {
+			idx++
+		}
+		if idx == len(matches) {
+			break
+		}
+		matches[idx].replacement = matches[idx].expand(re, regex, replacement)
+		if all {
+			m := matches[idx]
+			m.start += shift
+			m.end += shift
+			apply(m)
+			continue
+		}
+		// settle the shift before the matches are shown
+		for i := idx; i < len(matches); i++ {
+			matches[i].start += shift
+			matches[i].end += shift
+		}
+		shift = 0
+		m := matches[idx]
+		r.Cursor = m.start
+		r.recomputeCursorLine()
+		r.ensureCursorVisible()
+		r.setMiniBuffer([]string{
+			fmt.Sprintf("Replace %q with %q? (y/n/!/q/u/e)", string(r.Buf.Slice(m.start, m.end)), m.replacement),
+			fmt.Sprintf("%d of %d left; %d replaced", len(matches)-idx, len(matches), len(done)),
+		})
+		r.draw(r.replaceHighlights(matches, idx))
+
+		next := r.waitEvent()
+		if next == nil {
+			break
+		}
+		ev, ok := next.(*tcell.EventKey)
+		if !ok {
+			continue
+		}
+		if r.isCancelKey(ev) || ev.Key() == tcell.KeyEnter {
+			break
+		}
+		if ev.Key() == tcell.KeyDelete || ev.Key() == tcell.KeyBackspace || ev.Key() == tcell.KeyBackspace2 {
+			pos = m.end
+			continue
+		}
+		if ev.Key() != tcell.KeyRune || ev.Modifiers() != 0 {
+			continue
+		}
+		switch ev.Rune() {
+		case 'y', ' ':
+			apply(m)
+		case 'n':
+			pos = m.end
+		case '!':
+			all = true
+			apply(m)
+		case 'q':
+			break loop
+		case 'u':
+			if len(done) == 0 {
+				continue
+			}
+			last := done[len(done)-1]
+			done = done[:len(done)-1]
+			r.replaceRange(last.start, last.start+len([]rune(last.replacement)), last.original)
+			pos = last.start
+			rescan()
+		case 'e':
+			edited, ok := r.readReplaceInput(func() string { return "Edit replacement" }, replacement, false, nil)
+			if !ok {
+				continue
+			}
+			replacement = edited
+			// the edited replacement applies from this match on
+			m.replacement = m.expand(re, regex, edited)
+			apply(m)
+		}
+	}
+	if len(done) > 0 {
+		last := done[len(done)-1]
+		r.Cursor = min(last.start+len([]rune(last.replacement)), r.Buf.Len())
+	}
+	r.recomputeCursorLine()
+	if r.Logger != nil {
+		r.Logger.Event("action", map[string]any{"name": "replace.query", "regex": regex, "replaced": len(done)})
+	}
+	r.showDialog(fmt.Sprintf("Replaced %d occurrence(s)", len(done)))
+	r.clearMiniBuffer()
+	r.draw(nil)
+}
+
+// replaceMatches finds the non-empty matches of re in the buffer, inside
+// scope when it is set. Their replacements are expanded as they are reached.
+func (r *Runner) replaceMatches(re *regexp.Regexp, scope *buffer.Span) []replaceMatch {
+	text := r.Buf.String()
+	lo, hi := 0, len(text)
+	if scope != nil {
+		start, end := scope.Bounds()
+		lo, hi = r.Buf.ByteOffset(start), r.Buf.ByteOffset(end)
+	}
+	var out []replaceMatch
+	// the matches come in order, so rune offsets are counted on from the
+	// previous one
+	at, runes := 0, 0
+	for _, loc := range re.FindAllStringSubmatchIndex(text, -1) {
+		if loc[0] == loc[1] || loc[0] < lo || loc[1] > hi {
+			continue
+		}
+		// groups lie within the match, so their offsets are kept relative
+		// to it
+		groups := make([]int, len(loc))
+		for i, off := range loc {
+			groups[i] = off
+			if off >= 0 {
+				groups[i] -= loc[0]
+			}
+		}
+		start := runes + utf8.RuneCountInString(text[at:loc[0]])
+		end := start + utf8.RuneCountInString(text[loc[0]:loc[1]])
+		at, runes = loc[1], end
+		out = append(out, replaceMatch{start: start, end: end, text: text[loc[0]:loc[1]], groups: groups})
+	}
+	return out
+}
+
+// replaceHighlights highlights the matches of a query-replace as byte
+// ranges, the one being asked about as the current search match. Those
+// already replaced are left out.
+func (r *Runner) replaceHighlights(matches []replaceMatch, current int) []search.Range {
+	raw := make([]search.Range, 0, len(matches))
+	for i, m := range matches {
+		if m.replaced {
+			if i < current {
+				current--
+			}
+			continue
+		}
+		raw = append(raw, search.Range{Start: r.Buf.ByteOffset(m.start), End: r.Buf.ByteOffset(m.end)})
+	}
+	return buildSearchHighlights(raw, current)
+}
+
+// readReplaceInput reads a line for query-replace. label is re-evaluated
+// on each draw; with regexToggle Alt+R switches regex mode. Up and Down
+// recall earlier queries and replacements. validate, when
+// set, keeps the prompt open while it reports an error. It returns false
+// when cancelled.
+func (r *Runner) readReplaceInput(label func() string, input string, regexToggle bool, validate func(string) error) (string, bool) {
+	var problem error
+	recall := r.Prompts.Recall(historyReplace)
+	for {
+		lines := []string{label() + ": " + input}
+		switch {
+		case problem != nil:
+			lines = append(lines, searchErrorLine(problem))
+		case regexToggle:
+			lines = append(lines, "Alt+R regex")
+		}
+		r.setMiniBuffer(lines)
+		r.draw(nil)
+
+		ev := r.waitEvent()
+		if ev == nil {
+			return "", false
+		}
+		kev, ok := ev.(*tcell.EventKey)
+		if !ok {
+			continue
+		}
+		switch {
+		case r.isCancelKey(kev):
+			return "", false
+		case kev.Key() == tcell.KeyEnter:
+			if validate != nil && input != "" {
+				if problem = validate(input); problem != nil {
+					continue
+				}
+			}
+			r.Prompts.Add(historyReplace, input)
+			return input, true
+		case kev.Key() == tcell.KeyBackspace || kev.Key() == tcell.KeyBackspace2:
+			if rs := []rune(input); len(rs) > 0 {
+				input = string(rs[:len(rs)-1])
+			}
+			recall.Reset()
+		case regexToggle && kev.Key() == tcell.KeyRune && kev.Rune() == 'r' && kev.Modifiers() == tcell.ModAlt:
+			r.searchRegex = !r.searchRegex
+		case recallKey(recall, kev, &input, true):
+		case kev.Key() == tcell.KeyRune && kev.Modifiers() == 0:
+			input += string(kev.Rune())
+			recall.Reset()
+		default:
+			continue
+		}
+		problem = nil
+	}
+}
@@ -1,9 +1,12 @@
 package app
 
 import (
+	"errors"
 	"os"
+	"strings"
 
 	"example.com/texteditor/pkg/buffer"
+	"example.com/texteditor/pkg/clipboard"
 	"example.com/texteditor/pkg/config"
 	"example.com/texteditor/pkg/editor"
 	"example.com/texteditor/pkg/history"
@@ -37,17 +40,22 @@ const (
 type Runner struct {
 	Screen            tcell.Screen
 	FilePath          string
-	Buf               *buffer.GapBuffer
+	Buf               buffer.TextStorage
 	Cursor            int // cursor position in runes
 	CursorLine        int // 0-based current line index (maintained incrementally)
 	TopLine           int // first visible line index
 	Dirty             bool
+	Format            editor.FileFormat // on-disk line endings/BOM of FilePath
+	Encoding          editor.Encoding   // character encoding of FilePath
+	Disk              editor.DiskInfo   // version of FilePath last loaded or saved
+	SaveOptions       editor.SaveOptions
 	Ed                *editor.Editor
 	ShowHelp          bool
 	Mode              Mode
-	VisualStart       int
+	visualAnchor      *buffer.Marker // visual selection start, see visualStart
 	VisualLine        bool
 	History           *history.History
+	keyGroup          *history.History // history with an open undo group, see beginKeyGroup
 	KillRing          history.KillRing
 	Logger            *logs.Logger
 	MiniBuf           []string
@@ -83,11 +91,16 @@ type Runner struct {
 	View View
 	// File manager state (nil when inactive)
 	FileManager *fileManagerState
-	// Monotonic edit sequence; increments on any buffer mutation (insert/delete/undo/redo).
-	editSeq int64
+	// Edit sequence of the current buffer; bumped on any buffer mutation
+	// (insert/delete/undo/redo). Values come from seqClock so they are unique
+	// across buffers and survive buffer switches.
+	editSeq  int64
+	seqClock int64
+	// Cached immutable view of Buf at editSeq, shared by background workers.
+	snap    buffer.Snapshot
+	snapBuf buffer.TextStorage
 	// Last yank (paste) range for yank-pop.
-	lastYankStart int
-	lastYankEnd   int
+	lastYank      buffer.Span
 	lastYankCount int
 	lastYankValid bool
 	// True while performing yank/paste operations to avoid clearing yank state.
@@ -103,6 +116,69 @@ type Runner struct {
 	macroLastRegister   string
 	macroRepeatPending  bool
 	macroRepeatAwaitAt  bool
+	// SwapDir holds crash-recovery journals of dirty buffers; empty
+	// disables them.
+	SwapDir     string
+	swaps       map[buffer.TextStorage]*swapJournal
+	pendingSwap string // file whose swap prompt waits for the screen
+	// AutoReload reloads clean buffers when their file changes on disk
+	// instead of asking.
+	AutoReload bool
+	// stale holds the background buffers whose file changed on disk; each
+	// is checked again once it has focus.
+	stale map[buffer.TextStorage]bool
+	// UndoDir holds undo history kept across sessions; empty disables it.
+	// UndoMaxSize caps each file in bytes (0 for no limit) and files
+	// matching an UndoExclude pattern keep no history.
+	UndoDir     string
+	UndoMaxSize int
+	UndoExclude []string
+	// UndoLimits caps the memory of every buffer's undo history.
+	UndoLimits history.Limits
+	// Vim registers and marks. register is the one chosen with '"' for
+	// the next command; marks are the a-z of the focused buffer.
+	Registers       history.Registers
+	register        rune
+	registerFresh   bool
+	pendingRegister bool
+	pendingMark     rune // 'm', '\'' or '`' while waiting for the mark name
+	marks           map[rune]*buffer.Marker
+	globalMarks     map[rune]*globalMark
+	savedMarks      *editor.Marks
+	// RegistersPath and MarksPath keep registers and marks across
+	// sessions; empty disables it.
+	RegistersPath string
+	MarksPath     string
+	// KillRingPath keeps the kill ring across sessions; empty disables it.
+	KillRingPath string
+	// Prompts remembers what was entered at each prompt;
+	// PromptHistoryPath keeps it across sessions, empty disables that.
+	Prompts           history.PromptHistory
+	PromptHistoryPath string
+	// lastKill is set by a key that cut text with Ctrl+K; killAppend tells
+	// the next key so a run of kills builds one entry.
+	lastKill   bool
+	killAppend bool
+	// Clipboard backs registers '+' and '*'; nil disables them.
+	// ClipboardMirror also copies every kill and yank to it.
+	Clipboard       clipboard.Provider
+	ClipboardMirror bool
+	pendingPaste    *pendingPaste
+	// searchRegex and searchWord are the regex and whole-word toggles of
+	// the search prompt, kept between searches.
+	searchRegex bool
+	searchWord  bool
+	// lastSearch is the search n and N repeat; hlsearch keeps its matches
+	// highlighted until :nohlsearch.
+	lastSearch  *vimSearch
+	hlsearch    bool
+	searchCache searchMatchCache
+	hlsearchJob *hlsearchJob
+	// pasting is set while readPaste collects a bracketed paste, keeping
+	// its keys out of macros.
+	pasting bool
+	// grep is the last project search, whose hits F4 steps through.
+	grep *grepState
 }
 
 func (r *Runner) setMiniBuffer(lines []string) {
@@ -140,6 +216,16 @@ func (r *Runner) waitEvent() tcell.Event {
 	} else if r.Screen != nil {
 		ev = r.Screen.PollEvent()
 	}
+	// grep hits go to their buffer, and hlsearch matches to the cache,
+	// whichever loop is reading events
+	if iev, ok := ev.(*tcell.EventInterrupt); ok {
+		switch b := iev.Data().(type) {
+		case grepBatch:
+			r.applyGrepBatch(b)
+		case hlsearchResult:
+			r.applyHlsearchResult(b)
+		}
+	}
 	if kev, ok := ev.(*tcell.EventKey); ok {
 		if r.shouldRecordMacroEvent(kev) {
 			r.recordMacroEvent(kev)
@@ -158,18 +244,61 @@ func New() *Runner {
 		Buf:            bs.Buf,
 		History:        history.New(),
 		Mode:           ModeNormal,
-		VisualStart:    -1,
 		Keymap:         config.DefaultKeymap(),
 		Theme:          config.TerminalTheme(),
 		View:           ViewEditor,
 		CursorLine:     0,
 		Ed:             ed,
-		lastYankStart:  -1,
-		lastYankEnd:    -1,
 		macroRegisters: map[string][]macroEvent{},
 	}
 }
 
+// SetStorage selects the text storage backend used for files opened from now
+// on. An untouched empty initial buffer is recreated with the new backend.
+func (r *Runner) SetStorage(name string) error {
+	kind, err := buffer.ParseKind(name)
+	if err != nil {
+		return err
+	}
+	if r.Ed == nil {
+		r.Ed = editor.New()
+	}
+	r.Ed.Storage = kind
+	if r.FilePath == "" && !r.Dirty && (r.Buf == nil || r.Buf.Len() == 0) {
+		r.Buf = buffer.New(kind)
+		r.Cursor = 0
+		r.saveBufferState()
+	}
+	return nil
+}
+
+// SetBackup configures the backup Save keeps of the previous file contents.
+// mode is "none", "simple" or "numbered"; dir optionally collects backups in
+// one directory.
+func (r *Runner) SetBackup(mode, dir string) error {
+	m, err := editor.ParseBackupMode(mode)
+	if err != nil {
+		return err
+	}
+	r.SaveOptions = editor.SaveOptions{Backup: m, BackupDir: dir}
+	return nil
+}
+
+// snapshot returns an immutable view of the current buffer versioned by
+// editSeq. The view is reused until the next edit or buffer switch, so the
+// syntax, spell and search workers can share it without copying the text.
+func (r *Runner) snapshot() buffer.Snapshot {
+	if r.Buf == nil {
+		return nil
+	}
+	if r.snap != nil && r.snapBuf == r.Buf && r.snap.Version() == r.editSeq {
+		return r.snap
+	}
+	r.snap = r.Buf.Snapshot(r.editSeq)
+	r.snapBuf = r.Buf
+	return r.snap
+}
+
 // cursorLine returns the current 0-based line index of the cursor.
 func (r *Runner) cursorLine() int {
 	if r.Buf == nil {
@@ -208,11 +337,37 @@ func (r *Runner) ensureCursorVisible() {
 	}
 }
 
+// replaceContents swaps in a new buffer holding text, as after reloading the
+// file. Undo history does not carry over; the cursor is clamped to the new
+// text. Callers update Dirty, Format and the editor's copy of the state.
+func (r *Runner) replaceContents(text string) {
+	kind := buffer.KindGapBuffer
+	if r.Ed != nil {
+		kind = r.Ed.Storage
+	}
+	anchor := r.visualStart()
+	old := r.Buf
+	r.Buf = buffer.NewFromString(kind, text)
+	r.closeKeyGroup()
+	r.History = r.newHistory()
+	r.bumpEditSeq()
+	r.syntaxSrc = ""
+	if r.Cursor > r.Buf.Len() {
+		r.Cursor = r.Buf.Len()
+	}
+	if anchor >= 0 {
+		// markers stay with the old buffer
+		r.setVisualStart(min(anchor, r.Buf.Len()))
+	}
+	r.moveMarks(old)
+	r.recomputeCursorLine()
+}
+
 func (r *Runner) saveBufferState() {
 	if r.Ed == nil {
 		return
 	}
-	r.Ed.UpdateCurrent(editor.BufferState{FilePath: r.FilePath, Buf: r.Buf, Cursor: r.Cursor, Dirty: r.Dirty})
+	r.Ed.UpdateCurrent(r.bufferState())
 }
 
 // LoadFile loads a file into the runner's buffer.
@@ -225,7 +380,7 @@ func (r *Runner) LoadFile(path string) error {
 	}
 	if r.Ed == nil {
 		r.Ed = editor.New()
-		r.Ed.AddBuffer(editor.BufferState{FilePath: r.FilePath, Buf: r.Buf, Cursor: r.Cursor, Dirty: r.Dirty})
+		r.Ed.AddBuffer(r.bufferState())
 	}
 	r.saveBufferState()
 	bs, err := r.Ed.LoadFile(path)
@@ -235,25 +390,20 @@ func (r *Runner) LoadFile(path string) error {
 		}
 		return err
 	}
-	r.FilePath = bs.FilePath
-	r.Buf = bs.Buf
-	r.Cursor = bs.Cursor
-	r.Dirty = bs.Dirty
+	r.applyBufferState(bs)
 	r.syntaxSrc = ""
-	// Initialize CursorLine from cached lines
+	// Initialize CursorLine from the line index
 	if r.Buf != nil {
-		lines := r.Buf.Lines()
-		if len(lines) > 0 {
-			r.CursorLine = len(lines) - 1
-		} else {
-			r.CursorLine = 0
-		}
+		r.CursorLine = r.Buf.LineOf(r.Cursor)
 	} else {
 		r.CursorLine = 0
 	}
 	if r.Logger != nil {
-		r.Logger.Event("open.success", map[string]any{"file": path, "runes": r.Buf.Len(), "bytes": len([]byte(r.Buf.String()))})
+		r.Logger.Event("open.success", map[string]any{"file": path, "runes": r.Buf.Len(), "bytes": r.Buf.ByteOffset(r.Buf.Len())})
 	}
+	r.readUndoFile()
+	r.restoreMarks()
+	r.checkSwap(path)
 	return nil
 }
 
@@ -262,12 +412,33 @@ func (r *Runner) Save() error {
 	if r.FilePath == "" {
 		return os.ErrInvalid
 	}
-	data := []byte(r.Buf.String())
-	if err := os.WriteFile(r.FilePath, data, 0644); err != nil {
+	if r.Disk.Known() {
+		changed, _, err := r.Disk.CheckDisk(r.FilePath)
+		if err != nil {
+			return err
+		}
+		if changed && !r.confirmOverwriteChanged() {
+			return editor.ErrChangedOnDisk
+		}
+	}
+	text := r.Buf.String()
+	data, err := editor.EncodeFile(text, r.Format, r.Encoding)
+	var lossy *editor.UnencodableError
+	if errors.As(err, &lossy) && r.confirmLossySave(lossy) {
+		data, err = editor.EncodeFileLossy(text, r.Format, r.Encoding)
+	}
+	if err != nil {
+		return err
+	}
+	if err := editor.WriteFile(r.FilePath, data, r.SaveOptions); err != nil {
 		return err
 	}
+	r.Disk = editor.DiskInfoFor(r.FilePath, data)
+	r.Format.FinalNewline = text == "" || strings.HasSuffix(text, "\n")
 	r.Dirty = false
 	r.saveBufferState()
+	r.dropSwap(r.Buf)
+	r.writeUndoFile(r.bufferState())
 	return nil
 }
 
@@ -283,6 +454,7 @@ func (r *Runner) InitScreen() error {
 	if err := s.Init(); err != nil {
 		return err
 	}
+	s.EnablePaste()
 	s.SetStyle(tcell.StyleDefault)
 	s.Clear()
 	r.Screen = s
@@ -300,33 +472,14 @@ func (r *Runner) Fini() {
 	}
 }
 
-// recomputeCursorLine recalculates CursorLine from Cursor and buffer contents.
-// It uses the cached line slice for efficiency and should be called sparingly
-// when Cursor is set directly without incremental updates.
+// recomputeCursorLine recalculates CursorLine from Cursor using the buffer's
+// line index. Call it when Cursor is set directly without incremental updates.
 func (r *Runner) recomputeCursorLine() {
 	if r.Buf == nil {
 		r.CursorLine = 0
 		return
 	}
-	lines := r.Buf.Lines()
-	idx := 0
-	runesSoFar := 0
-	for idx < len(lines) {
-		lineRunes := len([]rune(lines[idx]))
-		if r.Cursor <= runesSoFar+lineRunes { // cursor within this line
-			r.CursorLine = idx
-			return
-		}
-		// account for newline rune between lines
-		runesSoFar += lineRunes + 1
-		idx++
-	}
-	// if beyond last line, clamp to last
-	if len(lines) > 0 {
-		r.CursorLine = len(lines) - 1
-	} else {
-		r.CursorLine = 0
-	}
+	r.CursorLine = r.Buf.LineOf(r.Cursor)
 }
 
 // Run starts the event loop. It will initialize the screen if needed and
@@ -338,6 +491,13 @@ func (r *Runner) Run() error {
 		}
 		defer r.Fini()
 	}
+	// flush unsaved work before the deferred Fini restores the terminal
+	defer func() {
+		if p := recover(); p != nil {
+			r.emergencySwapFlush()
+			panic(p)
+		}
+	}()
 
 	// Initialize logger from env (no-op if disabled)
 	if r.Logger == nil {
@@ -363,15 +523,29 @@ func (r *Runner) Run() error {
 		}
 	}()
 
-	// renderer goroutine consumes snapshots and draws them
+	// renderer goroutine consumes snapshots and draws them; it is done
+	// before Run returns, so the caller may close the screen
+	renderCh, rendered := r.RenderCh, make(chan struct{})
 	go func() {
-		for st := range r.RenderCh {
+		defer close(rendered)
+		for st := range renderCh {
 			renderToScreen(r.Screen, st)
 		}
 	}()
+	defer func() {
+		r.RenderCh = nil
+		close(renderCh)
+		<-rendered
+	}()
+
+	defer r.startTicker()()
 
 	// initial draw
 	r.draw(nil)
+	if path := r.pendingSwap; path != "" {
+		r.pendingSwap = ""
+		r.checkSwap(path)
+	}
 
 	for {
 		ev := r.waitEvent()
@@ -397,11 +571,30 @@ func (r *Runner) Run() error {
 				if r.Logger != nil {
 					r.Logger.Event("action", map[string]any{"name": "quit"})
 				}
+				r.removeSwaps()
+				r.writeUndoFiles()
+				r.writeState()
 				return nil
 			}
+		case *tcell.EventClipboard:
+			r.onClipboard(ev.Data())
+		case *tcell.EventPaste:
+			if ev.Start() {
+				r.readPaste()
+			}
+		case *pasteEvent:
+			r.insertPasted(ev.text)
+		case *tcell.EventInterrupt:
+			switch ev.Data().(type) {
+			case tick:
+				r.onTick()
+			case grepBatch, hlsearchResult:
+				r.draw(nil)
+			}
 		case *tcell.EventResize:
 			r.Screen.Sync()
 			r.draw(nil)
 		}
+		r.checkStaleFocus()
 	}
 }
@@ -11,13 +11,16 @@ import (
 
 // renderState captures a snapshot of editor state for the renderer goroutine.
 type renderState struct {
-	lines       []string
+	lines       []string // visible lines only, starting at topLine
+	startByte   int      // byte offset of the first visible line
+	startRune   int      // rune offset of the first visible line
 	filePath    string
 	cursor      int
 	dirty       bool
 	mode        Mode
 	overlay     Overlay
 	macroStatus string
+	fileInfo    string
 	topLine     int
 	miniBuf     []string
 	highlights  []search.Range
@@ -68,6 +71,7 @@ func drawHelp(s tcell.Screen, th config.Theme) {
 		"- Ctrl+W: Search",
 		"- Ctrl+L: Multi-edit",
 		"- Alt+G: Go to line",
+		"- F4 / Shift+F4: Next / previous grep hit",
 		"- Ctrl+K: Cut to end of line",
 		"- Ctrl+U/Ctrl+Y: Paste",
 		"- Ctrl+Z / Ctrl+Y: Undo / Redo",
@@ -107,7 +111,12 @@ func (r *Runner) showDialogLines(lines []string) {
 	r.draw(nil)
 	// Wait for a single event before dismissing the dialog.
 	if r.EventCh != nil {
-		<-r.EventCh
+		// ignore timer interrupts and other non-key events
+		for ev := range r.EventCh {
+			if _, ok := ev.(*tcell.EventKey); ok {
+				break
+			}
+		}
 	} else {
 		s := r.Screen
 		for {
@@ -122,12 +131,36 @@ func (r *Runner) showDialogLines(lines []string) {
 	r.draw(nil)
 }
 
-func drawBuffer(s tcell.Screen, buf *buffer.GapBuffer, fname string, highlights []search.Range, cursor int, dirty bool, mode Mode, overlay Overlay, topLine int, minibuf []string, th config.Theme, macroStatus string) {
-	if buf == nil {
-		drawFile(s, fname, []string{}, highlights, cursor, dirty, mode, overlay, topLine, minibuf, th, macroStatus)
-		return
+func drawBuffer(s tcell.Screen, buf buffer.TextStorage, fname string, highlights []search.Range, cursor int, dirty bool, mode Mode, overlay Overlay, topLine int, minibuf []string, th config.Theme, macroStatus string) {
+	_, height := s.Size()
+	lines, startByte, startRune := visibleLines(buf, topLine, height-1-len(minibuf))
+	drawLines(s, fname, lines, startByte, startRune, highlights, cursor, dirty, mode, overlay, minibuf, th, macroStatus, "")
+}
+
+// visibleLines returns up to count lines starting at topLine together with
+// the byte and rune offsets of the first one, using the storage's line index
+// so only the viewport is materialized.
+func visibleLines(buf buffer.Reader, topLine, count int) (lines []string, startByte, startRune int) {
+	if buf == nil || count <= 0 {
+		return nil, 0, 0
+	}
+	total := buf.LineCount()
+	if topLine < 0 {
+		topLine = 0
+	}
+	if topLine >= total {
+		return nil, buf.ByteOffset(buf.Len()), buf.Len()
+	}
+	startRune = buf.LineStart(topLine)
+	startByte = buf.ByteOffset(startRune)
+	for i := topLine; i < total && len(lines) < count; i++ {
+		start, end := buf.LineAt(i)
+		if end > start && buf.RuneAt(end-1) == '\n' {
+			end--
+		}
+		lines = append(lines, string(buf.Slice(start, end)))
 	}
-	drawFile(s, fname, buf.Lines(), highlights, cursor, dirty, mode, overlay, topLine, minibuf, th, macroStatus)
+	return lines, startByte, startRune
 }
 
 // renderSnapshot captures the current runner state into a renderState.
@@ -154,22 +187,35 @@ func (r *Runner) renderSnapshot(highlights []search.Range) renderState {
 	hs := append([]search.Range(nil), highlights...)
 	macroStatus := r.MacroStatus
 	var lines []string
+	startByte, startRune := 0, 0
 	bufLen := 0
 	if r.Buf != nil {
-		lines = r.Buf.Lines()
+		maxLines := r.Buf.LineCount()
+		if r.Screen != nil {
+			_, height := r.Screen.Size()
+			maxLines = height - 1 - len(mini)
+		}
+		lines, startByte, startRune = visibleLines(r.Buf, r.TopLine, maxLines)
 		bufLen = r.Buf.Len()
+		// below the other highlights so a selection still shows over them
+		if hl := r.hlsearchHighlights(lines, startByte); len(hl) > 0 {
+			hs = append(hl, hs...)
+		}
 	}
 	if r.View == ViewFileManager && r.Buf == nil {
 		bufLen = 1
 	}
 	return renderState{
 		lines:       lines,
-		filePath:    r.FilePath,
+		startByte:   startByte,
+		startRune:   startRune,
+		filePath:    r.bufferName(),
 		cursor:      r.Cursor,
 		dirty:       r.Dirty,
 		mode:        r.Mode,
 		overlay:     r.Overlay,
 		macroStatus: macroStatus,
+		fileInfo:    r.statusInfo(),
 		topLine:     r.TopLine,
 		miniBuf:     mini,
 		highlights:  hs,
@@ -187,7 +233,7 @@ func renderToScreen(s tcell.Screen, st renderState) {
 		return
 	}
 	if st.bufLen > 0 || st.view == ViewFileManager {
-		drawFile(s, st.filePath, st.lines, st.highlights, st.cursor, st.dirty, st.mode, st.overlay, st.topLine, st.miniBuf, st.theme, st.macroStatus)
+		drawLines(s, st.filePath, st.lines, st.startByte, st.startRune, st.highlights, st.cursor, st.dirty, st.mode, st.overlay, st.miniBuf, st.theme, st.macroStatus, st.fileInfo)
 		return
 	}
 	drawUI(s, st.theme, st.macroStatus)
@@ -217,6 +263,24 @@ func (r *Runner) draw(highlights []search.Range) {
 }
 
 func drawFile(s tcell.Screen, fname string, lines []string, highlights []search.Range, cursor int, dirty bool, mode Mode, overlay Overlay, topLine int, minibuf []string, th config.Theme, macroStatus string) {
+	lineStart := 0     // byte offset of start of first visible line
+	lineStartRune := 0 // rune offset of start of first visible line
+	for i := 0; i < topLine && i < len(lines); i++ {
+		lineStart += len([]byte(lines[i])) + 1
+		lineStartRune += len([]rune(lines[i])) + 1
+	}
+	var visible []string
+	if topLine >= 0 && topLine < len(lines) {
+		visible = lines[topLine:]
+	}
+	drawLines(s, fname, visible, lineStart, lineStartRune, highlights, cursor, dirty, mode, overlay, minibuf, th, macroStatus, "")
+}
+
+// drawLines renders lines as the top of the viewport. lineStart and
+// lineStartRune are the byte and rune offsets of lines[0] within the buffer,
+// which lets highlights and the cursor be placed without the lines above.
+// fileInfo, when set, is shown in the status line (e.g. "CRLF BOM").
+func drawLines(s tcell.Screen, fname string, lines []string, lineStart, lineStartRune int, highlights []search.Range, cursor int, dirty bool, mode Mode, overlay Overlay, minibuf []string, th config.Theme, macroStatus string, fileInfo string) {
 	width, height := s.Size()
 	s.Clear()
 	// set default UI style
@@ -227,12 +291,6 @@ func drawFile(s tcell.Screen, fname string, lines []string, highlights []search.
 	if maxLines < 0 {
 		maxLines = 0
 	}
-	lineStart := 0     // byte offset of start of current line
-	lineStartRune := 0 // rune offset of start of current line
-	for i := 0; i < topLine && i < len(lines); i++ {
-		lineStart += len([]byte(lines[i])) + 1
-		lineStartRune += len([]rune(lines[i])) + 1
-	}
 	cursorColor := th.CursorNormalBG
 	switch mode {
 	case ModeInsert, ModeMultiEdit:
@@ -245,8 +303,8 @@ func drawFile(s tcell.Screen, fname string, lines []string, highlights []search.
 	cursorStyle := tcell.StyleDefault.Foreground(th.CursorText).Background(cursorColor).Attributes(tcell.AttrBlink)
 	// syntax colors from theme (fallbacks handled below)
 
-	for i := 0; i < maxLines && topLine+i < len(lines); i++ {
-		line := lines[topLine+i]
+	for i := 0; i < maxLines && i < len(lines); i++ {
+		line := lines[i]
 		runes := []rune(line)
 		// compute highlights for this line:
 		// - bgHL marks background highlights (search/selection)
@@ -443,6 +501,9 @@ func drawFile(s tcell.Screen, fname string, lines []string, highlights []search.
 		}
 	}
 	status := modeTag + "  " + display + " — Press Ctrl+Q to exit"
+	if fileInfo != "" {
+		status += " | " + fileInfo
+	}
 	status = appendMacroStatus(status, macroStatus)
 	status = truncateStatusForIndicator(status, width, macroStatus)
 	// Colorize mode indicators: <N>, <V>, <I> match cursor; <M>=orange; <S>=red
@@ -166,3 +166,32 @@ func TestDrawFile_Viewport(t *testing.T) {
 		t.Fatalf("expected '3' at (1,1) got %q", string(cr))
 	}
 }
+
+// TestDrawBuffer_ViewportOffsets ensures lines below the top are placed using
+// the storage line index, keeping the cursor and byte-offset highlights aligned.
+func TestDrawBuffer_ViewportOffsets(t *testing.T) {
+	s := tcell.NewSimulationScreen("UTF-8")
+	if err := s.Init(); err != nil {
+		t.Fatalf("initializing simulation screen failed: %v", err)
+	}
+	defer s.Fini()
+
+	buf := buffer.NewPieceTableFromString("héllo\nwörld\nthird\n")
+	// highlight "third" (bytes 14..19) and place the cursor on its 'h'
+	ranges := []search.Range{{Start: 14, End: 19, Group: "bg.search"}}
+	drawBuffer(s, buf, "f.txt", ranges, 13, false, ModeNormal, OverlayNone, 2, nil, config.DefaultTheme(), "")
+
+	cr, _, _, _ := s.GetContent(0, 0)
+	if cr != 't' {
+		t.Fatalf("expected 't' at (0,0) got %q", string(cr))
+	}
+	th := config.DefaultTheme()
+	_, _, style, _ := s.GetContent(2, 0)
+	if _, bg, _ := style.Decompose(); bg != th.HighlightSearchBG {
+		t.Fatalf("expected search highlight at (2,0)")
+	}
+	_, _, style, _ = s.GetContent(1, 0)
+	if _, bg, _ := style.Decompose(); bg != th.CursorNormalBG {
+		t.Fatalf("expected cursor at (1,0)")
+	}
+}
@@ -16,9 +16,36 @@ type insertCapture struct {
 	text    []rune
 }
 
-// visualHighlightRange returns the current visual selection as byte offsets.
+// visualStart returns where the visual selection started, or -1 when there
+// is none. The anchor is a marker, so it stays on its character while text
+// is edited before it.
+func (r *Runner) visualStart() int {
+	if r.Buf == nil || !r.visualAnchor.Attached(r.Buf.Markers()) {
+		return -1
+	}
+	return r.visualAnchor.Pos()
+}
+
+// setVisualStart anchors the visual selection at pos; a negative pos clears
+// it. An anchor in another buffer is left to that buffer's state.
+func (r *Runner) setVisualStart(pos int) {
+	attached := r.Buf != nil && r.visualAnchor.Attached(r.Buf.Markers())
+	switch {
+	case pos >= 0 && attached:
+		r.visualAnchor.SetPos(pos)
+		return
+	case attached:
+		r.visualAnchor.Remove()
+	}
+	r.visualAnchor = nil
+	if pos >= 0 && r.Buf != nil {
+		r.visualAnchor = r.Buf.Markers().Add(pos, buffer.RightGravity)
+	}
+}
+
+// visualSelectionBounds returns the current visual selection as rune offsets.
 func (r *Runner) visualSelectionBounds() (start, end int) {
-	start = r.VisualStart
+	start = r.visualStart()
 	end = r.Cursor
 	if start > end {
 		start, end = end, start
@@ -43,31 +70,40 @@ func (r *Runner) visualSelectionBounds() (start, end int) {
 }
 
 func (r *Runner) visualHighlightRange() []search.Range {
-	if r.Mode != ModeVisual || r.VisualStart < 0 || r.Buf == nil {
+	if r.Mode != ModeVisual || r.visualStart() < 0 || r.Buf == nil {
 		return nil
 	}
 	start, end := r.visualSelectionBounds()
-	text := r.Buf.String()
-	runes := []rune(text)
-	if start < 0 {
-		start = 0
-	}
-	if end > len(runes) {
-		end = len(runes)
-	}
-	startBytes := len(string(runes[:start]))
-	endBytes := len(string(runes[:end]))
+	startBytes := r.Buf.ByteOffset(start)
+	endBytes := r.Buf.ByteOffset(end)
 	// Tag as visual selection so renderer can style it subtly
 	return []search.Range{{Start: startBytes, End: endBytes, Group: "bg.select"}}
 }
 
 func (r *Runner) clearYankState() {
 	r.lastYankValid = false
-	r.lastYankStart = -1
-	r.lastYankEnd = -1
+	r.dropLastYank()
 	r.lastYankCount = 0
 }
 
+// setLastYank marks [start,end) as the text the last yank inserted, so
+// yank-pop still finds it after edits elsewhere in the buffer.
+func (r *Runner) setLastYank(start, end int) {
+	r.dropLastYank()
+	if r.Buf != nil && start >= 0 && end >= start {
+		r.lastYank = r.Buf.Markers().AddSpan(start, end, true)
+	}
+}
+
+// dropLastYank forgets the yank range. A range left in another buffer is
+// only forgotten here; that buffer's state still holds it.
+func (r *Runner) dropLastYank() {
+	if r.Buf != nil && r.lastYank.Start.Attached(r.Buf.Markers()) {
+		r.lastYank.Remove()
+	}
+	r.lastYank = buffer.Span{}
+}
+
 func (r *Runner) beginYankTracking() int {
 	r.yankInProgress = true
 	return r.Cursor
@@ -78,10 +114,9 @@ func (r *Runner) endYankTracking(start int, count int) {
 	if count < 1 {
 		count = 1
 	}
-	r.lastYankStart = start
-	r.lastYankEnd = r.Cursor
+	r.setLastYank(start, r.Cursor)
 	r.lastYankCount = count
-	r.lastYankValid = start >= 0 && r.lastYankEnd >= start
+	r.lastYankValid = start >= 0 && r.Cursor >= start
 }
 
 // insertText inserts text at the current cursor, records history, and updates state.
@@ -108,7 +143,7 @@ func (r *Runner) insertText(text string) {
 	r.Dirty = true
 	r.syntaxSrc = ""
 	// Mark buffer content changed for spell re-check coalescing
-	r.editSeq++
+	r.bumpEditSeq()
 	r.handleMultiEditInsert(text, pos)
 }
 
@@ -186,7 +221,7 @@ func (r *Runner) deleteLines(count int) {
 	}
 	text := string(r.Buf.Slice(start, end))
 	_ = r.deleteRange(start, end, text)
-	r.KillRing.Push(text)
+	r.storeDelete(text)
 	r.recomputeCursorLine()
 	if r.Logger != nil {
 		r.Logger.Event("action", map[string]any{"name": "delete.line", "text": text, "count": count, "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
@@ -211,7 +246,7 @@ func (r *Runner) deleteChars(count int) {
 	}
 	text := string(r.Buf.Slice(start, end))
 	_ = r.deleteRange(start, end, text)
-	r.KillRing.Push(text)
+	r.storeDelete(text)
 	if r.Logger != nil {
 		r.Logger.Event("action", map[string]any{"name": "cut.normal", "text": text, "count": count, "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
 	}
@@ -235,7 +270,7 @@ func (r *Runner) deleteWords(count int) string {
 	}
 	text := string(r.Buf.Slice(start, end))
 	_ = r.deleteRange(start, end, text)
-	r.KillRing.Push(text)
+	r.storeDelete(text)
 	r.recomputeCursorLine()
 	if r.Logger != nil {
 		r.Logger.Event("action", map[string]any{"name": "delete.word", "text": text, "count": count, "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
@@ -251,10 +286,12 @@ func (r *Runner) changeWords(count int, replacement string) {
 	if count < 1 {
 		count = 1
 	}
+	r.beginEdit()
 	deleted := r.deleteWords(count)
 	if replacement != "" {
 		r.insertText(replacement)
 	}
+	r.endEdit()
 	if r.Logger != nil {
 		r.Logger.Event("action", map[string]any{"name": "change.word", "deleted": deleted, "inserted": replacement, "count": count, "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
 	}
@@ -275,7 +312,7 @@ func (r *Runner) yankTextObject(delim rune, around bool, count int) {
 			return
 		}
 		text := string(r.Buf.Slice(start, end))
-		r.KillRing.Push(text)
+		r.storeYank(text)
 		if r.Logger != nil {
 			r.Logger.Event("action", map[string]any{"name": "yank.textobject", "text": text, "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
 		}
@@ -293,7 +330,7 @@ func (r *Runner) deleteTextObject(delim rune, around bool, count int) {
 		}
 		text := string(r.Buf.Slice(start, end))
 		_ = r.deleteRange(start, end, text)
-		r.KillRing.Push(text)
+		r.storeDelete(text)
 		r.recomputeCursorLine()
 		if r.Logger != nil {
 			r.Logger.Event("action", map[string]any{"name": "delete.textobject", "text": text, "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
@@ -373,7 +410,7 @@ func (r *Runner) deleteRange(start, end int, text string) error {
 	r.Dirty = true
 	r.syntaxSrc = ""
 	// Mark buffer content changed for spell re-check coalescing
-	r.editSeq++
+	r.bumpEditSeq()
 	r.handleMultiEditDelete(start, end, text)
 	return nil
 }
@@ -416,12 +453,9 @@ func (r *Runner) moveCursorVertical(delta int) {
 		col = lineLen
 	}
 	r.Cursor = pos + col
-	// Update line index conservatively using cached line count
+	// Update line index conservatively using the buffer's line count
 	if r.Buf != nil {
-		total := len(r.Buf.Lines())
-		if total < 1 {
-			total = 1
-		}
+		total := r.Buf.LineCount()
 		r.CursorLine += delta
 		if r.CursorLine < 0 {
 			r.CursorLine = 0
@@ -494,18 +528,20 @@ func (r *Runner) replaceRange(start, end int, replacement string) {
 		_ = r.Buf.Insert(start, []rune(replacement))
 	}
 	if r.History != nil {
+		r.beginEdit()
 		if deleted != "" {
 			r.History.RecordDelete(start, deleted)
 		}
 		if replacement != "" {
 			r.History.RecordInsert(start, replacement)
 		}
+		r.endEdit()
 	}
 	r.Cursor = cursor
 	r.CursorLine = cursorLine
 	r.Dirty = true
 	r.syntaxSrc = ""
-	r.editSeq++
+	r.bumpEditSeq()
 }
 
 func countNewlines(s string) int {
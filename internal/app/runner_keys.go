@@ -8,14 +8,34 @@ import (
 )
 
 // handleKeyEvent processes a key event. It returns true if the event signals
-// the runner should quit.
+// the runner should quit. The edits a key makes form one undo group; see
+// beginKeyGroup.
 func (r *Runner) handleKeyEvent(ev *tcell.EventKey) bool {
+	r.beginKeyGroup()
+	r.killAppend, r.lastKill = r.lastKill, false
+	r.pendingPaste = nil
+	quit := r.handleKey(ev)
+	r.expireRegister()
+	r.endKeyGroup()
+	return quit
+}
+
+func (r *Runner) handleKey(ev *tcell.EventKey) bool {
 	if r.View == ViewFileManager {
 		return r.handleFileManagerKey(ev)
 	}
+	if r.handleRegisterKeys(ev) {
+		return false
+	}
+	if r.handleSearchKeys(ev) {
+		return false
+	}
+	if r.handleGrepKeys(ev) {
+		return false
+	}
 	switch r.Mode {
 	case ModeNormal:
-		if r.PendingG && !(ev.Key() == tcell.KeyRune && ev.Rune() == 'g' && ev.Modifiers() == 0) {
+		if r.PendingG && !(ev.Key() == tcell.KeyRune && (ev.Rune() == 'g' || ev.Rune() == '-' || ev.Rune() == '+') && ev.Modifiers() == 0) {
 			r.PendingG = false
 		}
 		if r.PendingTextObject {
@@ -139,7 +159,7 @@ func (r *Runner) handleKeyEvent(ev *tcell.EventKey) bool {
 			return false
 		case ModeVisual:
 			r.Mode = ModeNormal
-			r.VisualStart = -1
+			r.setVisualStart(-1)
 			r.VisualLine = false
 			r.PendingG = false
 			r.PendingY = false
@@ -234,10 +254,25 @@ func (r *Runner) handleKeyEvent(ev *tcell.EventKey) bool {
 				r.performUndo("undo.normal")
 			}
 			return false
+		case '-', '+':
+			// g- / g+ step through undo states in creation order
+			if r.PendingG {
+				r.PendingG = false
+				count := r.consumeCount()
+				if ev.Rune() == '-' {
+					count = -count
+				}
+				r.stepHistory(count)
+			}
+			return false
+		case ':':
+			_ = r.consumeCount()
+			r.runExPrompt()
+			return false
 		case 'v':
 			_ = r.consumeCount()
 			r.Mode = ModeVisual
-			r.VisualStart = r.Cursor
+			r.setVisualStart(r.Cursor)
 			r.VisualLine = false
 			r.draw(nil)
 			return false
@@ -246,54 +281,19 @@ func (r *Runner) handleKeyEvent(ev *tcell.EventKey) bool {
 			if r.Buf != nil {
 				start, _ := r.currentLineBounds()
 				r.Cursor = start
-				r.VisualStart = start
+				r.setVisualStart(start)
 			} else {
-				r.VisualStart = r.Cursor
+				r.setVisualStart(r.Cursor)
 			}
 			r.Mode = ModeVisual
 			r.VisualLine = true
 			r.draw(nil)
 			return false
 		case 'p':
-			count := r.consumeCount()
-			if r.KillRing.HasData() {
-				text := r.KillRing.Get()
-				if r.Buf != nil && r.Cursor < r.Buf.Len() {
-					// paste after the cursor position
-					if r.Buf.RuneAt(r.Cursor) == '\n' {
-						r.CursorLine++
-					}
-					r.Cursor++
-				}
-				start := r.beginYankTracking()
-				for i := 0; i < count; i++ {
-					r.insertText(text)
-				}
-				r.endYankTracking(start, count)
-				if r.Logger != nil {
-					r.Logger.Event("action", map[string]any{"name": "paste.normal", "text": text, "count": count, "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
-				}
-				if r.Screen != nil {
-					r.draw(nil)
-				}
-			}
+			r.paste(false, r.consumeCount())
 			return false
 		case 'P':
-			count := r.consumeCount()
-			if r.KillRing.HasData() {
-				text := r.KillRing.Get()
-				start := r.beginYankTracking()
-				for i := 0; i < count; i++ {
-					r.insertText(text)
-				}
-				r.endYankTracking(start, count)
-				if r.Logger != nil {
-					r.Logger.Event("action", map[string]any{"name": "paste.before", "text": text, "count": count, "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
-				}
-				if r.Screen != nil {
-					r.draw(nil)
-				}
-			}
+			r.paste(true, r.consumeCount())
 			return false
 		case 'o':
 			count := r.consumeCount()
@@ -373,7 +373,7 @@ func (r *Runner) handleKeyEvent(ev *tcell.EventKey) bool {
 					}
 					text := string(r.Buf.Slice(start, end))
 					r.clearYankState()
-					r.KillRing.Push(text)
+					r.storeYank(text)
 					if r.Logger != nil {
 						r.Logger.Event("action", map[string]any{"name": "yank.line", "text": text, "count": count, "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
 					}
@@ -396,7 +396,7 @@ func (r *Runner) handleKeyEvent(ev *tcell.EventKey) bool {
 				}
 				text := string(r.Buf.Slice(start, end))
 				r.clearYankState()
-				r.KillRing.Push(text)
+				r.storeYank(text)
 				if r.Logger != nil {
 					r.Logger.Event("action", map[string]any{"name": "yank.line", "text": text, "count": count, "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
 				}
@@ -413,27 +413,18 @@ func (r *Runner) handleKeyEvent(ev *tcell.EventKey) bool {
 			count := r.consumeCount()
 			if r.Buf != nil && r.Buf.Len() > 0 {
 				if hasCount {
-					lines := r.Buf.Lines()
 					line := count - 1
 					if line < 0 {
 						line = 0
 					}
-					if len(lines) == 0 {
-						line = 0
-					} else if line > len(lines)-1 {
-						line = len(lines) - 1
+					if last := r.Buf.LineCount() - 1; line > last {
+						line = last
 					}
-					start, _ := r.Buf.LineAt(line)
-					r.Cursor = start
+					r.Cursor = r.Buf.LineStart(line)
 					r.CursorLine = line
 				} else {
 					r.Cursor = r.Buf.Len() - 1
-					lines := r.Buf.Lines()
-					last := len(lines) - 1
-					if last > 0 && len(lines[last]) == 0 {
-						last--
-					}
-					r.CursorLine = last
+					r.CursorLine = r.Buf.LineOf(r.Cursor)
 				}
 			}
 			if r.Screen != nil {
@@ -549,14 +540,10 @@ func (r *Runner) handleKeyEvent(ev *tcell.EventKey) bool {
 						if line < 0 {
 							line = 0
 						}
-						lines := r.Buf.Lines()
-						if len(lines) == 0 {
-							line = 0
-						} else if line > len(lines)-1 {
-							line = len(lines) - 1
+						if last := r.Buf.LineCount() - 1; line > last {
+							line = last
 						}
-						start, _ := r.Buf.LineAt(line)
-						r.Cursor = start
+						r.Cursor = r.Buf.LineStart(line)
 						r.CursorLine = line
 					} else {
 						r.Cursor = 0
@@ -602,7 +589,7 @@ func (r *Runner) handleKeyEvent(ev *tcell.EventKey) bool {
 	}
 	if r.Mode == ModeVisual && ev.Key() == tcell.KeyRune && ev.Rune() == 'v' && ev.Modifiers() == 0 {
 		r.Mode = ModeNormal
-		r.VisualStart = -1
+		r.setVisualStart(-1)
 		r.VisualLine = false
 		r.PendingG = false
 		r.PendingTextObject = false
@@ -618,7 +605,9 @@ func (r *Runner) handleKeyEvent(ev *tcell.EventKey) bool {
 		return true
 	}
 	if r.matchCommand(ev, "save") {
-		if r.FilePath == "" {
+		if r.isGrepBuffer() {
+			r.applyGrepEdits()
+		} else if r.FilePath == "" {
 			r.runSaveAsPrompt()
 		} else {
 			if err := r.Save(); err == nil {
@@ -669,7 +658,7 @@ func (r *Runner) handleKeyEvent(ev *tcell.EventKey) bool {
 	if ev.Key() == tcell.KeyPgUp && ev.Modifiers() == tcell.ModCtrl {
 		r.saveBufferState()
 		bs := r.Ed.Prev()
-		r.FilePath, r.Buf, r.Cursor, r.Dirty = bs.FilePath, bs.Buf, bs.Cursor, bs.Dirty
+		r.applyBufferState(bs)
 		r.recomputeCursorLine()
 		if r.Screen != nil {
 			r.draw(nil)
@@ -679,7 +668,7 @@ func (r *Runner) handleKeyEvent(ev *tcell.EventKey) bool {
 	if ev.Key() == tcell.KeyPgDn && ev.Modifiers() == tcell.ModCtrl {
 		r.saveBufferState()
 		bs := r.Ed.Next()
-		r.FilePath, r.Buf, r.Cursor, r.Dirty = bs.FilePath, bs.Buf, bs.Cursor, bs.Dirty
+		r.applyBufferState(bs)
 		r.recomputeCursorLine()
 		if r.Screen != nil {
 			r.draw(nil)
@@ -726,6 +715,11 @@ func (r *Runner) handleKeyEvent(ev *tcell.EventKey) bool {
 		}
 		return false
 	}
+	// Alt+% -> query-replace, limited to the selection in visual mode
+	if ev.Key() == tcell.KeyRune && ev.Rune() == '%' && ev.Modifiers() == tcell.ModAlt {
+		r.runQueryReplace()
+		return false
+	}
 	// Show help on F1 or Ctrl+H (support dedicated control key)
 	if ev.Key() == tcell.KeyF1 || (ev.Key() == tcell.KeyRune && ev.Rune() == 'h' && ev.Modifiers() == tcell.ModCtrl) || (ev.Key() == tcell.KeyCtrlH && !r.isInsertMode()) {
 		r.ShowHelp = true
@@ -801,7 +795,7 @@ func (r *Runner) handleKeyEvent(ev *tcell.EventKey) bool {
 
 	// Arrow keys and basic cursor movement (Ctrl+B/F for left/right, Ctrl+P/N for up/down, hjkl in normal mode)
 	if ev.Key() == tcell.KeyLeft || ev.Key() == tcell.KeyCtrlB || (ev.Key() == tcell.KeyRune && ev.Rune() == 'b' && ev.Modifiers() == tcell.ModCtrl) || (!r.isInsertMode() && ev.Key() == tcell.KeyRune && ev.Rune() == 'h' && ev.Modifiers() == 0) {
-		if r.Mode == ModeMultiEdit && r.MultiEdit != nil && r.Cursor <= r.MultiEdit.primaryStart {
+		if r.Mode == ModeMultiEdit && r.MultiEdit != nil && r.Cursor <= r.MultiEdit.primary.Start.Pos() {
 			return false
 		}
 		if r.Cursor > 0 {
@@ -819,7 +813,7 @@ func (r *Runner) handleKeyEvent(ev *tcell.EventKey) bool {
 		return false
 	}
 	if ev.Key() == tcell.KeyRight || ev.Key() == tcell.KeyCtrlF || (ev.Key() == tcell.KeyRune && ev.Rune() == 'f' && ev.Modifiers() == tcell.ModCtrl) || (!r.isInsertMode() && ev.Key() == tcell.KeyRune && ev.Rune() == 'l' && ev.Modifiers() == 0) {
-		if r.Mode == ModeMultiEdit && r.MultiEdit != nil && r.Cursor >= r.MultiEdit.primaryEnd {
+		if r.Mode == ModeMultiEdit && r.MultiEdit != nil && r.Cursor >= r.MultiEdit.primary.End.Pos() {
 			return false
 		}
 		if r.Buf != nil && r.Cursor < r.Buf.Len() {
@@ -918,7 +912,7 @@ func (r *Runner) handleKeyEvent(ev *tcell.EventKey) bool {
 			if end > start {
 				text := string(r.Buf.Slice(start, end))
 				_ = r.deleteRange(start, end, text)
-				r.KillRing.Push(text)
+				r.storeKill(text)
 				if r.Logger != nil {
 					r.Logger.Event("action", map[string]any{"name": "cut.insert", "text": text, "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
 				}
@@ -961,7 +955,7 @@ func (r *Runner) handleVisualKey(ev *tcell.EventKey) bool {
 			r.PendingTextObject = false
 			r.TextObjectAround = false
 			if ok {
-				r.VisualStart = start
+				r.setVisualStart(start)
 				r.VisualLine = false
 				r.Cursor = end - 1
 				r.draw(nil)
@@ -992,12 +986,7 @@ func (r *Runner) handleVisualKey(ev *tcell.EventKey) bool {
 	case ev.Key() == tcell.KeyRune && ev.Rune() == 'G':
 		if r.Buf != nil && r.Buf.Len() > 0 {
 			r.Cursor = r.Buf.Len() - 1
-			lines := r.Buf.Lines()
-			last := len(lines) - 1
-			if last > 0 && len(lines[last]) == 0 {
-				last--
-			}
-			r.CursorLine = last
+			r.CursorLine = r.Buf.LineOf(r.Cursor)
 		}
 		r.draw(nil)
 		return false
@@ -1103,7 +1092,7 @@ func (r *Runner) handleVisualKey(ev *tcell.EventKey) bool {
 			r.insertText("\n")
 		}
 		r.Mode = ModeInsert
-		r.VisualStart = -1
+		r.setVisualStart(-1)
 		r.VisualLine = false
 		r.draw(nil)
 		return false
@@ -1115,7 +1104,7 @@ func (r *Runner) handleVisualKey(ev *tcell.EventKey) bool {
 			if start < end {
 				text := string(r.Buf.Slice(start, end))
 				r.clearYankState()
-				r.KillRing.Push(text)
+				r.storeYank(text)
 				if r.Logger != nil {
 					r.Logger.Event("action", map[string]any{"name": "yank.visual", "text": text, "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
 				}
@@ -1123,7 +1112,7 @@ func (r *Runner) handleVisualKey(ev *tcell.EventKey) bool {
 			}
 		}
 		r.Mode = ModeNormal
-		r.VisualStart = -1
+		r.setVisualStart(-1)
 		r.VisualLine = false
 		r.draw(nil)
 		return false
@@ -1133,7 +1122,7 @@ func (r *Runner) handleVisualKey(ev *tcell.EventKey) bool {
 			if start < end {
 				text := string(r.Buf.Slice(start, end))
 				_ = r.deleteRange(start, end, text)
-				r.KillRing.Push(text)
+				r.storeDelete(text)
 				if r.Logger != nil {
 					r.Logger.Event("action", map[string]any{"name": "cut.visual", "text": text, "cursor": r.Cursor, "buffer_len": r.Buf.Len()})
 				}
@@ -1141,7 +1130,7 @@ func (r *Runner) handleVisualKey(ev *tcell.EventKey) bool {
 			}
 		}
 		r.Mode = ModeNormal
-		r.VisualStart = -1
+		r.setVisualStart(-1)
 		r.VisualLine = false
 		r.draw(nil)
 		return false
@@ -1166,7 +1155,8 @@ func (r *Runner) performUndo(action string) {
 		return
 	}
 	if err := r.History.Undo(r.Buf, &r.Cursor); err == nil {
-		r.editSeq++
+		r.bumpEditSeq()
+		r.restoreSelection()
 	}
 	r.recomputeCursorLine()
 	r.Dirty = true
@@ -1183,7 +1173,8 @@ func (r *Runner) performRedo(action string) {
 		return
 	}
 	if err := r.History.Redo(r.Buf, &r.Cursor); err == nil {
-		r.editSeq++
+		r.bumpEditSeq()
+		r.restoreSelection()
 	}
 	r.recomputeCursorLine()
 	r.Dirty = true
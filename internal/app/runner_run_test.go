@@ -1,13 +1,17 @@
 package app
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"example.com/texteditor/pkg/buffer"
+	"example.com/texteditor/pkg/editor"
 	"example.com/texteditor/pkg/history"
+	"example.com/texteditor/pkg/swap"
 	"github.com/gdamore/tcell/v2"
 )
 
@@ -92,6 +96,131 @@ func TestRunner_LoadFile_NormalizesCRLF(t *testing.T) {
 	}
 }
 
+func TestRunner_Save_PreservesFileFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "win.txt")
+	if err := os.WriteFile(path, []byte("\xEF\xBB\xBFa\r\nb"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	r := &Runner{Buf: buffer.NewGapBuffer(0), History: history.New()}
+	if err := r.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if got := r.fileInfo(); got != "UTF-8 CRLF BOM noeol" {
+		t.Fatalf("unexpected file info %q", got)
+	}
+	r.Cursor = 1
+	r.insertText("\nz")
+	if err := r.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "\xEF\xBB\xBFa\r\nz\r\nb" {
+		t.Fatalf("expected CRLF and BOM preserved, got %q", data)
+	}
+	r.setLineEnding(editor.LineEndingLF)
+	r.toggleBOM()
+	if err := r.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	if string(data) != "a\nz\nb" {
+		t.Fatalf("expected converted LF without BOM, got %q", data)
+	}
+}
+
+func TestRunner_Save_KeepsMixedLineEndings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mixed.txt")
+	if err := os.WriteFile(path, []byte("a\r\nb^\rM\nc\r\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	r := &Runner{Buf: buffer.NewGapBuffer(0), History: history.New()}
+	if err := r.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	r.Cursor = 0
+	r.insertText("x")
+	if err := r.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "xa\r\nb^\rM\nc\r\n" {
+		t.Fatalf("expected only the edit to change the file, got %q", data)
+	}
+	r.setLineEnding(editor.LineEndingCRLF)
+	if got := r.Buf.String(); got != "xa\nb^\rM\nc\n" {
+		t.Fatalf("expected the buffer normalized, got %q", got)
+	}
+	if err := r.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "xa\r\nb^\rM\r\nc\r\n" {
+		t.Fatalf("expected CRLF throughout, got %q", data)
+	}
+}
+
+func TestRunner_Save_PreservesEncoding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latin1.txt")
+	if err := os.WriteFile(path, []byte("caf\xE9\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	r := &Runner{Buf: buffer.NewGapBuffer(0), History: history.New()}
+	if err := r.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if got := r.Buf.String(); got != "café\n" || r.Encoding != editor.EncodingLatin1 {
+		t.Fatalf("unexpected decode %q as %s", got, r.Encoding)
+	}
+	r.Cursor = r.Buf.Len()
+	r.insertText("naïve")
+	if err := r.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "caf\xE9\nna\xEFve" {
+		t.Fatalf("expected Latin-1 bytes, got %q", data)
+	}
+	// without a screen to confirm, a lossy save is refused
+	r.insertText(" ☃")
+	if err := r.Save(); err == nil {
+		t.Fatal("expected error saving unencodable character")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "caf\xE9\nna\xEFve" {
+		t.Fatalf("file changed by refused save: %q", data)
+	}
+	if err := r.reopenWithEncoding(editor.EncodingWindows1252); err != nil {
+		t.Fatalf("reopenWithEncoding: %v", err)
+	}
+	if r.Dirty || r.Buf.String() != "café\nnaïve" || r.fileInfo() != "Windows-1252 LF noeol" {
+		t.Fatalf("unexpected reopened state dirty=%v %q %q", r.Dirty, r.Buf.String(), r.fileInfo())
+	}
+}
+
+func TestRunner_SetStorage_PieceTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "piece.txt")
+	if err := os.WriteFile(path, []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	r := New()
+	if err := r.SetStorage("piecetable"); err != nil {
+		t.Fatalf("SetStorage: %v", err)
+	}
+	if _, ok := r.Buf.(*buffer.PieceTable); !ok {
+		t.Fatalf("expected empty buffer to switch to piece table, got %T", r.Buf)
+	}
+	if err := r.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if _, ok := r.Buf.(*buffer.PieceTable); !ok {
+		t.Fatalf("expected loaded buffer to be a piece table, got %T", r.Buf)
+	}
+	r.insertText("zero\n")
+	if got := r.Buf.String(); !strings.HasSuffix(got, "zero\n") {
+		t.Fatalf("unexpected contents %q", got)
+	}
+	if err := r.SetStorage("rope"); err == nil {
+		t.Fatalf("expected error for unknown backend")
+	}
+}
+
 func TestRunner_SaveAs_WritesAndClearsDirty(t *testing.T) {
 	f, err := os.CreateTemp("", "texteditor_saveas_*")
 	if err != nil {
@@ -394,7 +523,8 @@ func TestRun_MnemonicMenu_FromVisualSelection(t *testing.T) {
 	defer s.Fini()
 
 	buf := buffer.NewGapBufferFromString("alpha beta")
-	r := &Runner{Screen: s, Buf: buf, History: history.New(), Mode: ModeVisual, VisualStart: 0}
+	r := &Runner{Screen: s, Buf: buf, History: history.New(), Mode: ModeVisual}
+	r.setVisualStart(0)
 	r.Cursor = 5
 
 	done := make(chan error, 1)
@@ -652,3 +782,311 @@ func TestRun_GoToPrompt_Simulation(t *testing.T) {
 		t.Fatalf("expected cursor %d after go-to, got %d", expected, r.Cursor)
 	}
 }
+
+func TestRunner_SwapJournalRecovery(t *testing.T) {
+	dir := t.TempDir()
+	swapDir := filepath.Join(dir, "swap")
+	path := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	r := &Runner{Buf: buffer.NewGapBuffer(0), History: history.New(), SwapDir: swapDir}
+	if err := r.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	r.Cursor = 0
+	r.insertText("zero\n")
+	r.flushSwaps()
+	r.Cursor = r.Buf.Len()
+	r.insertText("three\n")
+	r.flushSwaps()
+	sp := swap.PathFor(swapDir, path)
+	if _, err := os.Stat(sp); err != nil {
+		t.Fatalf("expected swap file: %v", err)
+	}
+
+	// a second session finds the swap and defers the prompt until Run
+	r2 := &Runner{Buf: buffer.NewGapBuffer(0), History: history.New(), SwapDir: swapDir}
+	if err := r2.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if r2.pendingSwap != path {
+		t.Fatalf("expected pending swap prompt, got %q", r2.pendingSwap)
+	}
+	rec, err := swap.Read(sp)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	r2.recoverSwap(sp, rec)
+	if got := r2.Buf.String(); got != "zero\none\ntwo\nthree\n" || !r2.Dirty {
+		t.Fatalf("unexpected recovered buffer %q dirty=%v", got, r2.Dirty)
+	}
+	if err := r2.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if _, err := os.Stat(sp); !os.IsNotExist(err) {
+		t.Fatalf("expected swap removed after save, got %v", err)
+	}
+}
+
+func TestRunner_EmergencySwapFlush(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "crash.txt")
+	_ = os.WriteFile(path, []byte("a\n"), 0644)
+	r := &Runner{Buf: buffer.NewGapBuffer(0), History: history.New(), SwapDir: dir}
+	if err := r.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	r.insertText("b\n")
+	func() {
+		defer func() {
+			if recover() != nil {
+				r.emergencySwapFlush()
+			}
+		}()
+		panic("boom")
+	}()
+	rec, err := swap.Read(swap.PathFor(dir, path))
+	if err != nil || rec.Text != "a\nb\n" {
+		t.Fatalf("expected flushed swap, got %v %+v", err, rec)
+	}
+}
+
+func TestRunner_PersistentUndo(t *testing.T) {
+	dir := t.TempDir()
+	undoDir := filepath.Join(dir, "undo")
+	path := filepath.Join(dir, "kept.txt")
+	if err := os.WriteFile(path, []byte("one\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	r := &Runner{Buf: buffer.NewGapBuffer(0), History: history.New(), UndoDir: undoDir}
+	if err := r.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	r.insertText("two\n")
+	if err := r.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// a new session undoes past the point the file was opened
+	r2 := &Runner{Buf: buffer.NewGapBuffer(0), History: history.New(), UndoDir: undoDir}
+	if err := r2.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	r2.performUndo("undo")
+	if got := r2.Buf.String(); got != "one\n" {
+		t.Fatalf("expected undo across sessions, got %q", got)
+	}
+
+	// the history is dropped once the file changes behind its back
+	if err := os.WriteFile(path, []byte("other\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	r3 := &Runner{Buf: buffer.NewGapBuffer(0), History: history.New(), UndoDir: undoDir}
+	if err := r3.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if r3.History.CanUndo() {
+		t.Fatalf("expected no history for changed file")
+	}
+
+	// excluded files keep no history at all
+	r4 := &Runner{Buf: buffer.NewGapBuffer(0), History: history.New(), UndoDir: undoDir, UndoExclude: []string{"*.txt"}}
+	if r4.undoFileFor(path) != "" {
+		t.Fatalf("expected %s to be excluded", path)
+	}
+	r4.UndoExclude = []string{dir + "/**"}
+	if r4.undoFileFor(path) != "" {
+		t.Fatalf("expected directory pattern to exclude %s", path)
+	}
+}
+
+func TestRunner_UndoLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.txt")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	r := &Runner{Buf: buffer.NewGapBuffer(0), History: history.New()}
+	r.SetUndoLimits(history.Limits{MaxBytes: 10})
+	if err := r.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	for _, s := range []string{"aaaaaaaa", "bbbbbbbb", "cccccccc"} {
+		r.insertText(s)
+	}
+	if st := r.History.Stats(); st.Bytes > 10 {
+		t.Fatalf("expected history within limit, got %+v", st)
+	}
+	lines := r.undoMemLines()
+	if !strings.Contains(strings.Join(lines, "\n"), path+": 2 states, 1 ops, 8 B") {
+		t.Fatalf("unexpected report %q", lines)
+	}
+}
+
+func TestRunner_DetectsExternalChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watched.txt")
+	if err := os.WriteFile(path, []byte("one\ntwo\nthree\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	r := &Runner{Buf: buffer.NewGapBuffer(0), History: history.New(), AutoReload: true}
+	if err := r.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	r.Cursor = r.Buf.LineStart(2) + 2
+	r.recomputeCursorLine()
+
+	// a formatter rewrites the file underneath a clean buffer
+	_ = os.WriteFile(path, []byte("ONE\nTWO\nTHREE!\n"), 0644)
+	r.checkDiskChange()
+	if got := r.Buf.String(); got != "ONE\nTWO\nTHREE!\n" {
+		t.Fatalf("expected auto reload, got %q", got)
+	}
+	if r.CursorLine != 2 || r.Cursor != r.Buf.LineStart(2)+2 {
+		t.Fatalf("expected cursor kept on line 2 col 2, got line %d pos %d", r.CursorLine, r.Cursor)
+	}
+
+	// dirty buffers are never overwritten silently
+	r.insertText("x")
+	_ = os.WriteFile(path, []byte("changed again\n"), 0644)
+	if err := r.Save(); !errors.Is(err, editor.ErrChangedOnDisk) {
+		t.Fatalf("expected ErrChangedOnDisk, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "changed again\n" {
+		t.Fatalf("external change clobbered: %q", data)
+	}
+}
+
+func TestRunner_DetectsExternalChangeInBackground(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	_ = os.WriteFile(a, []byte("a\n"), 0644)
+	_ = os.WriteFile(b, []byte("b\n"), 0644)
+	r := &Runner{Buf: buffer.NewGapBuffer(0), History: history.New(), AutoReload: true}
+	if err := r.LoadFile(a); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if err := r.focusFile(b); err != nil {
+		t.Fatalf("focusFile: %v", err)
+	}
+
+	// a.txt changes while b.txt has focus
+	_ = os.WriteFile(a, []byte("a changed\n"), 0644)
+	r.checkDiskChange()
+	if len(r.stale) != 1 || r.Buf.String() != "b\n" {
+		t.Fatalf("expected a.txt marked stale only, got %d stale, focused %q", len(r.stale), r.Buf.String())
+	}
+	r.checkStaleFocus()
+	if err := r.focusFile(a); err != nil {
+		t.Fatalf("focusFile: %v", err)
+	}
+	r.checkStaleFocus()
+	if got := r.Buf.String(); got != "a changed\n" || len(r.stale) != 0 {
+		t.Fatalf("expected a.txt reloaded once focused, got %q", got)
+	}
+}
+
+// TestRunner_SwitchBuffers_KeepsHistoryAndView verifies each buffer keeps its
+// own undo history, cursor and mode across Ctrl+PgUp/PgDn.
+func TestRunner_SwitchBuffers_KeepsHistoryAndView(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	_ = os.WriteFile(a, []byte("alpha\n"), 0644)
+	_ = os.WriteFile(b, []byte("beta\n"), 0644)
+	r := &Runner{Buf: buffer.NewGapBuffer(0), History: history.New()}
+	if err := r.LoadFile(a); err != nil {
+		t.Fatalf("LoadFile a: %v", err)
+	}
+	r.Cursor = 0
+	r.insertText("A")
+	if err := r.LoadFile(b); err != nil {
+		t.Fatalf("LoadFile b: %v", err)
+	}
+	r.Cursor = 4
+	r.insertText("B")
+	r.Mode = ModeVisual
+	r.setVisualStart(1)
+
+	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyPgUp, 0, tcell.ModCtrl))
+	if r.FilePath != a || r.Mode != ModeNormal || r.Cursor != 1 {
+		t.Fatalf("expected a.txt in normal mode at 1, got %s mode %v cursor %d", r.FilePath, r.Mode, r.Cursor)
+	}
+	r.performUndo("undo")
+	if got := r.Buf.String(); got != "alpha\n" {
+		t.Fatalf("undo in a.txt: got %q", got)
+	}
+	r.performUndo("undo")
+	if got := r.Buf.String(); got != "alpha\n" {
+		t.Fatalf("undo replayed another buffer's history: %q", got)
+	}
+
+	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyPgDn, 0, tcell.ModCtrl))
+	if r.FilePath != b || r.Mode != ModeVisual || r.visualStart() != 1 || r.Cursor != 5 {
+		t.Fatalf("expected b.txt in visual mode at 5, got %s mode %v start %d cursor %d", r.FilePath, r.Mode, r.visualStart(), r.Cursor)
+	}
+	r.performUndo("undo")
+	if got := r.Buf.String(); got != "beta\n" {
+		t.Fatalf("undo in b.txt: got %q", got)
+	}
+}
+
+// TestRun_BracketedPaste_Simulation pastes in normal mode: the keys are
+// inserted as text rather than run as commands, undo removes the whole
+// paste, and a macro replays it as one insert.
+func TestRun_BracketedPaste_Simulation(t *testing.T) {
+	s := tcell.NewSimulationScreen("UTF-8")
+	if err := s.Init(); err != nil {
+		t.Fatalf("init sim screen: %v", err)
+	}
+	defer s.Fini()
+	s.SetSize(60, 10)
+
+	r := &Runner{Screen: s, Buf: buffer.NewGapBufferFromString("start\n"), History: history.New()}
+
+	done := make(chan error, 1)
+	go func() { done <- r.Run() }()
+
+	time.Sleep(10 * time.Millisecond)
+
+	// record a paste into register a, undo it and replay it; the state is
+	// checked once Run has returned, as the loop owns the buffer until then
+	for _, ev := range []tcell.Event{
+		tcell.NewEventKey(tcell.KeyRune, 'q', 0),
+		tcell.NewEventKey(tcell.KeyRune, 'a', 0),
+		tcell.NewEventPaste(true),
+		tcell.NewEventKey(tcell.KeyRune, 'd', 0),
+		tcell.NewEventKey(tcell.KeyRune, 'd', 0),
+		tcell.NewEventKey(tcell.KeyEnter, 0, 0),
+		tcell.NewEventKey(tcell.KeyTab, 0, 0),
+		tcell.NewEventKey(tcell.KeyRune, 'x', 0),
+		tcell.NewEventPaste(false),
+		tcell.NewEventKey(tcell.KeyRune, 'q', 0),
+		tcell.NewEventKey(tcell.KeyRune, 'u', 0),
+		tcell.NewEventKey(tcell.KeyRune, '@', 0),
+		tcell.NewEventKey(tcell.KeyRune, 'a', 0),
+		tcell.NewEventKey(tcell.KeyEsc, 0, 0),
+		tcell.NewEventKey(tcell.KeyCtrlQ, 0, 0),
+		tcell.NewEventKey(tcell.KeyRune, 'y', 0),
+	} {
+		s.PostEventWait(ev)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("runner returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timeout waiting for runner to quit")
+	}
+	// undone and replayed once: a failed undo would leave the paste twice
+	if got := r.Buf.String(); got != "dd\n\txstart\n" {
+		t.Fatalf("expected the paste replayed once, got %q", got)
+	}
+	if r.MacroStatus != "" || r.Mode != ModeNormal {
+		t.Fatalf("expected recording stopped in normal mode, got %q %v", r.MacroStatus, r.Mode)
+	}
+	if got := r.macroRegisters["a"]; len(got) != 1 || got[0].Kind != macroEventPaste || got[0].Text != "dd\n\tx" {
+		t.Fatalf("expected the paste recorded as one insert, got %+v", got)
+	}
+}
@@ -26,12 +26,18 @@ var wordRE = regexp.MustCompile(`(?i)[A-Za-z][A-Za-z0-9']*`)
 
 // SpellState is the runner's spell-check subsystem state.
 type SpellState struct {
-	Enabled      bool
-	Client       *spell.Client
+	Enabled bool
+	Client  *spell.Client
+	running atomic.Bool
+	spellView
+}
+
+// spellView is the scan result for the focused buffer; it is swapped with
+// the buffer on focus changes.
+type spellView struct {
 	ranges       []search.Range
 	lastTopLine  int
 	lastMaxLines int
-	running      atomic.Bool
 	// lastEditSeq is the Runner.editSeq value the last time we scanned.
 	lastEditSeq int64
 }
@@ -100,24 +106,14 @@ func (r *Runner) updateSpellAsync() {
 	if r.Spell.lastTopLine == r.TopLine && r.Spell.lastMaxLines == maxLines && r.Spell.lastEditSeq == r.editSeq && len(r.Spell.ranges) > 0 {
 		return
 	}
-	lines := r.Buf.Lines()
-	startLine := r.TopLine
-	endLine := r.TopLine + maxLines
-	if endLine > len(lines) {
-		endLine = len(lines)
-	}
-	// compute byte offset of startLine
-	byteStart := 0
-	for i := 0; i < startLine && i < len(lines); i++ {
-		byteStart += len([]byte(lines[i])) + 1 // include newline
-	}
+	// only the viewport lines are materialized, starting at byteStart
+	lines, byteStart, _ := visibleLines(r.Buf, r.TopLine, maxLines)
 	// Collect unique lowercase words and track positions of occurrences per word.
 	wordSet := make(map[string]struct{})
 	type occ struct{ s, e int }
 	occs := make(map[string][]occ)
 	off := byteStart
-	for i := startLine; i < endLine; i++ {
-		line := lines[i]
+	for _, line := range lines {
 		for _, loc := range wordRE.FindAllStringIndex(line, -1) {
 			w := strings.ToLower(line[loc[0]:loc[1]])
 			wordSet[w] = struct{}{}
@@ -140,6 +136,7 @@ func (r *Runner) updateSpellAsync() {
 		words = append(words, w)
 	}
 	sort.Strings(words)
+	seq := r.editSeq
 	go func(words []string, occs map[string][]occ) {
 		// Use a timeout to avoid hanging the background worker on a stuck checker.
 		bad, err := r.Spell.Client.CheckWithTimeout(words, spellTimeout())
@@ -170,6 +167,10 @@ func (r *Runner) updateSpellAsync() {
 				}
 			}
 		}
+		// drop results for a buffer that lost focus meanwhile
+		if r.Spell.lastEditSeq != seq {
+			return
+		}
 		r.Spell.ranges = rs
 		r.draw(nil)
 	}(words, occs)
@@ -209,20 +210,10 @@ func (r *Runner) CheckWordAtCursor() string {
 	if r.Buf == nil || r.Buf.Len() == 0 {
 		return ""
 	}
-	text := r.Buf.String()
 	// Limit scan to current line for efficiency
 	lineStartRune, lineEndRune := r.currentLineBounds()
-	startByte := runeIndexToByteOffset(text, lineStartRune)
-	endByte := runeIndexToByteOffset(text, lineEndRune)
-	if startByte < 0 {
-		startByte = 0
-	}
-	if endByte > len(text) {
-		endByte = len(text)
-	}
-	line := text[startByte:endByte]
-	curByte := runeIndexToByteOffset(text, r.Cursor)
-	rel := curByte - startByte
+	line := string(r.Buf.Slice(lineStartRune, lineEndRune))
+	rel := r.Buf.ByteOffset(r.Cursor) - r.Buf.ByteOffset(lineStartRune)
 	if rel < 0 {
 		rel = 0
 	}
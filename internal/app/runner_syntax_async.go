@@ -5,6 +5,7 @@ import (
     "sync/atomic"
     "time"
 
+    "example.com/texteditor/pkg/buffer"
     "example.com/texteditor/pkg/plugins"
     "example.com/texteditor/pkg/search"
 )
@@ -67,30 +68,33 @@ func (r *Runner) updateSyntaxAsync() {
     if r.SyntaxAsync.running.Load() && r.SyntaxAsync.lastEditSeq == r.editSeq && r.SyntaxAsync.lastLang == lang.Highlighter {
         return
     }
-    // Snapshot inputs for the worker.
-    src := r.Buf.String()
+    // Snapshot inputs for the worker; the text is materialized off the UI goroutine.
+    snap := r.snapshot()
     seq := r.editSeq
     langName := lang.Highlighter
     r.SyntaxAsync.lastEditSeq = seq
     r.SyntaxAsync.lastLang = langName
     r.SyntaxAsync.running.Store(true)
 
-    go func(src string, seq int64, lang *plugins.LanguageSpec) {
+    go func(st *SyntaxState, snap buffer.Snapshot, seq int64, lang *plugins.LanguageSpec) {
         // Create a fresh highlighter instance for this run.
         h := plugins.HighlighterFor(lang)
         var ranges []search.Range
         if h != nil {
-            ranges = h.Highlight([]byte(src))
+            ranges = h.Highlight([]byte(snap.String()))
         }
-        // Apply if still current; discard if stale.
-        if r.SyntaxAsync != nil && r.SyntaxAsync.lastEditSeq == seq && r.SyntaxAsync.lastLang == lang.Highlighter {
-            r.SyntaxAsync.ranges = ranges
-            r.SyntaxAsync.running.Store(false)
-            r.draw(nil)
+        // Apply if still current; discard if stale. st belongs to the buffer
+        // the run started for, even if another buffer has focus by now.
+        if st.lastEditSeq == seq && st.lastLang == lang.Highlighter {
+            st.ranges = ranges
+            st.running.Store(false)
+            if r.SyntaxAsync == st {
+                r.draw(nil)
+            }
             return
         }
         // Stale result; just clear running flag.
-        r.SyntaxAsync.running.Store(false)
-    }(src, seq, lang)
+        st.running.Store(false)
+    }(r.SyntaxAsync, snap, seq, lang)
 }
 
@@ -2,6 +2,7 @@ package app
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -222,7 +223,8 @@ func TestMultiEditUpdatesMatches(t *testing.T) {
 
 func TestMultiEditSelectionMoveAndAppend(t *testing.T) {
 	text := "test\nfoo test\nbar test\n"
-	r := &Runner{Buf: buffer.NewGapBufferFromString(text), Mode: ModeVisual, VisualStart: 3}
+	r := &Runner{Buf: buffer.NewGapBufferFromString(text), Mode: ModeVisual}
+	r.setVisualStart(3)
 	r.Cursor = 0
 	r.toggleMultiEdit()
 	if r.Mode != ModeMultiEdit {
@@ -277,7 +279,8 @@ func TestMultiEditCtrlBMoveWithinSelection(t *testing.T) {
 
 func TestMultiEditSelectionDeleteWithinMatch(t *testing.T) {
 	text := "test\ntest\ntest\n"
-	r := &Runner{Buf: buffer.NewGapBufferFromString(text), Mode: ModeVisual, VisualStart: 13}
+	r := &Runner{Buf: buffer.NewGapBufferFromString(text), Mode: ModeVisual}
+	r.setVisualStart(13)
 	r.Cursor = 10
 	r.toggleMultiEdit()
 	if r.Mode != ModeMultiEdit {
@@ -329,7 +332,7 @@ func TestMultiEditPrimaryMatchRemainsSelected(t *testing.T) {
 	if r.Mode != ModeMultiEdit {
 		t.Fatalf("expected multi-edit mode")
 	}
-	r.Cursor = r.MultiEdit.primaryEnd
+	r.Cursor = r.MultiEdit.primary.End.Pos()
 	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, 'x', 0))
 	if got := r.Buf.String(); got != "alphax beta alphax" {
 		t.Fatalf("expected matches to update, got %q", got)
@@ -345,7 +348,7 @@ func TestMultiEditPrimaryMatchRemainsSelected(t *testing.T) {
 	if len(matches) != 2 {
 		t.Fatalf("expected both matches to update, got %d", len(matches))
 	}
-	if r.MultiEdit.matches[0].Start != matches[0].Start && r.MultiEdit.matches[0].Start != matches[1].Start {
+	if got := r.MultiEdit.matchRanges(r.Buf); got[0].Start != matches[0].Start && got[0].Start != matches[1].Start {
 		t.Fatalf("expected primary match to remain selected")
 	}
 }
@@ -370,7 +373,7 @@ func TestMultiEditEditOutsideSelectionDoesNotExpandMatches(t *testing.T) {
 	text := r.Buf.String()
 	startFirst := runeIndexToByteOffset(text, 0)
 	startSecond := runeIndexToByteOffset(text, 9)
-	if r.MultiEdit.matches[0].Start != startFirst || r.MultiEdit.matches[1].Start != startSecond {
+	if got := r.MultiEdit.matchRanges(r.Buf); got[0].Start != startFirst || got[1].Start != startSecond {
 		t.Fatalf("expected matches unchanged after outside edit")
 	}
 }
@@ -477,7 +480,8 @@ func TestWordMotionsNormalMode(t *testing.T) {
 }
 
 func TestWordEndVisualMode(t *testing.T) {
-	r := &Runner{Buf: buffer.NewGapBufferFromString("one two"), Mode: ModeVisual, VisualStart: 0}
+	r := &Runner{Buf: buffer.NewGapBufferFromString("one two"), Mode: ModeVisual}
+	r.setVisualStart(0)
 
 	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, 'e', 0))
 	if r.Cursor != 2 {
@@ -490,6 +494,29 @@ func TestWordEndVisualMode(t *testing.T) {
 	}
 }
 
+func TestVisualAnchorAndYankFollowEdits(t *testing.T) {
+	r := &Runner{Buf: buffer.NewGapBufferFromString("one two"), Mode: ModeVisual, History: history.New()}
+	r.setVisualStart(4)
+	r.Cursor = r.Buf.Len()
+	start := r.beginYankTracking()
+	r.insertText(" three")
+	r.endYankTracking(start, 1)
+
+	// an edit the runner did not make, as by a reload or another view
+	_ = r.Buf.Insert(0, []rune(">> "))
+	if got := r.visualStart(); got != 7 {
+		t.Fatalf("expected visual start to follow the edit to 7, got %d", got)
+	}
+	if s, e := r.lastYank.Bounds(); string(r.Buf.Slice(s, e)) != " three" {
+		t.Fatalf("expected yank range to cover the yanked text, got %d..%d", s, e)
+	}
+	r.setVisualStart(-1)
+	r.clearYankState()
+	if n := r.Buf.Markers().Len(); n != 0 {
+		t.Fatalf("expected markers released, %d left", n)
+	}
+}
+
 func TestWordMotionCount(t *testing.T) {
 	r := &Runner{Buf: buffer.NewGapBufferFromString("one two three"), Mode: ModeNormal}
 	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, '3', 0))
@@ -563,7 +590,7 @@ func TestVisualHalfPageMovement(t *testing.T) {
 	if r.CursorLine != 10 {
 		t.Fatalf("expected cursor line 10 after Ctrl+D, got %d", r.CursorLine)
 	}
-	if r.Mode != ModeVisual || r.VisualStart != start {
+	if r.Mode != ModeVisual || r.visualStart() != start {
 		t.Fatalf("expected to remain in visual mode after Ctrl+D")
 	}
 	r.KillRing.Push("ZZ")
@@ -571,7 +598,7 @@ func TestVisualHalfPageMovement(t *testing.T) {
 	if r.CursorLine != 0 {
 		t.Fatalf("expected cursor line 0 after Ctrl+U, got %d", r.CursorLine)
 	}
-	if r.Mode != ModeVisual || r.VisualStart != start {
+	if r.Mode != ModeVisual || r.visualStart() != start {
 		t.Fatalf("expected to remain in visual mode after Ctrl+U")
 	}
 	if got := r.Buf.String(); got != orig {
@@ -704,6 +731,267 @@ func TestRunner_KillToEndOfLineAndYank(t *testing.T) {
 	}
 }
 
+func TestRunner_ConsecutiveKillsAppend(t *testing.T) {
+	r := &Runner{Buf: buffer.NewGapBufferFromString("one\ntwo\nthree"), History: history.New(), Mode: ModeInsert}
+	kill := tcell.NewEventKey(tcell.KeyCtrlK, 0, 0)
+	for i := 0; i < 3; i++ {
+		r.handleKeyEvent(kill)
+	}
+	if r.KillRing.Len() != 1 || r.KillRing.Get() != "one\ntwo" {
+		t.Fatalf("expected one entry %q, got %d entries, current %q", "one\ntwo", r.KillRing.Len(), r.KillRing.Get())
+	}
+	if got, _ := r.Registers.Get('1'); got != "one\ntwo" {
+		t.Fatalf("expected register 1 to follow the kill, got %q", got)
+	}
+	// any other key ends the run of kills
+	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRight, 0, 0))
+	r.handleKeyEvent(kill)
+	if r.KillRing.Len() != 2 || r.KillRing.Get() != "three" {
+		t.Fatalf("expected a new entry after moving, got %d entries, current %q", r.KillRing.Len(), r.KillRing.Get())
+	}
+}
+
+func TestRunner_KillRingBrowser(t *testing.T) {
+	s := tcell.NewSimulationScreen("UTF-8")
+	if err := s.Init(); err != nil {
+		t.Fatalf("init sim: %v", err)
+	}
+	defer s.Fini()
+	s.SetSize(60, 12)
+	r := &Runner{Screen: s, Buf: buffer.NewGapBufferFromString(""), History: history.New(), Mode: ModeInsert, EventCh: make(chan tcell.Event, 16)}
+	r.KillRing.Push("alpha")
+	r.KillRing.Push("beta\nsecond line")
+	r.KillRing.Push("gamma")
+
+	lines := r.killRingBrowserLines("", r.killRingMatches(""), 1, 60, 12)
+	if len(lines) != 11 {
+		t.Fatalf("expected the browser to fill the screen above the status bar, got %d lines", len(lines))
+	}
+	if !strings.Contains(strings.Join(lines, "\n"), "\nsecond line\n") {
+		t.Fatalf("expected a preview of the selected multi-line entry, got %q", lines)
+	}
+
+	for _, ev := range []*tcell.EventKey{
+		tcell.NewEventKey(tcell.KeyRune, 'E', 0),
+		tcell.NewEventKey(tcell.KeyRune, 't', 0),
+		tcell.NewEventKey(tcell.KeyEnter, 0, 0),
+	} {
+		r.EventCh <- ev
+	}
+	r.runKillRingBrowser()
+	if got := r.Buf.String(); got != "beta\nsecond line" {
+		t.Fatalf("expected the filtered entry yanked, got %q", got)
+	}
+
+	r.EventCh <- tcell.NewEventKey(tcell.KeyCtrlD, 0, 0)
+	r.EventCh <- tcell.NewEventKey(tcell.KeyEsc, 0, 0)
+	r.runKillRingBrowser()
+	if got := r.KillRing.Entries(); len(got) != 2 || got[0] != "gamma" || got[1] != "alpha" {
+		t.Fatalf("expected the selected entry deleted, got %q", got)
+	}
+}
+
+func TestRunner_RegexSearchPrompt(t *testing.T) {
+	s := tcell.NewSimulationScreen("UTF-8")
+	if err := s.Init(); err != nil {
+		t.Fatalf("init sim: %v", err)
+	}
+	defer s.Fini()
+	s.SetSize(60, 12)
+	r := &Runner{Screen: s, Buf: buffer.NewGapBufferFromString("alpha beta\ngamma Beta\ndelta"), History: history.New(), EventCh: make(chan tcell.Event, 32)}
+
+	// a regex spanning two lines, smart-case so "beta" also finds "Beta"
+	r.EventCh <- tcell.NewEventKey(tcell.KeyRune, 'r', tcell.ModAlt)
+	for _, ch := range `beta\nd` {
+		r.EventCh <- tcell.NewEventKey(tcell.KeyRune, ch, 0)
+	}
+	r.EventCh <- tcell.NewEventKey(tcell.KeyEnter, 0, 0)
+	r.runSearchPromptCase(false)
+	if r.Cursor != 17 || r.CursorLine != 1 {
+		t.Fatalf("expected the cursor on the multi-line match at 17 line 1, got %d line %d", r.Cursor, r.CursorLine)
+	}
+	if !r.searchRegex {
+		t.Fatalf("expected regex mode kept for the next search")
+	}
+
+	// whole word skips "lpha", which starts inside "alpha"
+	r.Cursor, r.CursorLine = 0, 0
+	r.EventCh <- tcell.NewEventKey(tcell.KeyRune, 'w', tcell.ModAlt)
+	for _, ch := range `lpha|beta` {
+		r.EventCh <- tcell.NewEventKey(tcell.KeyRune, ch, 0)
+	}
+	r.EventCh <- tcell.NewEventKey(tcell.KeyEnter, 0, 0)
+	r.runSearchPromptCase(true)
+	if r.Cursor != 6 {
+		t.Fatalf("expected the whole word beta at 6, got %d", r.Cursor)
+	}
+
+	if _, err := search.Find("x", "a(", search.Options{Regex: true}); err == nil {
+		t.Fatalf("expected an invalid pattern")
+	} else if got := searchErrorLine(err); got != "Invalid pattern: missing closing ): `a(`" {
+		t.Fatalf("unexpected error line %q", got)
+	}
+}
+
+func TestRunner_SearchPromptLargeBuffer(t *testing.T) {
+	s := tcell.NewSimulationScreen("UTF-8")
+	if err := s.Init(); err != nil {
+		t.Fatalf("init sim: %v", err)
+	}
+	defer s.Fini()
+	s.SetSize(60, 12)
+	filler := strings.Repeat("lorem ipsum dolor\n", asyncSearchSize/18+1000)
+	text := "a needle\n" + filler + "another Needle\n"
+	r := &Runner{Screen: s, Buf: buffer.NewGapBufferFromString(text), History: history.New(), EventCh: make(chan tcell.Event, 32)}
+	r.Cursor = 10
+
+	// each key restarts the background search; Enter before it finishes
+	// jumps once the results are in
+	for _, ch := range "needle" {
+		r.EventCh <- tcell.NewEventKey(tcell.KeyRune, ch, 0)
+	}
+	r.EventCh <- tcell.NewEventKey(tcell.KeyEnter, 0, 0)
+	r.runSearchPromptCase(false)
+	want := len([]rune(text)) - len("Needle\n")
+	if r.Cursor != want {
+		t.Fatalf("expected the cursor on the last needle at %d, got %d", want, r.Cursor)
+	}
+}
+
+func TestRunner_QueryReplace(t *testing.T) {
+	s := tcell.NewSimulationScreen("UTF-8")
+	if err := s.Init(); err != nil {
+		t.Fatalf("init sim: %v", err)
+	}
+	defer s.Fini()
+	s.SetSize(60, 12)
+	r := &Runner{Screen: s, Buf: buffer.NewGapBufferFromString("foo bar Foo baz foo"), History: history.New(), EventCh: make(chan tcell.Event, 32)}
+	send := func(keys string) {
+		for _, ch := range keys {
+			switch ch {
+			case '\n':
+				r.EventCh <- tcell.NewEventKey(tcell.KeyEnter, 0, 0)
+			case '\b':
+				r.EventCh <- tcell.NewEventKey(tcell.KeyBackspace2, 0, 0)
+			default:
+				r.EventCh <- tcell.NewEventKey(tcell.KeyRune, ch, 0)
+			}
+		}
+	}
+
+	// smart case: "foo" also matches "Foo"; e edits the replacement
+	send("foo\nx\nyn" + "e\bz\n" + "k")
+	r.runQueryReplace()
+	if got := r.Buf.String(); got != "x bar Foo baz z" {
+		t.Fatalf("unexpected result %q", got)
+	}
+	r.performUndo("undo")
+	if got := r.Buf.String(); got != "foo bar Foo baz foo" {
+		t.Fatalf("expected one undo to revert the session, got %q", got)
+	}
+
+	// regex with groups; u puts the last replacement back and asks again
+	r.Buf = buffer.NewGapBufferFromString("a=1\nb=2\nc=3")
+	r.History = history.New()
+	r.Cursor = 0
+	r.EventCh <- tcell.NewEventKey(tcell.KeyRune, 'r', tcell.ModAlt)
+	send(`(\w)=(\d)` + "\n$2:$1\nyu!k")
+	r.runQueryReplace()
+	r.searchRegex = false
+	if got := r.Buf.String(); got != "1:a\n2:b\n3:c" {
+		t.Fatalf("unexpected regex result %q", got)
+	}
+
+	// an edited regex replacement is expanded for the match being asked
+	// about, after earlier replacements changed the text
+	r.Buf = buffer.NewGapBufferFromString("aaaa")
+	r.History = history.New()
+	r.Cursor = 0
+	r.EventCh <- tcell.NewEventKey(tcell.KeyRune, 'r', tcell.ModAlt)
+	send("(a)a\n$1\nye\b\b[$1]\nk")
+	r.runQueryReplace()
+	r.searchRegex = false
+	if got := r.Buf.String(); got != "a[a]" {
+		t.Fatalf("unexpected result after editing a regex replacement %q", got)
+	}
+
+	// ! replaces the rest from the matches found at the start, shifted by
+	// the length changes before them
+	r.Buf = buffer.NewGapBufferFromString(strings.Repeat("é ab ", 1000))
+	r.History = history.New()
+	r.Cursor = 0
+	send("ab\nlonger\nn!k")
+	r.runQueryReplace()
+	if got, want := r.Buf.String(), "é ab "+strings.Repeat("é longer ", 999); got != want {
+		t.Fatalf("unexpected result after ! %q", got[:40])
+	}
+
+	// in visual mode only the selection is replaced
+	r.Buf = buffer.NewGapBufferFromString("x x x\nx x x")
+	r.History = history.New()
+	r.Mode = ModeVisual
+	r.setVisualStart(6)
+	r.Cursor = 8
+	send("x\ny\n!k")
+	r.runQueryReplace()
+	if got := r.Buf.String(); got != "x x x\ny y x" {
+		t.Fatalf("expected only the selection replaced, got %q", got)
+	}
+	if r.Mode != ModeNormal {
+		t.Fatalf("expected visual mode to end, got %v", r.Mode)
+	}
+}
+
+func TestRunner_PromptHistoryRecall(t *testing.T) {
+	s := tcell.NewSimulationScreen("UTF-8")
+	if err := s.Init(); err != nil {
+		t.Fatalf("init sim: %v", err)
+	}
+	defer s.Fini()
+	s.SetSize(60, 12)
+	r := &Runner{Screen: s, Buf: buffer.NewGapBufferFromString("a\nb\nc\nd\ne"), History: history.New(), EventCh: make(chan tcell.Event, 16)}
+	up := tcell.NewEventKey(tcell.KeyUp, 0, 0)
+	enter := tcell.NewEventKey(tcell.KeyEnter, 0, 0)
+
+	r.Prompts.Add(historyGoto, "2")
+	r.Prompts.Add(historyGoto, "4")
+	r.Prompts.Add(historyGoto, "5")
+	// Up twice goes back to 4
+	r.EventCh <- up
+	r.EventCh <- up
+	r.EventCh <- enter
+	r.runGoToPrompt()
+	if r.CursorLine != 3 {
+		t.Fatalf("expected the recalled line 4, got line %d", r.CursorLine+1)
+	}
+	if got := r.Prompts.Entries(historyGoto); got[len(got)-1] != "4" {
+		t.Fatalf("expected the used entry to become the newest, got %q", got)
+	}
+
+	// the search prompt recalls with Alt+P, as Up selects matches
+	r.Prompts.Add(historySearch, "d")
+	r.Prompts.Add(historySearch, "b")
+	r.Cursor, r.CursorLine = 0, 0
+	r.EventCh <- tcell.NewEventKey(tcell.KeyRune, 'p', tcell.ModAlt)
+	r.EventCh <- tcell.NewEventKey(tcell.KeyRune, 'p', tcell.ModAlt)
+	r.EventCh <- enter
+	r.runSearchPromptCase(true)
+	if r.Cursor != 6 {
+		t.Fatalf("expected the search for d, got cursor %d", r.Cursor)
+	}
+
+	// the command menu selects the recalled command
+	r.Prompts.Add(historyCommand, "go to line")
+	r.EventCh <- up
+	r.EventCh <- enter
+	r.EventCh <- tcell.NewEventKey(tcell.KeyRune, '1', 0)
+	r.EventCh <- enter
+	r.runCommandMenu()
+	if r.CursorLine != 0 {
+		t.Fatalf("expected go to line 1 from the recalled command, got line %d", r.CursorLine+1)
+	}
+}
+
 func TestRunner_CtrlACtrlE(t *testing.T) {
 	r := &Runner{Buf: buffer.NewGapBufferFromString("hello\n"), Cursor: 2, Mode: ModeInsert}
 	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, 'a', tcell.ModCtrl))
@@ -731,7 +1019,7 @@ func TestRunner_VisualYank(t *testing.T) {
 	if r.Mode != ModeNormal {
 		t.Fatalf("expected mode to return to normal after yank")
 	}
-	if r.VisualStart != -1 {
+	if r.visualStart() != -1 {
 		t.Fatalf("expected visual start reset after yank")
 	}
 	if r.Buf.String() != "hello" {
@@ -762,7 +1050,7 @@ func TestRunner_VisualCutWord(t *testing.T) {
 	if r.Mode != ModeNormal {
 		t.Fatalf("expected mode to return to normal after cut")
 	}
-	if r.VisualStart != -1 {
+	if r.visualStart() != -1 {
 		t.Fatalf("expected visual start reset after cut")
 	}
 }
@@ -873,7 +1161,7 @@ func TestVisualModeOpenLine(t *testing.T) {
 	if r.Mode != ModeInsert {
 		t.Fatalf("expected insert mode after 'o'")
 	}
-	if r.VisualStart != -1 {
+	if r.visualStart() != -1 {
 		t.Fatalf("expected visual start reset after 'o'")
 	}
 	if got := r.Buf.String(); got != "hello\n" {
@@ -893,27 +1181,26 @@ func TestRunner_UndoRedo(t *testing.T) {
 	if got := r.Buf.String(); got != "ab" {
 		t.Fatalf("expected 'ab', got %q", got)
 	}
-	// undo -> 'a'
+	// undo -> '': the insert session is one undo group
 	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, 'z', tcell.ModCtrl))
-	if got := r.Buf.String(); got != "a" {
-		t.Fatalf("expected 'a' after undo, got %q", got)
+	if got := r.Buf.String(); got != "" {
+		t.Fatalf("expected '' after undo, got %q", got)
 	}
-	// undo -> ''
+	// typing after an undo starts a new group within the session
+	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, 'c', 0))
 	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, 'z', tcell.ModCtrl))
 	if got := r.Buf.String(); got != "" {
 		t.Fatalf("expected '' after second undo, got %q", got)
 	}
 	// exit insert mode for redo
 	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyEsc, 0, 0))
-	// redo -> 'a'
+	// redo -> 'c', the newest branch
 	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, 'y', tcell.ModCtrl))
-	if got := r.Buf.String(); got != "a" {
-		t.Fatalf("expected 'a' after redo, got %q", got)
+	if got := r.Buf.String(); got != "c" {
+		t.Fatalf("expected 'c' after redo, got %q", got)
 	}
-	// redo -> 'ab'
-	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, 'y', tcell.ModCtrl))
-	if got := r.Buf.String(); got != "ab" {
-		t.Fatalf("expected 'ab' after second redo, got %q", got)
+	if r.Cursor != 1 {
+		t.Fatalf("expected redo to put the cursor after 'c', got %d", r.Cursor)
 	}
 }
 
@@ -928,10 +1215,10 @@ func TestRunner_NormalModeUndoRedoKeys(t *testing.T) {
 	if got := r.Buf.String(); got != "ab" {
 		t.Fatalf("expected buffer 'ab' before undo, got %q", got)
 	}
-	// Undo via normal-mode 'u'
+	// Undo via normal-mode 'u' reverts the whole insert session
 	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, 'u', 0))
-	if got := r.Buf.String(); got != "a" {
-		t.Fatalf("expected 'a' after undo with 'u', got %q", got)
+	if got := r.Buf.String(); got != "" {
+		t.Fatalf("expected '' after undo with 'u', got %q", got)
 	}
 	// Redo via Ctrl+R in normal mode
 	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, 'r', tcell.ModCtrl))
@@ -952,9 +1239,169 @@ func TestRunner_Undo_DedicatedCtrlZ(t *testing.T) {
 	if got := r.Buf.String(); got != "ab" {
 		t.Fatalf("expected 'ab', got %q", got)
 	}
-	// undo via dedicated Ctrl+Z key -> 'a'
+	// undo via dedicated Ctrl+Z key -> ''
 	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyCtrlZ, 0, 0))
-	if got := r.Buf.String(); got != "a" {
-		t.Fatalf("expected 'a' after undo via KeyCtrlZ, got %q", got)
+	if got := r.Buf.String(); got != "" {
+		t.Fatalf("expected '' after undo via KeyCtrlZ, got %q", got)
+	}
+}
+
+func TestRunner_SnapshotReusedUntilEdit(t *testing.T) {
+	r := &Runner{Buf: buffer.NewGapBufferFromString("abc"), History: history.New()}
+	first := r.snapshot()
+	if r.snapshot() != first {
+		t.Fatalf("expected snapshot to be reused without edits")
+	}
+	r.Cursor = 3
+	r.insertText("d")
+	second := r.snapshot()
+	if second == first || second.Version() != r.editSeq {
+		t.Fatalf("expected a new snapshot at edit sequence %d", r.editSeq)
+	}
+	if first.String() != "abc" || second.String() != "abcd" {
+		t.Fatalf("unexpected snapshot contents %q / %q", first.String(), second.String())
+	}
+}
+
+func TestRunner_GrepProject(t *testing.T) {
+	s := tcell.NewSimulationScreen("UTF-8")
+	if err := s.Init(); err != nil {
+		t.Fatalf("init sim: %v", err)
+	}
+	defer s.Fini()
+	s.SetSize(60, 12)
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"a.txt":      "one\ntwo needle\n",
+		"b.txt":      "needle\nx needle\n",
+		"skip.log":   "needle\n",
+		".gitignore": "*.log\n",
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := &Runner{Screen: s, Buf: buffer.NewGapBufferFromString("scratch"), History: history.New(), EventCh: make(chan tcell.Event, 16)}
+	r.startGrep(root, "needle", search.Options{SmartCase: true})
+	for r.grep.running {
+		r.waitEvent()
+	}
+	if !r.isGrepBuffer() || r.grep.stats.Hits != 3 || r.Buf.LineCount() != 5 {
+		t.Fatalf("expected 3 hits in the results buffer, got %+v:\n%s", r.grep.stats, r.Buf.String())
+	}
+	for i := 1; i <= 3; i++ {
+		if _, ok := r.grep.hit(i); !ok {
+			t.Fatalf("line %d is not a hit: %q", i, r.Buf.String())
+		}
+	}
+
+	// Enter on the b.txt:2:3 hit opens the file there
+	line := strings.Index(r.Buf.String(), "b.txt:2:3:")
+	if line < 0 {
+		t.Fatalf("missing hit line in %q", r.Buf.String())
+	}
+	r.Cursor = byteOffsetToRuneIndex(r.Buf.String(), line)
+	r.handleKey(tcell.NewEventKey(tcell.KeyEnter, 0, 0))
+	if filepath.Base(r.FilePath) != "b.txt" || r.Cursor != 9 || r.CursorLine != 1 {
+		t.Fatalf("expected b.txt line 2 col 3, got %q at %d line %d", r.FilePath, r.Cursor, r.CursorLine)
+	}
+
+	// F4 and Shift+F4 step through the hits in the order listed, from
+	// any buffer
+	at := func(line int) {
+		t.Helper()
+		h, _ := r.grep.hit(line)
+		if r.grep.cur != line || filepath.Base(r.FilePath) != h.Path || r.CursorLine != h.Line-1 {
+			t.Fatalf("expected hit %d %+v, got %q line %d", line, h, r.FilePath, r.CursorLine+1)
+		}
+	}
+	h, _ := r.grep.hit(1)
+	r.openGrepHit(1, h)
+	at(1)
+	r.handleKey(tcell.NewEventKey(tcell.KeyF4, 0, 0))
+	r.handleKey(tcell.NewEventKey(tcell.KeyF4, 0, 0))
+	at(3)
+	r.handleKey(tcell.NewEventKey(tcell.KeyF4, 0, tcell.ModShift))
+	at(2)
+}
+
+func TestRunner_GrepEditWriteBack(t *testing.T) {
+	s := tcell.NewSimulationScreen("UTF-8")
+	if err := s.Init(); err != nil {
+		t.Fatalf("init sim: %v", err)
+	}
+	defer s.Fini()
+	s.SetSize(60, 12)
+	root := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	write("a.txt", "one\ntwo needle\n")
+	write("b.txt", "needle\nx needle\n")
+	write("c.txt", "needle\r\n")
+	write("d.txt", "needle\n")
+	write("e.txt", "caf\xe9 needle\n")
+	write("f.txt", "needle\r\nx\nneedle\r\n")
+	write("g.txt", "caf\xe9 needle\r\nx\nneedle\r\n")
+	r := &Runner{Screen: s, Buf: buffer.NewGapBufferFromString("scratch"), History: history.New(), EventCh: make(chan tcell.Event, 16)}
+	r.startGrep(root, "needle", search.Options{SmartCase: true})
+	for r.grep.running {
+		r.waitEvent()
+	}
+
+	// a.txt is open, and d.txt changes on disk after the search
+	if err := r.focusFile(filepath.Join(root, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	r.saveBufferState()
+	r.applyBufferState(r.Ed.Focus(r.grepBufferIndex()))
+	write("d.txt", "needle, changed\n")
+
+	r.replaceRange(0, r.Buf.Len(), strings.ReplaceAll(r.Buf.String(), "needle", "pin"))
+	r.EventCh <- tcell.NewEventKey(tcell.KeyRune, '!', 0)
+	r.EventCh <- tcell.NewEventKey(tcell.KeyEnter, 0, 0)
+	r.handleKey(tcell.NewEventKey(tcell.KeyCtrlS, 0, tcell.ModCtrl))
+
+	if !r.isGrepBuffer() {
+		t.Fatalf("expected the results buffer to keep focus")
+	}
+	if got := read("b.txt"); got != "pin\nx pin\n" {
+		t.Fatalf("b.txt = %q", got)
+	}
+	if got := read("c.txt"); got != "pin\r\n" {
+		t.Fatalf("c.txt = %q", got)
+	}
+	if got := read("e.txt"); got != "caf\xe9 pin\n" {
+		t.Fatalf("Latin-1 e.txt = %q", got)
+	}
+	if got := read("f.txt"); got != "pin\r\nx\npin\r\n" {
+		t.Fatalf("mixed f.txt = %q", got)
+	}
+	if got := read("g.txt"); got != "caf\xe9 pin\r\nx\npin\r\n" {
+		t.Fatalf("mixed Latin-1 g.txt = %q", got)
+	}
+	if got := read("d.txt"); got != "needle, changed\n" {
+		t.Fatalf("conflicting d.txt was written: %q", got)
+	}
+	if got := read("a.txt"); got != "one\ntwo needle\n" {
+		t.Fatalf("open a.txt was written: %q", got)
+	}
+	a := r.Ed.Buffers[r.Ed.Find(filepath.Join(root, "a.txt"))]
+	if got := a.Buf.String(); got != "one\ntwo pin\n" || !a.Dirty {
+		t.Fatalf("expected a.txt changed in its buffer, got %q dirty %v", got, a.Dirty)
+	}
+	if !r.Dirty {
+		t.Fatalf("expected the results to stay modified after a conflict")
 	}
 }
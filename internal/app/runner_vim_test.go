@@ -1,10 +1,15 @@
 package app
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"example.com/texteditor/pkg/buffer"
 	"example.com/texteditor/pkg/history"
+	"example.com/texteditor/pkg/search"
 	"github.com/gdamore/tcell/v2"
 )
 
@@ -121,3 +126,348 @@ func TestHandleKeyEvent_VisualInnerQuotes(t *testing.T) {
 		t.Fatalf("expected visual bounds 5..10 after vi\", got %d..%d", start, end)
 	}
 }
+
+func TestHandleKeyEvent_UndoTreeRecoversOverwrittenRedo(t *testing.T) {
+	r := &Runner{Buf: buffer.NewGapBufferFromString(""), History: history.New()}
+	r.insertText("one")
+	r.insertText(" two")
+	// undo too far, then type: the undone edit stays reachable
+	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, 'u', 0))
+	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, 'u', 0))
+	r.insertText("x")
+	if got := r.Buf.String(); got != "x" {
+		t.Fatalf("expected %q, got %q", "x", got)
+	}
+	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, 'g', 0))
+	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, '-', 0))
+	if got := r.Buf.String(); got != "one two" {
+		t.Fatalf("expected g- to return to %q, got %q", "one two", got)
+	}
+	if err := r.runExCommand("ea 2"); err != nil {
+		t.Fatalf("earlier: %v", err)
+	}
+	if got := r.Buf.String(); got != "" {
+		t.Fatalf("expected original text after :earlier 2, got %q", got)
+	}
+	if err := r.runExCommand("later 10m"); err != nil {
+		t.Fatalf("later: %v", err)
+	}
+	if got := r.Buf.String(); got != "x" {
+		t.Fatalf("expected newest state after :later 10m, got %q", got)
+	}
+	if err := r.runExCommand("earlier 5x"); err == nil {
+		t.Fatalf("expected error for bad amount")
+	}
+}
+
+func TestHandleKeyEvent_UndoRestoresVisualSelection(t *testing.T) {
+	r := &Runner{Buf: buffer.NewGapBufferFromString("one two three"), History: history.New(), Cursor: 4}
+	for _, ch := range "vllx" {
+		r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, ch, 0))
+	}
+	if got := r.Buf.String(); got != "one  three" {
+		t.Fatalf("expected visual cut of two, got %q", got)
+	}
+	r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, 'u', 0))
+	if got := r.Buf.String(); got != "one two three" {
+		t.Fatalf("expected undo to restore text, got %q", got)
+	}
+	if r.Mode != ModeVisual || r.visualStart() != 4 || r.Cursor != 6 {
+		t.Fatalf("expected selection 4..6 restored, got mode %v start %d cursor %d", r.Mode, r.visualStart(), r.Cursor)
+	}
+}
+
+func typeKeys(r *Runner, keys string) {
+	for _, ch := range keys {
+		r.handleKeyEvent(tcell.NewEventKey(tcell.KeyRune, ch, 0))
+	}
+}
+
+func TestHandleKeyEvent_NamedRegisters(t *testing.T) {
+	r := &Runner{Buf: buffer.NewGapBufferFromString("one\ntwo\n"), History: history.New()}
+	typeKeys(r, `"ayyj"_dd`)
+	if got, _ := r.Registers.Get('a'); got != "one\n" {
+		t.Fatalf("expected register a to hold the yanked line, got %q", got)
+	}
+	if got := r.Buf.String(); got != "one\n" {
+		t.Fatalf("expected second line deleted, got %q", got)
+	}
+	if got := r.KillRing.Get(); got != "one\n" {
+		t.Fatalf("black hole delete should leave the kill ring alone, got %q", got)
+	}
+	if _, ok := r.Registers.Get('1'); ok {
+		t.Fatalf("black hole delete should not fill register 1")
+	}
+	typeKeys(r, `ggdd"ap`)
+	if got, _ := r.Registers.Get('1'); got != "one\n" {
+		t.Fatalf("expected unnamed delete in register 1, got %q", got)
+	}
+	if got := r.Buf.String(); got != "one\n" {
+		t.Fatalf("expected paste from register a, got %q", got)
+	}
+	// the register only applies to the command that follows it
+	typeKeys(r, `gg"bxyy`)
+	if got, _ := r.Registers.Get('b'); got != "o" {
+		t.Fatalf("expected register b to hold only the x, got %q", got)
+	}
+	if got, _ := r.Registers.Get('0'); got != "ne\n" {
+		t.Fatalf("expected the following yy in register 0, got %q", got)
+	}
+}
+
+func TestHandleKeyEvent_MarksFollowEdits(t *testing.T) {
+	r := &Runner{Buf: buffer.NewGapBufferFromString("alpha\n  beta\ngamma\n"), History: history.New(), Cursor: 10}
+	typeKeys(r, "ma")
+	_ = r.Buf.Insert(0, []rune("x\n"))
+	typeKeys(r, "gg'a")
+	if r.Cursor != 10 {
+		t.Fatalf("expected 'a on the first non-blank at 10, got %d", r.Cursor)
+	}
+	typeKeys(r, "gg`a")
+	if r.Cursor != 12 {
+		t.Fatalf("expected `a at the exact position 12, got %d", r.Cursor)
+	}
+	typeKeys(r, "ggd'a")
+	if got := r.Buf.String(); got != "gamma\n" {
+		t.Fatalf("expected d'a to delete through the mark's line, got %q", got)
+	}
+	if got, _ := r.Registers.Get('1'); got != "x\nalpha\n  beta\n" {
+		t.Fatalf("expected deleted lines in register 1, got %q", got)
+	}
+}
+
+func TestHandleKeyEvent_FileMarksPersist(t *testing.T) {
+	dir := t.TempDir()
+	f1 := filepath.Join(dir, "one.txt")
+	f2 := filepath.Join(dir, "two.txt")
+	if err := os.WriteFile(f1, []byte("first\nfile\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(f2, []byte("second\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	newRunner := func() *Runner {
+		r := New()
+		r.RegistersPath = filepath.Join(dir, "registers.json")
+		r.MarksPath = filepath.Join(dir, "marks.json")
+		r.LoadState()
+		return r
+	}
+
+	r := newRunner()
+	if err := r.LoadFile(f1); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	r.Cursor = 8
+	typeKeys(r, `mA"byy`)
+	if err := r.LoadFile(f2); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	r.Cursor = 3
+	typeKeys(r, "mbgg'A")
+	if r.FilePath != f1 || r.Cursor != 6 {
+		t.Fatalf("expected 'A to switch to %s at 6, got %s at %d", f1, r.FilePath, r.Cursor)
+	}
+	r.writeState()
+
+	r = newRunner()
+	if err := r.LoadFile(f2); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	typeKeys(r, "gg`b")
+	if r.Cursor != 3 {
+		t.Fatalf("expected mark b restored at 3, got %d", r.Cursor)
+	}
+	typeKeys(r, "`A")
+	if r.FilePath != f1 || r.Cursor != 8 {
+		t.Fatalf("expected `A to load %s at 8, got %s at %d", f1, r.FilePath, r.Cursor)
+	}
+	if got, _ := r.Registers.Get('b'); got != "file\n" {
+		t.Fatalf("expected register b restored, got %q", got)
+	}
+
+	// setting A from another buffer stops the old marker in the first
+	old := r.globalMarks['A'].marker
+	if err := r.LoadFile(f2); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	typeKeys(r, "mA")
+	if old.Pos() >= 0 {
+		t.Fatalf("expected the old mark A removed from %s", f1)
+	}
+}
+
+func TestHandleKeyEvent_ClipboardRegisters(t *testing.T) {
+	dir := t.TempDir()
+	clip := filepath.Join(dir, "clip")
+	r := &Runner{Buf: buffer.NewGapBufferFromString("one\ntwo\n"), History: history.New()}
+	if err := r.SetClipboard("command", "sh -c cat>"+clip, "cat "+clip); err != nil {
+		t.Fatalf("SetClipboard: %v", err)
+	}
+	typeKeys(r, `"+yy`)
+	if data, _ := os.ReadFile(clip); string(data) != "one\n" {
+		t.Fatalf("expected \"+yy to copy the line, got %q", data)
+	}
+	if err := os.WriteFile(clip, []byte("from outside "), 0644); err != nil {
+		t.Fatal(err)
+	}
+	typeKeys(r, `"*P`)
+	if got := r.Buf.String(); got != "from outside one\ntwo\n" {
+		t.Fatalf("expected \"*P to paste the clipboard, got %q", got)
+	}
+	r.ClipboardMirror = true
+	typeKeys(r, "jdd")
+	if data, _ := os.ReadFile(clip); string(data) != "two\n" {
+		t.Fatalf("expected the mirrored delete in the clipboard, got %q", data)
+	}
+}
+
+func TestHandleKeyEvent_ClipboardOSC52(t *testing.T) {
+	s := tcell.NewSimulationScreen("UTF-8")
+	if err := s.Init(); err != nil {
+		t.Fatalf("init sim: %v", err)
+	}
+	defer s.Fini()
+	r := &Runner{Screen: s, Buf: buffer.NewGapBufferFromString("abc"), History: history.New()}
+	if err := r.SetClipboard("osc52", "", ""); err != nil {
+		t.Fatalf("SetClipboard: %v", err)
+	}
+	typeKeys(r, `"+yy`)
+	if got := string(s.GetClipboardData()); got != "abc" {
+		t.Fatalf("expected OSC 52 copy, got %q", got)
+	}
+	// the terminal answers the paste request with an event
+	typeKeys(r, `"+P`)
+	if r.pendingPaste == nil {
+		t.Fatalf("expected a paste waiting for the terminal")
+	}
+	ev, ok := s.PollEvent().(*tcell.EventClipboard)
+	if !ok {
+		t.Fatalf("expected a clipboard event")
+	}
+	r.onClipboard(ev.Data())
+	if got := r.Buf.String(); got != "abcabc" {
+		t.Fatalf("expected the clipboard pasted, got %q", got)
+	}
+}
+
+func TestHandleKeyEvent_SearchMotions(t *testing.T) {
+	s := tcell.NewSimulationScreen("UTF-8")
+	if err := s.Init(); err != nil {
+		t.Fatalf("init sim: %v", err)
+	}
+	defer s.Fini()
+	s.SetSize(60, 12)
+	r := &Runner{Screen: s, Buf: buffer.NewGapBufferFromString("foo bar\nbaz foo\nfoo qux"), History: history.New(), EventCh: make(chan tcell.Event, 16)}
+	prompt := func(keys string) {
+		for _, ch := range keys {
+			r.EventCh <- tcell.NewEventKey(tcell.KeyRune, ch, 0)
+		}
+		r.EventCh <- tcell.NewEventKey(tcell.KeyEnter, 0, 0)
+	}
+
+	prompt("foo")
+	typeKeys(r, "/")
+	if r.Cursor != 12 || r.CursorLine != 1 {
+		t.Fatalf("expected / to move to the next foo at 12, got %d", r.Cursor)
+	}
+	if got := r.searchCounter(); got != "[2/3]" {
+		t.Fatalf("expected counter [2/3], got %q", got)
+	}
+	current := 0
+	for _, h := range r.renderSnapshot(nil).highlights {
+		if h.Group == "bg.search.current" && h.Start == 12 {
+			current++
+		}
+	}
+	if current != 1 {
+		t.Fatalf("expected the match under the cursor highlighted as current")
+	}
+	typeKeys(r, "n")
+	if r.Cursor != 16 {
+		t.Fatalf("expected n at 16, got %d", r.Cursor)
+	}
+	typeKeys(r, "n")
+	if r.Cursor != 0 {
+		t.Fatalf("expected n to wrap to 0, got %d", r.Cursor)
+	}
+	typeKeys(r, "N")
+	if r.Cursor != 16 {
+		t.Fatalf("expected N to wrap back to 16, got %d", r.Cursor)
+	}
+	typeKeys(r, "2N")
+	if r.Cursor != 0 {
+		t.Fatalf("expected 2N at 0, got %d", r.Cursor)
+	}
+
+	if err := r.runExCommand("noh"); err != nil {
+		t.Fatalf("noh: %v", err)
+	}
+	if r.searchCounter() != "" || len(r.hlsearchHighlights(r.Buf.Lines(), 0)) != 0 {
+		t.Fatalf("expected :noh to hide the matches")
+	}
+	typeKeys(r, "n")
+	if !r.hlsearch || r.Cursor != 12 {
+		t.Fatalf("expected n to show the matches again, cursor %d", r.Cursor)
+	}
+
+	// * and # search for the word under the cursor
+	r.Cursor = 13
+	typeKeys(r, "*")
+	if r.Cursor != 16 || r.lastSearch.pattern != "foo" {
+		t.Fatalf("expected * to find the next foo at 16, got %d %q", r.Cursor, r.lastSearch.pattern)
+	}
+	r.Cursor = 5
+	typeKeys(r, "#")
+	if r.Cursor != 4 || r.lastSearch.pattern != "bar" {
+		t.Fatalf("expected # on the only bar to wrap to itself, got %d", r.Cursor)
+	}
+	r.Cursor = 13
+	typeKeys(r, "#")
+	if r.Cursor != 0 {
+		t.Fatalf("expected # to go to the previous foo at 0, got %d", r.Cursor)
+	}
+
+	// search as an operator motion
+	prompt("qux")
+	typeKeys(r, "d/")
+	if got := r.Buf.String(); got != "qux" {
+		t.Fatalf("expected d/qux to delete up to qux, got %q", got)
+	}
+}
+
+func TestRunner_HlsearchLargeBuffer(t *testing.T) {
+	s := tcell.NewSimulationScreen("UTF-8")
+	if err := s.Init(); err != nil {
+		t.Fatalf("init sim: %v", err)
+	}
+	defer s.Fini()
+	s.SetSize(60, 12)
+	filler := strings.Repeat("lorem ipsum dolor\n", asyncSearchSize/18+1000)
+	r := &Runner{Screen: s, Buf: buffer.NewGapBufferFromString("foo\n" + filler + "foo\n"), History: history.New(), EventCh: make(chan tcell.Event, 16)}
+	r.lastSearch = &vimSearch{pattern: "foo", opt: search.Options{SmartCase: true}}
+	r.hlsearch = true
+
+	// a draw only searches the lines on screen and leaves the buffer to a
+	// background search
+	hs := r.renderSnapshot(nil).highlights
+	if len(hs) != 1 || hs[0].Start != 0 || hs[0].Group != "bg.search.current" {
+		t.Fatalf("expected the match on screen highlighted, got %v", hs)
+	}
+	if got := r.searchCounter(); got != "" {
+		t.Fatalf("expected no counter before the search is done, got %q", got)
+	}
+	select {
+	case ev := <-r.EventCh:
+		res, ok := ev.(*tcell.EventInterrupt).Data().(hlsearchResult)
+		if !ok {
+			t.Fatalf("expected the search result, got %v", ev)
+		}
+		r.applyHlsearchResult(res)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("background search did not finish")
+	}
+	if got := r.searchCounter(); got != "[1/2]" {
+		t.Fatalf("expected counter [1/2], got %q", got)
+	}
+}
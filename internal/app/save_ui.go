@@ -3,6 +3,7 @@ package app
 import (
 	"os"
 
+	"example.com/texteditor/pkg/editor"
 	"github.com/gdamore/tcell/v2"
 )
 
@@ -11,6 +12,10 @@ func (r *Runner) SaveAs(path string) error {
 	if path == "" {
 		return os.ErrInvalid
 	}
+	if path != r.FilePath {
+		// the loaded version only guards the file it came from
+		r.Disk = editor.DiskInfo{}
+	}
 	r.FilePath = path
 	return r.Save()
 }
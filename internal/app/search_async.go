@@ -0,0 +1,223 @@
+package app
+
+import (
+	"context"
+	"sort"
+
+	"example.com/texteditor/pkg/buffer"
+	"example.com/texteditor/pkg/search"
+	"github.com/gdamore/tcell/v2"
+)
+
+// asyncSearchSize is the buffer size from which the incremental search
+// prompts search in the background; smaller buffers are searched between
+// keys.
+const asyncSearchSize = 1 << 20
+
+// searchBatch is the payload of the interrupt event carrying a batch of
+// matches from a background search to its prompt.
+type searchBatch struct {
+	owner *incSearch
+	gen   int
+	search.Batch
+}
+
+// hlsearchJob is a background search for the matches of the last search in
+// one version of a large buffer, which search highlighting shows.
+type hlsearchJob struct {
+	buf    buffer.TextStorage
+	seq    int64
+	search vimSearch
+	cancel context.CancelFunc
+}
+
+// hlsearchResult is the payload of the interrupt event carrying the
+// matches an hlsearchJob found.
+type hlsearchResult struct {
+	job    *hlsearchJob
+	text   string
+	ranges []search.Range
+	err    error
+}
+
+// incSearch keeps the matches of an incremental search prompt up to date as
+// the query changes. Large buffers are searched off the UI goroutine: the
+// matches on screen arrive first, then the rest as the search goes through
+// the buffer, and a changed query cancels the search still running.
+type incSearch struct {
+	r      *Runner
+	query  string
+	opt    search.Options
+	gen    int // bumped by each new search, so stale batches are dropped
+	cancel context.CancelFunc
+
+	ranges  []search.Range // matches to show; only those on screen while running
+	found   []search.Range // matches found so far by a running search
+	err     error
+	running bool
+}
+
+// update starts searching for query with opt unless that is the search
+// already done or running.
+func (s *incSearch) update(query string, opt search.Options) {
+	if s.gen > 0 && query == s.query && opt == s.opt {
+		return
+	}
+	s.stop()
+	s.gen++
+	s.query, s.opt = query, opt
+	s.ranges, s.found, s.err = nil, nil, nil
+	if query == "" {
+		return
+	}
+	snap := s.r.snapshot()
+	if snap.Len() < asyncSearchSize {
+		s.ranges, s.err = search.Find(snap.String(), query, opt)
+		return
+	}
+	lo, hi := s.r.viewportBytes()
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.running = true
+	owner, gen := s, s.gen
+	go func() {
+		// the text is built here rather than on the UI goroutine
+		search.Stream(ctx, snap.String(), query, opt, lo, hi, func(b search.Batch) {
+			s.r.postEvent(ctx, tcell.NewEventInterrupt(searchBatch{owner: owner, gen: gen, Batch: b}))
+		})
+	}()
+}
+
+// handle applies ev if it carries matches for this prompt. It reports
+// whether ev was a batch of matches, current or not.
+func (s *incSearch) handle(ev tcell.Event) bool {
+	iev, ok := ev.(*tcell.EventInterrupt)
+	if !ok {
+		return false
+	}
+	b, ok := iev.Data().(searchBatch)
+	if !ok {
+		return false
+	}
+	if b.owner != s || b.gen != s.gen {
+		return true
+	}
+	switch {
+	case b.Preview:
+		s.ranges = b.Ranges
+	case b.Done:
+		s.ranges = append(s.found, b.Ranges...)
+		s.found, s.err, s.running = nil, b.Err, false
+		s.cancel()
+		s.cancel = nil
+		if s.r.Logger != nil {
+			s.r.Logger.Event("search.done", map[string]any{"query": s.query, "matches": b.Total})
+		}
+	default:
+		s.found = append(s.found, b.Ranges...)
+	}
+	return true
+}
+
+// stop cancels a running search.
+func (s *incSearch) stop() {
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	s.running = false
+}
+
+// indexOf returns the index of the match starting at byte offset start, or
+// -1.
+func (s *incSearch) indexOf(start int) int {
+	i := sort.Search(len(s.ranges), func(i int) bool { return s.ranges[i].Start >= start })
+	if i < len(s.ranges) && s.ranges[i].Start == start {
+		return i
+	}
+	return -1
+}
+
+// shownSearchMatches returns the matches of the last search for drawing. A
+// large buffer is searched in the background instead of on each draw after
+// an edit, so ok is false until its matches are in.
+func (r *Runner) shownSearchMatches() (ranges []search.Range, ok bool) {
+	if r.searchCached() {
+		return r.searchCache.ranges, true
+	}
+	snap := r.snapshot()
+	if snap.Len() < asyncSearchSize {
+		_, ranges, _ = r.searchMatches()
+		return ranges, true
+	}
+	j := r.hlsearchJob
+	if j != nil && j.buf == r.Buf && j.seq == r.editSeq && j.search == *r.lastSearch {
+		return nil, false
+	}
+	if j != nil {
+		j.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j = &hlsearchJob{buf: r.Buf, seq: r.editSeq, search: *r.lastSearch, cancel: cancel}
+	r.hlsearchJob = j
+	go func() {
+		res := hlsearchResult{job: j, text: snap.String()}
+		err := search.Stream(ctx, res.text, j.search.pattern, j.search.opt, 0, 0, func(b search.Batch) {
+			res.ranges = append(res.ranges, b.Ranges...)
+			res.err = b.Err
+		})
+		if err == nil {
+			r.postEvent(ctx, tcell.NewEventInterrupt(res))
+		}
+	}()
+	return nil, false
+}
+
+// applyHlsearchResult keeps the matches of the current hlsearchJob for the
+// version of the buffer it searched. A job that failed stays current, so it
+// is not started again for that version.
+func (r *Runner) applyHlsearchResult(res hlsearchResult) {
+	j := res.job
+	if j != r.hlsearchJob {
+		return
+	}
+	j.cancel()
+	if res.err == nil {
+		r.searchCache = searchMatchCache{buf: j.buf, seq: j.seq, search: j.search, text: res.text, ranges: res.ranges}
+	}
+}
+
+// viewportBytes returns the bytes of the buffer shown on screen as
+// [lo, hi). It reads the buffer's own line index; a snapshot would build
+// a line table of the whole text.
+func (r *Runner) viewportBytes() (lo, hi int) {
+	maxLines := r.Buf.LineCount()
+	if r.Screen != nil {
+		_, height := r.Screen.Size()
+		maxLines = height - 1 - len(r.MiniBuf)
+	}
+	lines, lo, _ := visibleLines(r.Buf, r.TopLine, maxLines)
+	hi = lo
+	for _, l := range lines {
+		hi += len(l) + 1
+	}
+	return lo, hi
+}
+
+// postEvent hands ev from another goroutine to whichever loop is reading
+// events, giving up once ctx is cancelled.
+func (r *Runner) postEvent(ctx context.Context, ev tcell.Event) {
+	if ctx.Err() != nil {
+		return
+	}
+	if r.EventCh != nil {
+		select {
+		case r.EventCh <- ev:
+		case <-ctx.Done():
+		}
+		return
+	}
+	if r.Screen != nil {
+		_ = r.Screen.PostEvent(ev)
+	}
+}
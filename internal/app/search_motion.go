@@ -0,0 +1,335 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"example.com/texteditor/pkg/buffer"
+	"example.com/texteditor/pkg/search"
+	"github.com/gdamore/tcell/v2"
+)
+
+// vimSearch is the last search made with /, ?, * or #, which n and N
+// repeat.
+type vimSearch struct {
+	pattern  string
+	opt      search.Options
+	backward bool
+}
+
+// searchMatchCache keeps the matches of the last search for one version of
+// one buffer, so redraws and n do not search again.
+type searchMatchCache struct {
+	buf    buffer.TextStorage
+	seq    int64
+	search vimSearch
+	text   string
+	ranges []search.Range
+}
+
+// handleSearchKeys handles the search keys of normal and visual mode: / and
+// ? prompt for a pattern, n and N repeat the last search, * and # search
+// for the word under the cursor. With an operator pending the search is its
+// motion, so d/foo deletes up to the next "foo".
+func (r *Runner) handleSearchKeys(ev *tcell.EventKey) bool {
+	if r.Mode != ModeNormal && r.Mode != ModeVisual || r.Buf == nil {
+		return false
+	}
+	if r.macroPendingRecord || r.macroPendingPlay || r.macroRepeatAwaitAt {
+		return false
+	}
+	if ev.Key() != tcell.KeyRune || ev.Modifiers() != 0 || r.PendingTextObject {
+		return false
+	}
+	switch ev.Rune() {
+	case '/', '?':
+		r.PendingG = false
+		count := r.consumeCount()
+		backward := ev.Rune() == '?'
+		pattern, ok := r.readSearchPattern(backward)
+		if !ok {
+			r.cancelOperator()
+			return true
+		}
+		s := vimSearch{pattern: pattern, opt: search.Options{Regex: true, SmartCase: true}, backward: backward}
+		if pattern == "" {
+			// an empty pattern repeats the last one
+			if r.lastSearch == nil {
+				r.cancelOperator()
+				return true
+			}
+			s.pattern, s.opt = r.lastSearch.pattern, r.lastSearch.opt
+		}
+		r.lastSearch = &s
+		r.searchMotion(count, false, r.Cursor)
+	case 'n', 'N':
+		r.PendingG = false
+		count := r.consumeCount()
+		if r.lastSearch == nil {
+			r.cancelOperator()
+			r.showDialog("No previous search")
+			return true
+		}
+		r.searchMotion(count, ev.Rune() == 'N', r.Cursor)
+	case '*', '#':
+		r.PendingG = false
+		count := r.consumeCount()
+		start, end := r.wordUnderCursor()
+		if start == end {
+			r.cancelOperator()
+			r.showDialog("No word under cursor")
+			return true
+		}
+		word := string(r.Buf.Slice(start, end))
+		r.lastSearch = &vimSearch{pattern: word, opt: search.Options{CaseSensitive: true, WholeWord: true}, backward: ev.Rune() == '#'}
+		// start from the word so # skips the occurrence under the cursor
+		r.searchMotion(count, false, start)
+	default:
+		return false
+	}
+	return true
+}
+
+// wordUnderCursor returns the bounds of the word under the cursor, or of
+// the next word on the line, as runes. start == end if there is none.
+func (r *Runner) wordUnderCursor() (start, end int) {
+	n := r.Buf.Len()
+	pos := r.Cursor
+	for pos < n && !buffer.IsWordRune(r.Buf.RuneAt(pos)) {
+		if r.Buf.RuneAt(pos) == '\n' {
+			return pos, pos
+		}
+		pos++
+	}
+	if pos >= n {
+		return pos, pos
+	}
+	start, end = pos, pos
+	for start > 0 && buffer.IsWordRune(r.Buf.RuneAt(start-1)) {
+		start--
+	}
+	for end < n && buffer.IsWordRune(r.Buf.RuneAt(end)) {
+		end++
+	}
+	return start, end
+}
+
+// searchMotion moves to the count'th match of the last search from rune
+// offset from, wrapping at either end of the buffer, or applies the
+// pending operator up to it. reverse flips the search direction, as N does.
+func (r *Runner) searchMotion(count int, reverse bool, from int) {
+	s := r.lastSearch
+	text, ranges, err := r.searchMatches()
+	if err != nil || len(ranges) == 0 {
+		r.cancelOperator()
+		if err != nil {
+			r.showDialog(searchErrorLine(err))
+		} else {
+			r.showDialog("Pattern not found: " + s.pattern)
+		}
+		return
+	}
+	backward := s.backward != reverse
+	pos := r.Buf.ByteOffset(from)
+	for i := 0; i < count; i++ {
+		pos = nextSearchMatch(ranges, pos, backward)
+	}
+	target := byteOffsetToRuneIndex(text, pos)
+	r.hlsearch = true
+	if r.Logger != nil {
+		r.Logger.Event("action", map[string]any{"name": "search.motion", "pattern": s.pattern, "backward": backward, "cursor": target})
+	}
+	if r.operatorPending() {
+		r.operateToMark(target, false)
+		return
+	}
+	r.Cursor = target
+	r.recomputeCursorLine()
+	if r.Screen != nil {
+		r.draw(nil)
+	}
+}
+
+// nextSearchMatch returns the start of the first match after byte offset
+// pos, or the last one before it when backward, wrapping around.
+func nextSearchMatch(ranges []search.Range, pos int, backward bool) int {
+	if backward {
+		i := sort.Search(len(ranges), func(i int) bool { return ranges[i].Start >= pos })
+		if i == 0 {
+			i = len(ranges)
+		}
+		return ranges[i-1].Start
+	}
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].Start > pos })
+	if i == len(ranges) {
+		i = 0
+	}
+	return ranges[i].Start
+}
+
+// searchMatches returns the buffer text and the matches of the last search
+// in it as byte ranges.
+func (r *Runner) searchMatches() (string, []search.Range, error) {
+	if r.lastSearch == nil || r.Buf == nil {
+		return "", nil, nil
+	}
+	if c := &r.searchCache; r.searchCached() {
+		return c.text, c.ranges, nil
+	}
+	text := r.snapshot().String()
+	ranges, err := search.Find(text, r.lastSearch.pattern, r.lastSearch.opt)
+	if err != nil {
+		return text, nil, err
+	}
+	r.searchCache = searchMatchCache{buf: r.Buf, seq: r.editSeq, search: *r.lastSearch, text: text, ranges: ranges}
+	return text, ranges, nil
+}
+
+// searchCached reports whether searchCache holds the matches of the last
+// search in the current version of the buffer.
+func (r *Runner) searchCached() bool {
+	c := &r.searchCache
+	return c.buf == r.Buf && c.seq == r.editSeq && c.search == *r.lastSearch
+}
+
+// hlsearchHighlights returns the matches of the last search on the lines
+// shown, which start at byte lo, the one under the cursor as the current
+// match. They stay until :nohlsearch, or the next search shows them again.
+func (r *Runner) hlsearchHighlights(lines []string, lo int) []search.Range {
+	if !r.hlsearch || r.View == ViewFileManager || r.Buf == nil {
+		return nil
+	}
+	view := strings.Join(lines, "\n")
+	hi := lo + len(view) + 1
+	ranges, ok := r.shownSearchMatches()
+	if !ok {
+		// until the background search is done only the lines shown are
+		// searched
+		ranges, _ = search.Find(view, r.lastSearch.pattern, r.lastSearch.opt)
+		for i := range ranges {
+			ranges[i].Start += lo
+			ranges[i].End += lo
+		}
+	}
+	if len(ranges) == 0 {
+		return nil
+	}
+	cur := r.searchMatchAtCursor(ranges)
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].End > lo })
+	var out []search.Range
+	for ; i < len(ranges) && ranges[i].Start < hi; i++ {
+		group := "bg.search"
+		if i == cur {
+			group = "bg.search.current"
+		}
+		out = append(out, search.Range{Start: ranges[i].Start, End: ranges[i].End, Group: group})
+	}
+	return out
+}
+
+// searchMatchAtCursor returns the index of the match the cursor is on, or
+// -1.
+func (r *Runner) searchMatchAtCursor(ranges []search.Range) int {
+	pos := r.Buf.ByteOffset(r.Cursor)
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].End > pos })
+	if i < len(ranges) && ranges[i].Start <= pos {
+		return i
+	}
+	return -1
+}
+
+// searchCounter returns "[3/17]" for the cursor on the third of 17 matches
+// while search highlighting is on, and "" otherwise or while the buffer is
+// still being searched.
+func (r *Runner) searchCounter() string {
+	if !r.hlsearch || r.Buf == nil || r.View == ViewFileManager {
+		return ""
+	}
+	ranges, ok := r.shownSearchMatches()
+	if !ok {
+		return ""
+	}
+	i := r.searchMatchAtCursor(ranges)
+	if i < 0 {
+		return ""
+	}
+	return fmt.Sprintf("[%d/%d]", i+1, len(ranges))
+}
+
+// noHighlightSearch hides the search highlights until the next search.
+func (r *Runner) noHighlightSearch() {
+	r.hlsearch = false
+	if r.Screen != nil {
+		r.draw(nil)
+	}
+}
+
+// readSearchPattern reads the pattern of a / or ? search in the mini-buffer,
+// highlighting its matches as it is typed. It returns false when cancelled.
+func (r *Runner) readSearchPattern(backward bool) (string, bool) {
+	prefix := "/"
+	if backward {
+		prefix = "?"
+	}
+	opt := search.Options{Regex: true, SmartCase: true}
+	input := ""
+	recall := r.Prompts.Recall(historySearch)
+	inc := &incSearch{r: r}
+	defer inc.stop()
+	for {
+		lines := []string{prefix + input}
+		var highlights []search.Range
+		inc.update(input, opt)
+		raw := inc.ranges
+		switch {
+		case inc.err != nil:
+			lines = append(lines, searchErrorLine(inc.err))
+		case inc.running:
+			lines = append(lines, fmt.Sprintf("Searching… %d matches so far", len(inc.found)))
+		}
+		if len(raw) > 0 {
+			next := nextSearchMatch(raw, r.Buf.ByteOffset(r.Cursor), backward)
+			cur := sort.Search(len(raw), func(i int) bool { return raw[i].Start >= next })
+			highlights = buildSearchHighlights(raw, cur)
+		}
+		r.setMiniBuffer(lines)
+		r.draw(highlights)
+
+		ev := r.waitEvent()
+		if ev == nil {
+			r.clearMiniBuffer()
+			return "", false
+		}
+		if inc.handle(ev) {
+			continue
+		}
+		kev, ok := ev.(*tcell.EventKey)
+		if !ok {
+			continue
+		}
+		switch {
+		case r.isCancelKey(kev):
+			r.clearMiniBuffer()
+			r.draw(nil)
+			return "", false
+		case recallKey(recall, kev, &input, true):
+		case kev.Key() == tcell.KeyEnter:
+			r.clearMiniBuffer()
+			r.Prompts.Add(historySearch, input)
+			return input, true
+		case kev.Key() == tcell.KeyBackspace || kev.Key() == tcell.KeyBackspace2:
+			if input == "" {
+				r.clearMiniBuffer()
+				r.draw(nil)
+				return "", false
+			}
+			runes := []rune(input)
+			input = string(runes[:len(runes)-1])
+			recall.Reset()
+		case kev.Key() == tcell.KeyRune && kev.Modifiers()&^tcell.ModShift == 0:
+			input += string(kev.Rune())
+			recall.Reset()
+		}
+	}
+}
@@ -15,7 +15,11 @@ func (r *Runner) runSearchPrompt() {
 	r.runSearchPromptCase(true)
 }
 
-// runSearchPromptCase runs the search prompt with optional case sensitivity.
+// runSearchPromptCase runs the search prompt. With caseSensitive false the
+// search is smart-case: it ignores case until the query has an upper-case
+// letter. Inside the prompt Alt+R toggles regular expressions, Alt+W whole
+// words and Alt+C between case-sensitive and smart-case; the regex and
+// whole-word settings are kept for the next search.
 func (r *Runner) runSearchPromptCase(caseSensitive bool) {
 	if r.Screen == nil {
 		return
@@ -25,12 +29,33 @@ func (r *Runner) runSearchPromptCase(caseSensitive bool) {
 	defer func() { r.Overlay = OverlayNone }()
 	query := ""
 	sel := 0 // selected match index within current results
-	for {
-		text := r.Buf.String()
-		var raw []search.Range
-		if query != "" {
-			raw = search.SearchAllCase(text, query, caseSensitive)
+	// Up and Down select matches, so history is on Alt+P and Alt+N
+	recall := r.Prompts.Recall(historySearch)
+	inc := &incSearch{r: r}
+	defer inc.stop()
+	pending := false // Enter was pressed before the search found a match
+	accept := func(text string, m search.Range) {
+		r.Prompts.Add(historySearch, query)
+		// move cursor to start of match (convert bytes->runes)
+		r.Cursor = byteOffsetToRuneIndex(text, m.Start)
+		// update CursorLine from byte position (count newlines before start)
+		prefix := text[:m.Start]
+		count := 0
+		for i := 0; i < len(prefix); i++ {
+			if prefix[i] == '\n' {
+				count++
+			}
 		}
+		r.CursorLine = count
+		// after jumping we redraw and return
+		r.clearMiniBuffer()
+		r.draw(nil)
+	}
+	for {
+		opt := search.Options{Regex: r.searchRegex, WholeWord: r.searchWord, CaseSensitive: caseSensitive, SmartCase: true}
+		text := r.snapshot().String()
+		inc.update(query, opt)
+		raw, err := inc.ranges, inc.err
 		// compute default selection relative to cursor when needed
 		if query == "" || len(raw) == 0 {
 			sel = 0
@@ -48,41 +73,71 @@ func (r *Runner) runSearchPromptCase(caseSensitive bool) {
 		ranges := buildSearchHighlights(raw, sel)
 
 		// build minibuffer lines with match list (show up to 10)
-		lines := []string{"Search: " + query}
-		if query != "" {
-			if len(raw) > 0 {
+		lines := []string{searchPromptLabel(opt, query) + ": " + query}
+		switch {
+		case query == "":
+			lines = append(lines, "Alt+R regex  Alt+W whole word  Alt+C case")
+		case err != nil:
+			lines = append(lines, searchErrorLine(err))
+		case len(raw) > 0 || inc.running:
+			if inc.running {
+				// the matches on screen are listed until the count is known
+				lines = append(lines, fmt.Sprintf("Searching… %d matches so far", len(inc.found)))
+			} else {
 				lines = append(lines, fmt.Sprintf("%d matches; use Ctrl+N/P or arrows", len(raw)))
-				// show matches
-				max := len(raw)
-				if max > 10 {
-					max = 10
+			}
+			// show matches
+			max := len(raw)
+			if max > 10 {
+				max = 10
+			}
+			// prepare optional width for truncation
+			width, _ := r.Screen.Size()
+			for i := 0; i < max; i++ {
+				m := raw[i]
+				entry := buildSearchPromptLine(text, m, i == sel)
+				if i == sel {
+					entry += formatCaptures(search.Captures(text, m))
 				}
-				// prepare optional width for truncation
-				width, _ := r.Screen.Size()
-				for i := 0; i < max; i++ {
-					m := raw[i]
-					entry := buildSearchPromptLine(text, m, i == sel)
-					// truncate to screen width
-					if width > 0 {
-						if rw := []rune(entry); len(rw) > width {
-							entry = string(rw[:width])
-						}
+				// truncate to screen width
+				if width > 0 {
+					if rw := []rune(entry); len(rw) > width {
+						entry = string(rw[:width])
 					}
-					lines = append(lines, entry)
 				}
-				if len(raw) > 10 {
-					lines = append(lines, fmt.Sprintf("  … and %d more", len(raw)-10))
-				}
-			} else {
-				lines = append(lines, "No matches")
+				lines = append(lines, entry)
+			}
+			if len(raw) > 10 {
+				lines = append(lines, fmt.Sprintf("  … and %d more", len(raw)-10))
 			}
+		default:
+			lines = append(lines, "No matches")
 		}
 		r.setMiniBuffer(lines)
 		r.draw(ranges)
 
 		ev := r.waitEvent()
 		switch ev := ev.(type) {
+		case *tcell.EventInterrupt:
+			// keep the selected match selected as the results fill in
+			at := -1
+			if sel >= 0 && sel < len(raw) {
+				at = raw[sel].Start
+			}
+			if !inc.handle(ev) {
+				continue
+			}
+			sel = inc.indexOf(at) // -1 selects from the cursor
+			if pending && !inc.running {
+				pending = false
+				if len(inc.ranges) > 0 {
+					text := r.snapshot().String()
+					accept(text, inc.ranges[search.SearchNext(inc.ranges, runeIndexToByteOffset(text, r.Cursor))])
+					return
+				}
+			}
 		case *tcell.EventKey:
+			pending = false
 			// Cancel
 			if r.isCancelKey(ev) {
 				// redraw main view without highlights
@@ -99,27 +154,34 @@ func (r *Runner) runSearchPromptCase(caseSensitive bool) {
 					return
 				}
 				if len(raw) == 0 {
+					// a background search may still find one
+					pending = inc.running
 					continue
 				}
-				idx := sel
-				if idx >= 0 && idx < len(raw) {
-					// move cursor to start of match (convert bytes->runes)
-					r.Cursor = byteOffsetToRuneIndex(text, raw[idx].Start)
-					// update CursorLine from byte position (count newlines before start)
-					prefix := text[:raw[idx].Start]
-					count := 0
-					for i := 0; i < len(prefix); i++ {
-						if prefix[i] == '\n' {
-							count++
-						}
-					}
-					r.CursorLine = count
-					// after jumping we redraw and return
-					r.clearMiniBuffer()
-					r.draw(nil)
+				if sel >= 0 && sel < len(raw) {
+					accept(text, raw[sel])
 					return
 				}
 			}
+			if recallKey(recall, ev, &query, false) {
+				sel = -1
+				continue
+			}
+			// Toggles keep the query and reselect from the cursor
+			if ev.Key() == tcell.KeyRune && ev.Modifiers() == tcell.ModAlt {
+				switch ev.Rune() {
+				case 'r':
+					r.searchRegex = !r.searchRegex
+				case 'w':
+					r.searchWord = !r.searchWord
+				case 'c':
+					caseSensitive = !caseSensitive
+				default:
+					continue
+				}
+				sel = -1
+				continue
+			}
 			// Navigation: Ctrl+P/Up and Ctrl+N/Down
 			if (ev.Key() == tcell.KeyCtrlP) || (ev.Key() == tcell.KeyUp) || (ev.Key() == tcell.KeyRune && ev.Rune() == 'p' && ev.Modifiers() == tcell.ModCtrl) {
 				if len(raw) > 0 {
@@ -135,10 +197,11 @@ func (r *Runner) runSearchPromptCase(caseSensitive bool) {
 			}
 			// Backspace
 			if ev.Key() == tcell.KeyBackspace || ev.Key() == tcell.KeyBackspace2 {
-				if len(query) > 0 {
-					query = query[:len(query)-1]
+				if rs := []rune(query); len(rs) > 0 {
+					query = string(rs[:len(rs)-1])
 					sel = 0
 				}
+				recall.Reset()
 				continue
 			}
 			// Type
@@ -146,6 +209,7 @@ func (r *Runner) runSearchPromptCase(caseSensitive bool) {
 				query += string(ev.Rune())
 				// recompute selection to first/next match
 				sel = 0
+				recall.Reset()
 				continue
 			}
 		}
@@ -1,7 +1,10 @@
 package app
 
 import (
+	"errors"
 	"fmt"
+	"regexp/syntax"
+	"strings"
 
 	"example.com/texteditor/pkg/search"
 )
@@ -32,3 +35,42 @@ func buildSearchPromptLine(text string, match search.Range, selected bool) strin
 	}
 	return fmt.Sprintf("%s%d: %q", prefixStr, ln, text[match.Start:match.End])
 }
+
+// searchPromptLabel names the search and the options in effect, e.g.
+// "Search (regex, whole word, smart case)".
+func searchPromptLabel(opt search.Options, query string) string {
+	var flags []string
+	if opt.Regex {
+		flags = append(flags, "regex")
+	}
+	if opt.WholeWord {
+		flags = append(flags, "whole word")
+	}
+	switch {
+	case opt.CaseSensitive:
+		flags = append(flags, "match case")
+	case !opt.FoldCase(query):
+		flags = append(flags, "smart case: match case")
+	default:
+		flags = append(flags, "smart case")
+	}
+	return "Search (" + strings.Join(flags, ", ") + ")"
+}
+
+// searchErrorLine explains why a regular expression does not compile.
+func searchErrorLine(err error) string {
+	var serr *syntax.Error
+	if errors.As(err, &serr) {
+		return fmt.Sprintf("Invalid pattern: %s: `%s`", serr.Code, serr.Expr)
+	}
+	return "Invalid pattern: " + err.Error()
+}
+
+// formatCaptures lists the capture groups of the selected match as $1, $2…
+func formatCaptures(groups []string) string {
+	var b strings.Builder
+	for i, g := range groups {
+		fmt.Fprintf(&b, "  $%d=%q", i+1, g)
+	}
+	return b.String()
+}
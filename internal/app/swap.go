@@ -0,0 +1,214 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"example.com/texteditor/pkg/buffer"
+	"example.com/texteditor/pkg/editor"
+	"example.com/texteditor/pkg/swap"
+)
+
+// swapCompactAfter is the number of journaled edits after which a swap file
+// is rewritten with the current text as its new base.
+const swapCompactAfter = 5000
+
+// swapJournal tracks the swap file of one dirty buffer. Edits reach pending
+// through the storage's change listener and are appended on the next flush.
+type swapJournal struct {
+	buf      buffer.TextStorage
+	w        *swap.Writer
+	pending  []buffer.Change
+	appended int
+}
+
+// openBuffers returns every buffer with its current state; the focused one
+// is taken from the runner rather than the possibly stale editor copy.
+func (r *Runner) openBuffers() []editor.BufferState {
+	live := r.bufferState()
+	if r.View == ViewFileManager && r.FileManager != nil {
+		live = r.FileManager.Return
+	}
+	if r.Ed == nil || len(r.Ed.Buffers) == 0 {
+		return []editor.BufferState{live}
+	}
+	out := append([]editor.BufferState(nil), r.Ed.Buffers...)
+	out[r.Ed.Current] = live
+	return out
+}
+
+func (r *Runner) swapHeader(bs editor.BufferState) swap.Header {
+	return swap.Header{Path: bs.FilePath, PID: os.Getpid(), Encoding: bs.Encoding.String(), Created: time.Now()}
+}
+
+// flushSwaps runs on every tick and writes pending edits of dirty buffers to their swap files,
+// starting a journal for buffers that became dirty and removing the swap
+// files of buffers that were saved or closed.
+func (r *Runner) flushSwaps() {
+	if r.SwapDir == "" {
+		return
+	}
+	dirty := map[buffer.TextStorage]editor.BufferState{}
+	for _, bs := range r.openBuffers() {
+		if bs.Buf != nil && bs.Dirty && bs.FilePath != "" {
+			dirty[bs.Buf] = bs
+		}
+	}
+	// remove stale journals first: a replaced buffer for the same file
+	// reuses the swap path
+	for buf := range r.swaps {
+		if _, ok := dirty[buf]; !ok {
+			r.dropSwap(buf)
+		}
+	}
+	for buf, bs := range dirty {
+		j := r.swaps[buf]
+		if j != nil && j.appended+len(j.pending) < swapCompactAfter {
+			if err := j.w.Append(j.pending); err != nil {
+				r.logSwapError(bs.FilePath, err)
+				continue
+			}
+			j.appended += len(j.pending)
+			j.pending = j.pending[:0]
+			continue
+		}
+		if j != nil {
+			_ = j.w.Close()
+		}
+		w, err := swap.Create(swap.PathFor(r.SwapDir, bs.FilePath), r.swapHeader(bs), buf.String())
+		if err != nil {
+			r.logSwapError(bs.FilePath, err)
+			continue
+		}
+		j = &swapJournal{buf: buf, w: w}
+		buf.SetChangeListener(func(c buffer.Change) { j.pending = append(j.pending, c) })
+		if r.swaps == nil {
+			r.swaps = map[buffer.TextStorage]*swapJournal{}
+		}
+		r.swaps[buf] = j
+	}
+}
+
+// dropSwap stops journaling buf and deletes its swap file.
+func (r *Runner) dropSwap(buf buffer.TextStorage) {
+	j, ok := r.swaps[buf]
+	if !ok {
+		return
+	}
+	buf.SetChangeListener(nil)
+	_ = j.w.Remove()
+	delete(r.swaps, buf)
+}
+
+// removeSwaps deletes every swap file of this session, as on a clean quit.
+func (r *Runner) removeSwaps() {
+	for buf := range r.swaps {
+		r.dropSwap(buf)
+	}
+}
+
+// emergencySwapFlush writes the full text of every dirty buffer to its swap
+// file. It runs while a panic unwinds, so it avoids the journals' pending
+// state, which may be inconsistent.
+func (r *Runner) emergencySwapFlush() {
+	if r.SwapDir == "" {
+		return
+	}
+	for _, bs := range r.openBuffers() {
+		if bs.Buf == nil || !bs.Dirty || bs.FilePath == "" {
+			continue
+		}
+		if j, ok := r.swaps[bs.Buf]; ok {
+			_ = j.w.Close()
+		}
+		_ = swap.Save(swap.PathFor(r.SwapDir, bs.FilePath), r.swapHeader(bs), bs.Buf.String())
+	}
+}
+
+func (r *Runner) logSwapError(path string, err error) {
+	if r.Logger != nil {
+		r.Logger.Event("swap.error", map[string]any{"file": path, "error": err.Error()})
+	}
+}
+
+// checkSwap looks for a swap file left for path by an earlier session. Swap
+// files matching the loaded text are removed silently; otherwise the user is
+// asked what to do, deferred until Run when no screen is attached yet.
+func (r *Runner) checkSwap(path string) {
+	if r.SwapDir == "" || path == "" {
+		return
+	}
+	sp := swap.PathFor(r.SwapDir, path)
+	rec, err := swap.Read(sp)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			r.logSwapError(path, err)
+		}
+		return
+	}
+	if r.Buf != nil && rec.Text == r.Buf.String() {
+		_ = os.Remove(sp)
+		return
+	}
+	if r.Screen == nil {
+		r.pendingSwap = path
+		return
+	}
+	r.runSwapPrompt(sp, rec)
+}
+
+// runSwapPrompt offers to recover, diff or discard a swap file.
+func (r *Runner) runSwapPrompt(sp string, rec *swap.Recovered) {
+	info := fmt.Sprintf("Swap file found for %s (written %s)", r.FilePath, rec.ModTime.Format("Jan 02 15:04"))
+	if rec.Header.InUse() {
+		info += fmt.Sprintf(", editor pid %d is still running", rec.Header.PID)
+	}
+	for {
+		switch r.runChoicePrompt([]string{info, "r recover, d show diff, x discard swap, Esc keep swap and ignore"}, "rdx") {
+		case 'r':
+			r.recoverSwap(sp, rec)
+			r.draw(nil)
+			return
+		case 'd':
+			r.showDiff(r.Buf.String(), rec.Text)
+		case 'x':
+			_ = os.Remove(sp)
+			r.draw(nil)
+			return
+		default:
+			return
+		}
+	}
+}
+
+// recoverSwap replaces the current buffer with the recovered text. The
+// buffer stays dirty so the recovered changes are saved explicitly.
+func (r *Runner) recoverSwap(sp string, rec *swap.Recovered) {
+	r.replaceContents(rec.Text)
+	r.Dirty = true
+	r.saveBufferState()
+	_ = os.Remove(sp)
+	// journal the recovered text right away
+	r.flushSwaps()
+	if r.Logger != nil {
+		r.Logger.Event("swap.recover", map[string]any{"file": r.FilePath, "runes": r.Buf.Len()})
+	}
+}
+
+// showDiff shows a line diff between two versions of the buffer, trimmed to
+// the screen height.
+func (r *Runner) showDiff(a, b string) {
+	lines := editor.LineDiff(a, b)
+	if len(lines) == 0 {
+		lines = []string{"No differences"}
+	}
+	if r.Screen != nil {
+		_, h := r.Screen.Size()
+		if limit := h - 3; limit > 0 && len(lines) > limit {
+			more := len(lines) - limit + 1
+			lines = append(lines[:limit-1:limit-1], fmt.Sprintf("... %d more lines", more))
+		}
+	}
+	r.showDialogLines(lines)
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// tickInterval is how often the event loop runs periodic work: journaling
+// dirty buffers to swap files and checking the open file for changes made
+// by other programs.
+const tickInterval = 2 * time.Second
+
+// tick is the payload of the interrupt event posted by the ticker.
+type tick struct{}
+
+// startTicker posts a tick to the event loop every tickInterval until the
+// returned stop function is called.
+func (r *Runner) startTicker() (stop func()) {
+	s := r.Screen
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(tickInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				_ = s.PostEvent(tcell.NewEventInterrupt(tick{}))
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// onTick handles a tick from the ticker.
+func (r *Runner) onTick() {
+	r.flushSwaps()
+	r.checkDiskChange()
+}
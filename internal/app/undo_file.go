@@ -0,0 +1,79 @@
+package app
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"example.com/texteditor/pkg/editor"
+	"example.com/texteditor/pkg/history"
+)
+
+// undoFileFor returns the file keeping the undo history of path, or "" when
+// persistent undo is off or path matches an UndoExclude pattern.
+func (r *Runner) undoFileFor(path string) string {
+	if r.UndoDir == "" || path == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	for _, pat := range r.UndoExclude {
+		if dir, ok := strings.CutSuffix(pat, "/**"); ok {
+			if strings.HasPrefix(abs, dir+string(filepath.Separator)) {
+				return ""
+			}
+			continue
+		}
+		if ok, _ := filepath.Match(pat, abs); ok {
+			return ""
+		}
+		if ok, _ := filepath.Match(pat, filepath.Base(abs)); ok {
+			return ""
+		}
+	}
+	return history.PathFor(r.UndoDir, abs)
+}
+
+// writeUndoFile stores the history of bs, which must match its file on
+// disk, so a later session can undo past the point the file was opened.
+func (r *Runner) writeUndoFile(bs editor.BufferState) {
+	path := r.undoFileFor(bs.FilePath)
+	if path == "" || bs.History == nil || bs.Buf == nil {
+		return
+	}
+	if err := bs.History.WriteFile(path, bs.Buf.String(), r.UndoMaxSize); err != nil && r.Logger != nil {
+		r.Logger.Event("undo.write.error", map[string]any{"file": bs.FilePath, "error": err.Error()})
+	}
+}
+
+// writeUndoFiles stores the history of every saved buffer on quit. Dirty
+// buffers are skipped: their history ends in text the file does not hold.
+func (r *Runner) writeUndoFiles() {
+	for _, bs := range r.openBuffers() {
+		if !bs.Dirty {
+			r.writeUndoFile(bs)
+		}
+	}
+}
+
+// readUndoFile restores the history kept for the file just loaded. It is
+// ignored when the file changed since the history was written.
+func (r *Runner) readUndoFile() {
+	path := r.undoFileFor(r.FilePath)
+	if path == "" || r.Buf == nil {
+		return
+	}
+	h, err := history.ReadFile(path, r.Buf.String())
+	if err != nil {
+		if !errors.Is(err, history.ErrStale) && !errors.Is(err, fs.ErrNotExist) && r.Logger != nil {
+			r.Logger.Event("undo.read.error", map[string]any{"file": r.FilePath, "error": err.Error()})
+		}
+		return
+	}
+	h.SetLimits(r.UndoLimits)
+	r.History = h
+	r.saveBufferState()
+}
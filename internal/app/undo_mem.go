@@ -0,0 +1,82 @@
+package app
+
+import (
+	"fmt"
+
+	"example.com/texteditor/pkg/history"
+)
+
+// newHistory returns an empty undo history using the configured limits.
+func (r *Runner) newHistory() *history.History {
+	h := history.New()
+	h.SetLimits(r.UndoLimits)
+	return h
+}
+
+// SetUndoLimits changes the history limits of every open buffer.
+func (r *Runner) SetUndoLimits(l history.Limits) {
+	r.UndoLimits = l
+	if r.History != nil {
+		r.History.SetLimits(l)
+	}
+	if r.Ed != nil {
+		for _, bs := range r.Ed.Buffers {
+			if bs.History != nil {
+				bs.History.SetLimits(l)
+			}
+		}
+	}
+}
+
+// formatBytes renders n with a binary unit, e.g. "1.5 KiB".
+func formatBytes(n int) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	v, suffix := float64(n)/unit, "KiB"
+	for _, s := range []string{"MiB", "GiB"} {
+		if v < unit {
+			break
+		}
+		v, suffix = v/unit, s
+	}
+	return fmt.Sprintf("%.1f %s", v, suffix)
+}
+
+// undoMemLines reports the undo history size of each open buffer.
+func (r *Runner) undoMemLines() []string {
+	lines := []string{"Undo history memory:"}
+	total := 0
+	for _, bs := range r.openBuffers() {
+		if bs.History == nil {
+			continue
+		}
+		name := bs.FilePath
+		if name == "" {
+			name = "(unnamed)"
+		}
+		st := bs.History.Stats()
+		total += st.Bytes
+		lines = append(lines, fmt.Sprintf("  %s: %d states, %d ops, %s", name, st.States, st.Ops, formatBytes(st.Bytes)))
+	}
+	lines = append(lines, "  total: "+formatBytes(total))
+	limit := func(n int, format func(int) string) string {
+		if n == 0 {
+			return "none"
+		}
+		return format(n)
+	}
+	lines = append(lines, fmt.Sprintf("Limits per buffer: max ops %s, max size %s",
+		limit(r.UndoLimits.MaxOps, func(n int) string { return fmt.Sprint(n) }),
+		limit(r.UndoLimits.MaxBytes, formatBytes)))
+	return lines
+}
+
+// showUndoMem displays undoMemLines in a dialog (:undomem).
+func (r *Runner) showUndoMem() {
+	if r.Logger != nil {
+		r.Logger.Event("action", map[string]any{"name": "undo.mem", "stats": r.History.Stats()})
+	}
+	r.showDialogLines(r.undoMemLines())
+}
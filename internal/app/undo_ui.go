@@ -0,0 +1,259 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/texteditor/pkg/history"
+	"github.com/gdamore/tcell/v2"
+)
+
+// selection returns the cursor and visual selection for undo groups.
+func (r *Runner) selection() history.Selection {
+	sel := history.Selection{Cursor: r.Cursor, Anchor: -1}
+	if r.Mode == ModeVisual && r.visualStart() >= 0 {
+		sel.Anchor = r.visualStart()
+		sel.Linewise = r.VisualLine
+	}
+	return sel
+}
+
+// beginEdit and endEdit bracket a compound edit so it undoes in one step.
+func (r *Runner) beginEdit() {
+	if r.History != nil {
+		r.History.Begin(r.selection())
+	}
+}
+
+func (r *Runner) endEdit() {
+	if r.History != nil {
+		r.History.End(r.selection())
+	}
+}
+
+// beginKeyGroup opens an undo group for a key press unless one is still
+// open. endKeyGroup closes it after the key, except while in insert mode or
+// playing a macro, so a whole insert session or macro run undoes at once.
+// Multi-edit mode closes the group after every key.
+func (r *Runner) beginKeyGroup() {
+	if r.keyGroup != nil || r.History == nil {
+		return
+	}
+	r.keyGroup = r.History
+	r.keyGroup.Begin(r.selection())
+}
+
+func (r *Runner) endKeyGroup() {
+	if r.keyGroup == nil {
+		return
+	}
+	if r.Mode == ModeInsert || r.macroPlaying && len(r.macroPlayback) > 0 {
+		return
+	}
+	r.closeKeyGroup()
+}
+
+// closeKeyGroup ends the open key group. It runs before the history loses
+// focus, while the cursor still belongs to its buffer.
+func (r *Runner) closeKeyGroup() {
+	if r.keyGroup == nil {
+		return
+	}
+	r.keyGroup.End(r.selection())
+	r.keyGroup = nil
+}
+
+// restoreSelection puts the cursor and visual selection where the state
+// the history just moved to was edited.
+func (r *Runner) restoreSelection() {
+	sel, ok := r.History.Landing()
+	if !ok || r.Buf == nil {
+		return
+	}
+	r.Cursor = min(sel.Cursor, r.Buf.Len())
+	if r.isInsertMode() {
+		return
+	}
+	if sel.Anchor >= 0 && sel.Anchor <= r.Buf.Len() {
+		r.Mode = ModeVisual
+		r.setVisualStart(sel.Anchor)
+		r.VisualLine = sel.Linewise
+	} else if r.Mode == ModeVisual {
+		r.Mode = ModeNormal
+		r.setVisualStart(-1)
+		r.VisualLine = false
+	}
+}
+
+// moveHistory runs an undo tree navigation and refreshes the view after it.
+// The buffer changes even when move fails part way, so the edit sequence is
+// bumped either way.
+func (r *Runner) moveHistory(action string, move func(h *history.History) error) error {
+	if r.History == nil || r.Buf == nil {
+		return nil
+	}
+	before := r.History.Current()
+	err := move(r.History)
+	if r.History.Current() != before {
+		r.bumpEditSeq()
+		r.Dirty = true
+		r.restoreSelection()
+	}
+	if r.Cursor > r.Buf.Len() {
+		r.Cursor = r.Buf.Len()
+	}
+	r.recomputeCursorLine()
+	r.ensureCursorVisible()
+	if r.Logger != nil {
+		r.Logger.Event("action", map[string]any{"name": action, "state": r.History.Current(), "cursor": r.Cursor})
+	}
+	if r.Screen != nil {
+		r.draw(nil)
+	}
+	return err
+}
+
+// stepHistory moves n states through the undo tree in creation order (g+/g-).
+func (r *Runner) stepHistory(n int) {
+	_ = r.moveHistory("undo.step", func(h *history.History) error { return h.Step(r.Buf, &r.Cursor, n) })
+}
+
+// switchUndoBranch moves to a sibling branch of the current undo state.
+func (r *Runner) switchUndoBranch(delta int) {
+	err := r.moveHistory("undo.branch", func(h *history.History) error { return h.SwitchBranch(r.Buf, &r.Cursor, delta) })
+	if err != nil {
+		r.showDialog("Undo: " + err.Error())
+	}
+}
+
+// parseUndoAmount parses the argument of :earlier and :later: a count of
+// states ("", "3") or a duration with an s, m, h or d suffix ("5m").
+func parseUndoAmount(arg string) (steps int, d time.Duration, err error) {
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		return 1, 0, nil
+	}
+	if n, err := strconv.Atoi(arg); err == nil && n > 0 {
+		return n, 0, nil
+	}
+	units := map[byte]time.Duration{'s': time.Second, 'm': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour}
+	unit, ok := units[arg[len(arg)-1]]
+	n, err := strconv.Atoi(arg[:len(arg)-1])
+	if !ok || err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("invalid count or time %q", arg)
+	}
+	return 0, time.Duration(n) * unit, nil
+}
+
+// undoTimeTravel implements :earlier (dir -1) and :later (dir 1).
+func (r *Runner) undoTimeTravel(arg string, dir int) error {
+	steps, d, err := parseUndoAmount(arg)
+	if err != nil {
+		return err
+	}
+	return r.moveHistory("undo.time", func(h *history.History) error {
+		switch {
+		case d == 0:
+			return h.Step(r.Buf, &r.Cursor, dir*steps)
+		case dir < 0:
+			return h.Earlier(r.Buf, &r.Cursor, d)
+		default:
+			return h.Later(r.Buf, &r.Cursor, d)
+		}
+	})
+}
+
+// undoTreeLines lays out the undo tree depth-first, oldest branch first.
+// Later branches are indented one level deeper than their parent. It returns
+// the lines and the state shown on each.
+func (r *Runner) undoTreeLines(h *history.History) ([]string, []int) {
+	states := h.States()
+	children := make([][]int, len(states))
+	for _, s := range states[1:] {
+		children[s.Parent] = append(children[s.Parent], s.Seq)
+	}
+	var lines []string
+	var seqs []int
+	var walk func(seq, depth int)
+	walk = func(seq, depth int) {
+		s := states[seq]
+		mark := " "
+		if seq == h.Current() {
+			mark = "*"
+		}
+		line := fmt.Sprintf("%s %s%4d  %s", mark, strings.Repeat("  ", depth), seq, s.Time.Format("15:04:05"))
+		if seq == 0 {
+			line += "  original"
+		} else {
+			line += fmt.Sprintf("  %+d  %s", s.Delta, r.killRingPreview(s.Text))
+		}
+		lines = append(lines, line)
+		seqs = append(seqs, seq)
+		for i, c := range children[seq] {
+			walk(c, depth+min(i, 1))
+		}
+	}
+	walk(0, 0)
+	return lines, seqs
+}
+
+// runUndoTree shows the undo tree of the current buffer. j/k or Ctrl+N/P
+// select a state and Enter moves the buffer to it.
+func (r *Runner) runUndoTree() {
+	if r.Screen == nil || r.History == nil {
+		return
+	}
+	lines, seqs := r.undoTreeLines(r.History)
+	sel := 0
+	for i, s := range seqs {
+		if s == r.History.Current() {
+			sel = i
+		}
+	}
+	for {
+		_, height := r.Screen.Size()
+		rows := max(1, height/2)
+		top := max(0, min(sel-rows/2, len(lines)-rows))
+		view := []string{"Undo tree (* current): j/k select, Enter go to state, Esc close"}
+		for i := top; i < len(lines) && i < top+rows; i++ {
+			prefix := "  "
+			if i == sel {
+				prefix = "> "
+			}
+			view = append(view, prefix+lines[i])
+		}
+		r.setMiniBuffer(view)
+		r.draw(nil)
+
+		ev := r.waitEvent()
+		if ev == nil {
+			r.clearMiniBuffer()
+			return
+		}
+		kev, ok := ev.(*tcell.EventKey)
+		if !ok {
+			continue
+		}
+		switch {
+		case r.isCancelKey(kev):
+			r.clearMiniBuffer()
+			r.draw(nil)
+			return
+		case kev.Key() == tcell.KeyEnter:
+			r.clearMiniBuffer()
+			seq := seqs[sel]
+			_ = r.moveHistory("undo.goto", func(h *history.History) error { return h.GoTo(r.Buf, &r.Cursor, seq) })
+			return
+		case kev.Key() == tcell.KeyDown || kev.Key() == tcell.KeyCtrlN || (kev.Key() == tcell.KeyRune && kev.Rune() == 'j'):
+			if sel < len(lines)-1 {
+				sel++
+			}
+		case kev.Key() == tcell.KeyUp || kev.Key() == tcell.KeyCtrlP || (kev.Key() == tcell.KeyRune && kev.Rune() == 'k'):
+			if sel > 0 {
+				sel--
+			}
+		}
+	}
+}
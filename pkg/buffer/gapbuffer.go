@@ -15,6 +15,19 @@ type GapBuffer struct {
 	cacheString string
 	cacheLines  []string
 	cacheValid  bool
+
+	// lineIdx is built lazily on the first line query and then kept up to
+	// date by Insert and Delete.
+	lineIdx *lineIndex
+
+	// snapChunks are the pieces of the last snapshot. When snapDirty is set
+	// the text has changed since, only within [snapLo, Len()-snapTail).
+	snapChunks       [][]rune
+	snapDirty        bool
+	snapLo, snapTail int
+
+	markers  MarkerSet
+	listener ChangeListener
 }
 
 // NewGapBuffer creates an empty GapBuffer with an initial capacity.
@@ -97,6 +110,8 @@ func (g *GapBuffer) Insert(pos int, s []rune) error {
 	if pos < 0 || pos > g.Len() {
 		return fmt.Errorf("position out of range")
 	}
+	g.indexInsert(pos, s)
+	g.noteEdit(pos, pos)
 	g.moveGap(pos)
 	g.ensureGap(len(s))
 	// copy into gap
@@ -105,6 +120,9 @@ func (g *GapBuffer) Insert(pos int, s []rune) error {
 	}
 	g.gapStart += len(s)
 	g.cacheValid = false
+	if len(s) > 0 {
+		g.changed(Change{Pos: pos, Text: string(s)})
+	}
 	return nil
 }
 
@@ -113,6 +131,8 @@ func (g *GapBuffer) Delete(start, end int) error {
 	if start < 0 || end < start || end > g.Len() {
 		return fmt.Errorf("invalid range")
 	}
+	g.indexDelete(start, end)
+	g.noteEdit(start, end)
 	g.moveGap(start)
 	// expand gap by (end-start) from the right
 	d := end - start
@@ -121,9 +141,25 @@ func (g *GapBuffer) Delete(start, end int) error {
 		g.gapEnd = len(g.buf)
 	}
 	g.cacheValid = false
+	if d > 0 {
+		g.changed(Change{Pos: start, Deleted: d})
+	}
 	return nil
 }
 
+// SetChangeListener registers fn to observe Insert and Delete.
+func (g *GapBuffer) SetChangeListener(fn ChangeListener) { g.listener = fn }
+
+// Markers returns the markers that follow this buffer's edits.
+func (g *GapBuffer) Markers() *MarkerSet { return &g.markers }
+
+func (g *GapBuffer) changed(c Change) {
+	g.markers.Apply(c)
+	if g.listener != nil {
+		g.listener(c)
+	}
+}
+
 // Slice returns a slice of runes in [start,end)
 func (g *GapBuffer) Slice(start, end int) []rune {
 	if start < 0 {
@@ -168,32 +204,114 @@ func (g *GapBuffer) runeAt(i int) rune {
 // bounds. The end index is one past the last rune of the line (i.e., it will
 // include the terminating '\n' when present).
 func (g *GapBuffer) LineAt(idx int) (start, end int) {
+	idx = g.clampLine(idx)
+	start, _ = g.index().start(idx)
+	return start, start + g.index().line(idx).runes
+}
+
+// LineCount returns the number of lines; an empty buffer has one line.
+func (g *GapBuffer) LineCount() int {
+	return g.index().count()
+}
+
+// LineStart returns the rune offset where line idx begins. Out of range
+// indices are clamped to the first or last line.
+func (g *GapBuffer) LineStart(idx int) int {
+	start, _ := g.index().start(g.clampLine(idx))
+	return start
+}
+
+// LineOf returns the 0-based line containing rune offset pos.
+func (g *GapBuffer) LineOf(pos int) int {
+	line, _, _ := g.index().lineOf(clampPos(pos, g.Len()))
+	return line
+}
+
+// ByteOffset returns the UTF-8 byte offset of rune offset pos.
+func (g *GapBuffer) ByteOffset(pos int) int {
+	pos = clampPos(pos, g.Len())
+	line, start, bytes := g.index().lineOf(pos)
+	return bytes + g.prefixBytes(start, g.index().line(line), pos)
+}
+
+func (g *GapBuffer) index() *lineIndex {
+	if g.lineIdx == nil {
+		g.lineIdx = newLineIndex(g.Slice(0, g.Len()))
+	}
+	return g.lineIdx
+}
+
+func (g *GapBuffer) clampLine(idx int) int {
 	if idx < 0 {
-		idx = 0
+		return 0
 	}
-	if g.Len() == 0 {
-		return 0, 0
+	if last := g.index().count() - 1; idx > last {
+		return last
 	}
-	line := 0
-	start = 0
-	for i := 0; i < g.Len(); i++ {
-		if line == idx {
-			// find end
-			for j := i; j < g.Len(); j++ {
-				if g.runeAt(j) == '\n' {
-					// return j+1 so the newline is included
-					return i, j + 1
-				}
-			}
-			return i, g.Len()
-		}
-		if g.runeAt(i) == '\n' {
-			line++
-			start = i + 1
-		}
+	return idx
+}
+
+func clampPos(pos, n int) int {
+	if pos < 0 {
+		return 0
+	}
+	if pos > n {
+		return n
+	}
+	return pos
+}
+
+// byteLen returns the UTF-8 size of the runes in [start,end).
+func (g *GapBuffer) byteLen(start, end int) int {
+	n := 0
+	for i := start; i < end; i++ {
+		n += runeBytes(g.runeAt(i))
+	}
+	return n
+}
+
+// prefixBytes returns the byte size of [lineStart,pos) within a line of size
+// l, scanning whichever side of pos is shorter.
+func (g *GapBuffer) prefixBytes(lineStart int, l lineLen, pos int) int {
+	if pos-lineStart <= lineStart+l.runes-pos {
+		return g.byteLen(lineStart, pos)
+	}
+	return l.bytes - g.byteLen(pos, lineStart+l.runes)
+}
+
+// indexInsert updates the line index for inserting s at pos. It must run
+// before the runes are copied into the buffer.
+func (g *GapBuffer) indexInsert(pos int, s []rune) {
+	if g.lineIdx == nil || len(s) == 0 {
+		return
+	}
+	line, start, _ := g.lineIdx.lineOf(pos)
+	old := g.lineIdx.line(line)
+	prefix := pos - start
+	prefixBytes := g.prefixBytes(start, old, pos)
+	lens := splitLineLens(s, prefix, prefixBytes)
+	last := &lens[len(lens)-1]
+	last.runes += old.runes - prefix
+	last.bytes += old.bytes - prefixBytes
+	g.lineIdx.replace(line, line, lens)
+}
+
+// indexDelete updates the line index for removing [start,end). It must run
+// before the runes are removed from the buffer.
+func (g *GapBuffer) indexDelete(start, end int) {
+	if g.lineIdx == nil || start == end {
+		return
+	}
+	first, firstStart, _ := g.lineIdx.lineOf(start)
+	last, lastStart, _ := g.lineIdx.lineOf(end)
+	firstLen := g.lineIdx.line(first)
+	lastLen := g.lineIdx.line(last)
+	suffix := lastStart + lastLen.runes - end
+	merged := lineLen{
+		runes: start - firstStart + suffix,
+		bytes: g.prefixBytes(firstStart, firstLen, start) + lastLen.bytes - g.prefixBytes(lastStart, lastLen, end),
 	}
-	// if idx beyond last, return last line
-	return start, g.Len()
+	g.lineIdx.replace(first, last, []lineLen{merged})
 }
 
 // String returns the buffer as a string (for debugging)
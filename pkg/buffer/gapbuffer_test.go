@@ -33,3 +33,34 @@ func TestGapBuffer_LineAt(t *testing.T) {
 		t.Fatalf("expected line 'two\\n', got %q", line)
 	}
 }
+
+func TestGapBuffer_LineIndexIncremental(t *testing.T) {
+	g := NewGapBufferFromString("one\ntwo\nthree")
+	if g.LineCount() != 3 {
+		t.Fatalf("expected 3 lines, got %d", g.LineCount())
+	}
+	// split "two" into two lines and join the first two lines
+	if err := g.Insert(5, []rune("é\n")); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	if err := g.Delete(3, 4); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	// buffer is now "oneté\nwo\nthree"
+	if g.LineCount() != 3 {
+		t.Fatalf("expected 3 lines after edits, got %d", g.LineCount())
+	}
+	if got := g.LineStart(1); got != 6 {
+		t.Fatalf("expected line 1 to start at 6, got %d", got)
+	}
+	if got := g.LineOf(9); got != 2 {
+		t.Fatalf("expected offset 9 on line 2, got %d", got)
+	}
+	if got := g.ByteOffset(6); got != 7 {
+		t.Fatalf("expected byte offset 7 for rune 6, got %d", got)
+	}
+	start, end := g.LineAt(0)
+	if line := string(g.Slice(start, end)); line != "oneté\n" {
+		t.Fatalf("expected line 'oneté\\n', got %q", line)
+	}
+}
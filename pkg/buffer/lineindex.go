@@ -0,0 +1,222 @@
+package buffer
+
+import "unicode/utf8"
+
+// lineLen records the size of one line. Every line except the last includes
+// its terminating '\n'.
+type lineLen struct {
+	runes int
+	bytes int
+}
+
+// lineNode is a node of the implicit treap used by lineIndex. Subtree sums let
+// line→offset and offset→line lookups run in O(log n).
+type lineNode struct {
+	l           lineLen
+	prio        uint32
+	left, right *lineNode
+	count       int
+	sumRunes    int
+	sumBytes    int
+}
+
+func (n *lineNode) update() {
+	n.count = 1
+	n.sumRunes = n.l.runes
+	n.sumBytes = n.l.bytes
+	if n.left != nil {
+		n.count += n.left.count
+		n.sumRunes += n.left.sumRunes
+		n.sumBytes += n.left.sumBytes
+	}
+	if n.right != nil {
+		n.count += n.right.count
+		n.sumRunes += n.right.sumRunes
+		n.sumBytes += n.right.sumBytes
+	}
+}
+
+func (n *lineNode) countOf() int {
+	if n == nil {
+		return 0
+	}
+	return n.count
+}
+
+func (n *lineNode) runesOf() int {
+	if n == nil {
+		return 0
+	}
+	return n.sumRunes
+}
+
+func (n *lineNode) bytesOf() int {
+	if n == nil {
+		return 0
+	}
+	return n.sumBytes
+}
+
+// lineIndex maintains line lengths incrementally so edits only touch the
+// lines they change instead of rebuilding a full line table.
+type lineIndex struct {
+	root *lineNode
+	seed uint32
+}
+
+// newLineIndex builds an index for the given runes.
+func newLineIndex(rs []rune) *lineIndex {
+	idx := &lineIndex{seed: 88675123}
+	idx.root = idx.build(splitLineLens(rs, 0, 0))
+	return idx
+}
+
+// splitLineLens splits rs at each '\n'. prefix and prefixBytes are added to
+// the first line so callers can splice text into an existing line.
+func splitLineLens(rs []rune, prefix, prefixBytes int) []lineLen {
+	out := make([]lineLen, 0, 1)
+	cur := lineLen{runes: prefix, bytes: prefixBytes}
+	for _, r := range rs {
+		cur.runes++
+		cur.bytes += runeBytes(r)
+		if r == '\n' {
+			out = append(out, cur)
+			cur = lineLen{}
+		}
+	}
+	return append(out, cur)
+}
+
+// runeBytes returns the UTF-8 encoded size of r, counting invalid runes as
+// the replacement character they become when converted to a string.
+func runeBytes(r rune) int {
+	n := utf8.RuneLen(r)
+	if n < 0 {
+		return utf8.RuneLen(utf8.RuneError)
+	}
+	return n
+}
+
+func (idx *lineIndex) nextPrio() uint32 {
+	x := idx.seed
+	x ^= x << 13
+	x ^= x >> 17
+	x ^= x << 5
+	idx.seed = x
+	return x
+}
+
+func (idx *lineIndex) build(lens []lineLen) *lineNode {
+	var root *lineNode
+	for _, l := range lens {
+		n := &lineNode{l: l, prio: idx.nextPrio()}
+		n.update()
+		root = idx.merge(root, n)
+	}
+	return root
+}
+
+// split divides n into the first k lines and the rest.
+func (idx *lineIndex) split(n *lineNode, k int) (*lineNode, *lineNode) {
+	if n == nil {
+		return nil, nil
+	}
+	if k <= n.left.countOf() {
+		l, r := idx.split(n.left, k)
+		n.left = r
+		n.update()
+		return l, n
+	}
+	l, r := idx.split(n.right, k-n.left.countOf()-1)
+	n.right = l
+	n.update()
+	return n, r
+}
+
+func (idx *lineIndex) merge(a, b *lineNode) *lineNode {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.prio > b.prio {
+		a.right = idx.merge(a.right, b)
+		a.update()
+		return a
+	}
+	b.left = idx.merge(a, b.left)
+	b.update()
+	return b
+}
+
+// count returns the number of lines (at least 1).
+func (idx *lineIndex) count() int {
+	return idx.root.countOf()
+}
+
+// line returns the length of line k.
+func (idx *lineIndex) line(k int) lineLen {
+	n := idx.root
+	for n != nil {
+		lc := n.left.countOf()
+		switch {
+		case k < lc:
+			n = n.left
+		case k == lc:
+			return n.l
+		default:
+			k -= lc + 1
+			n = n.right
+		}
+	}
+	return lineLen{}
+}
+
+// start returns the rune and byte offsets where line k begins.
+func (idx *lineIndex) start(k int) (runes, bytes int) {
+	n := idx.root
+	for n != nil {
+		lc := n.left.countOf()
+		if k <= lc {
+			n = n.left
+			continue
+		}
+		runes += n.left.runesOf() + n.l.runes
+		bytes += n.left.bytesOf() + n.l.bytes
+		k -= lc + 1
+		n = n.right
+	}
+	return runes, bytes
+}
+
+// lineOf returns the line containing rune offset pos along with that line's
+// rune and byte start. Offsets at or past the end map to the last line.
+func (idx *lineIndex) lineOf(pos int) (line, runes, bytes int) {
+	n := idx.root
+	for n != nil {
+		if pos < n.left.runesOf() {
+			n = n.left
+			continue
+		}
+		pos -= n.left.runesOf()
+		if pos < n.l.runes {
+			return line + n.left.countOf(), runes + n.left.runesOf(), bytes + n.left.bytesOf()
+		}
+		pos -= n.l.runes
+		line += n.left.countOf() + 1
+		runes += n.left.runesOf() + n.l.runes
+		bytes += n.left.bytesOf() + n.l.bytes
+		n = n.right
+	}
+	last := idx.count() - 1
+	r, b := idx.start(last)
+	return last, r, b
+}
+
+// replace swaps lines [from,to] for lens.
+func (idx *lineIndex) replace(from, to int, lens []lineLen) {
+	a, rest := idx.split(idx.root, from)
+	_, c := idx.split(rest, to-from+1)
+	idx.root = idx.merge(idx.merge(a, idx.build(lens)), c)
+}
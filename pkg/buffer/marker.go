@@ -0,0 +1,128 @@
+package buffer
+
+// Gravity decides where a marker goes when text is inserted exactly at its
+// position.
+type Gravity int
+
+const (
+	// LeftGravity keeps the marker before text inserted at its position.
+	LeftGravity Gravity = iota
+	// RightGravity moves the marker after text inserted at its position,
+	// so it stays on the character it was placed on.
+	RightGravity
+)
+
+// Marker is a rune position that follows edits of the storage it belongs
+// to. Text inserted before it shifts it right; deleting text around it
+// moves it to the start of the deletion.
+type Marker struct {
+	set     *MarkerSet
+	idx     int // index in set.markers, -1 once removed
+	pos     int
+	gravity Gravity
+}
+
+// Pos returns the marker's position, or -1 once it has been removed.
+func (m *Marker) Pos() int {
+	if m == nil || m.idx < 0 {
+		return -1
+	}
+	return m.pos
+}
+
+// SetPos moves the marker to pos.
+func (m *Marker) SetPos(pos int) { m.pos = pos }
+
+// Gravity returns the marker's gravity.
+func (m *Marker) Gravity() Gravity { return m.gravity }
+
+// Attached reports whether the marker is still part of set.
+func (m *Marker) Attached(set *MarkerSet) bool {
+	return m != nil && m.idx >= 0 && m.set == set
+}
+
+// Remove stops the marker from tracking edits. Removing a marker twice is
+// harmless.
+func (m *Marker) Remove() {
+	if m == nil || m.idx < 0 {
+		return
+	}
+	s := m.set
+	last := s.markers[len(s.markers)-1]
+	s.markers[m.idx] = last
+	last.idx = m.idx
+	s.markers[len(s.markers)-1] = nil
+	s.markers = s.markers[:len(s.markers)-1]
+	m.idx = -1
+}
+
+// MarkerSet holds the markers of one storage. Every TextStorage owns one and
+// applies its edits to it before notifying its ChangeListener. The zero
+// value is an empty set.
+type MarkerSet struct {
+	markers []*Marker
+}
+
+// Add places a new marker at pos.
+func (s *MarkerSet) Add(pos int, g Gravity) *Marker {
+	m := &Marker{set: s, idx: len(s.markers), pos: pos, gravity: g}
+	s.markers = append(s.markers, m)
+	return m
+}
+
+// Len returns the number of markers in the set.
+func (s *MarkerSet) Len() int { return len(s.markers) }
+
+// Apply moves every marker for c.
+func (s *MarkerSet) Apply(c Change) {
+	if n := len([]rune(c.Text)); n > 0 {
+		for _, m := range s.markers {
+			if m.pos > c.Pos || m.pos == c.Pos && m.gravity == RightGravity {
+				m.pos += n
+			}
+		}
+	}
+	if c.Deleted > 0 {
+		end := c.Pos + c.Deleted
+		for _, m := range s.markers {
+			switch {
+			case m.pos >= end:
+				m.pos -= c.Deleted
+			case m.pos > c.Pos:
+				m.pos = c.Pos
+			}
+		}
+	}
+}
+
+// Span is a range of text delimited by two markers.
+type Span struct {
+	Start, End *Marker
+}
+
+// AddSpan marks [start,end). An inner span keeps to the text it covers:
+// insertions at either edge stay outside. Otherwise the span grows to take
+// in text inserted at its edges, like a selection being typed into.
+func (s *MarkerSet) AddSpan(start, end int, inner bool) Span {
+	if inner {
+		return Span{Start: s.Add(start, RightGravity), End: s.Add(end, LeftGravity)}
+	}
+	return Span{Start: s.Add(start, LeftGravity), End: s.Add(end, RightGravity)}
+}
+
+// Bounds returns the span's current start and end. It returns -1, -1 once
+// the span has been removed.
+func (sp Span) Bounds() (start, end int) {
+	start, end = sp.Start.Pos(), sp.End.Pos()
+	if start < 0 || end < 0 {
+		return -1, -1
+	}
+	// an inner span emptied by a deletion can end up inverted
+	return start, max(start, end)
+}
+
+// Remove removes both markers of the span.
+func (sp Span) Remove() {
+	sp.Start.Remove()
+	sp.End.Remove()
+}
@@ -0,0 +1,55 @@
+package buffer
+
+import "testing"
+
+func TestMarkers_FollowEdits(t *testing.T) {
+	for _, kind := range []Kind{KindGapBuffer, KindPieceTable} {
+		b := NewFromString(kind, "hello world")
+		ms := b.Markers()
+		left := ms.Add(6, LeftGravity)
+		right := ms.Add(6, RightGravity)
+		after := ms.Add(11, LeftGravity)
+
+		_ = b.Insert(6, []rune("big "))
+		if left.Pos() != 6 || right.Pos() != 10 || after.Pos() != 15 {
+			t.Fatalf("%s: after insert got %d %d %d", kind, left.Pos(), right.Pos(), after.Pos())
+		}
+		_ = b.Delete(0, 2)
+		if left.Pos() != 4 || right.Pos() != 8 || after.Pos() != 13 {
+			t.Fatalf("%s: after delete got %d %d %d", kind, left.Pos(), right.Pos(), after.Pos())
+		}
+		// markers inside a deleted range collapse to its start
+		_ = b.Delete(3, 10)
+		if left.Pos() != 3 || right.Pos() != 3 || after.Pos() != 6 {
+			t.Fatalf("%s: after overlapping delete got %d %d %d", kind, left.Pos(), right.Pos(), after.Pos())
+		}
+		right.Remove()
+		right.Remove()
+		_ = b.Insert(0, []rune("x"))
+		if right.Pos() != -1 || ms.Len() != 2 || left.Pos() != 4 {
+			t.Fatalf("%s: removed marker still tracked: %d len %d", kind, right.Pos(), ms.Len())
+		}
+	}
+}
+
+func TestMarkers_Spans(t *testing.T) {
+	b := NewGapBufferFromString("say foo here")
+	inner := b.Markers().AddSpan(4, 7, true)
+	outer := b.Markers().AddSpan(4, 7, false)
+	_ = b.Insert(7, []rune("d"))
+	_ = b.Insert(4, []rune("["))
+	if s, e := inner.Bounds(); s != 5 || e != 8 {
+		t.Fatalf("inner span got %d..%d", s, e)
+	}
+	if s, e := outer.Bounds(); s != 4 || e != 9 {
+		t.Fatalf("outer span got %d..%d", s, e)
+	}
+	_ = b.Delete(3, 10)
+	if s, e := inner.Bounds(); s != 3 || e != 3 {
+		t.Fatalf("deleted span got %d..%d", s, e)
+	}
+	outer.Remove()
+	if s, e := outer.Bounds(); s != -1 || e != -1 {
+		t.Fatalf("removed span got %d..%d", s, e)
+	}
+}
@@ -0,0 +1,476 @@
+package buffer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxPieceLen bounds how many runes a single piece may reference. Large files
+// are split into many pieces at load so per-piece scans (line lookups,
+// splitting) stay cheap regardless of file size.
+const maxPieceLen = 4096
+
+type pieceSource uint8
+
+const (
+	sourceOriginal pieceSource = iota
+	sourceAdd
+)
+
+// piece references a run of runes in either the original or the add buffer.
+type piece struct {
+	src      pieceSource
+	start    int
+	length   int
+	newlines int
+	bytes    int
+}
+
+// pieceNode is an immutable treap node ordered by document position. Each
+// node caches the rune, newline and byte totals of its subtree so positional
+// and line lookups run in O(log n). Edits copy the nodes along the affected path
+// instead of mutating them.
+type pieceNode struct {
+	p           piece
+	prio        uint32
+	left, right *pieceNode
+	size        int
+	lines       int
+	bytes       int
+}
+
+func newPieceNode(p piece, prio uint32, left, right *pieceNode) *pieceNode {
+	n := &pieceNode{p: p, prio: prio, left: left, right: right}
+	n.size = p.length + left.sizeOf() + right.sizeOf()
+	n.lines = p.newlines + left.linesOf() + right.linesOf()
+	n.bytes = p.bytes + left.bytesOf() + right.bytesOf()
+	return n
+}
+
+func (n *pieceNode) sizeOf() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func (n *pieceNode) linesOf() int {
+	if n == nil {
+		return 0
+	}
+	return n.lines
+}
+
+func (n *pieceNode) bytesOf() int {
+	if n == nil {
+		return 0
+	}
+	return n.bytes
+}
+
+// PieceTable stores text as a sequence of pieces over an immutable original
+// buffer and an append-only add buffer. Inserts never move existing text, which
+// keeps edits in very large files cheap.
+type PieceTable struct {
+	original []rune
+	add      []rune
+	root     *pieceNode
+	seed     uint32
+
+	cacheString string
+	cacheLines  []string
+	cacheValid  bool
+
+	markers  MarkerSet
+	listener ChangeListener
+}
+
+// NewPieceTable creates an empty PieceTable.
+func NewPieceTable() *PieceTable {
+	return &PieceTable{seed: 2463534242}
+}
+
+// NewPieceTableFromString initializes a PieceTable with the provided text.
+func NewPieceTableFromString(s string) *PieceTable {
+	t := NewPieceTable()
+	t.original = []rune(s)
+	t.root = t.buildPieces(sourceOriginal, 0, len(t.original))
+	return t
+}
+
+// nextPrio returns a pseudo-random treap priority (xorshift32).
+func (t *PieceTable) nextPrio() uint32 {
+	x := t.seed
+	x ^= x << 13
+	x ^= x >> 17
+	x ^= x << 5
+	t.seed = x
+	return x
+}
+
+func (t *PieceTable) pieceRunes(p piece) []rune {
+	if p.src == sourceAdd {
+		return t.add[p.start : p.start+p.length]
+	}
+	return t.original[p.start : p.start+p.length]
+}
+
+// buildPieces returns a treap covering src[start:start+length] split into
+// pieces of at most maxPieceLen runes.
+func (t *PieceTable) buildPieces(src pieceSource, start, length int) *pieceNode {
+	var root *pieceNode
+	for off := 0; off < length; off += maxPieceLen {
+		n := length - off
+		if n > maxPieceLen {
+			n = maxPieceLen
+		}
+		p := piece{src: src, start: start + off, length: n}
+		p.newlines, p.bytes = measureRunes(t.pieceRunes(p))
+		root = t.merge(root, newPieceNode(p, t.nextPrio(), nil, nil))
+	}
+	return root
+}
+
+// measureRunes returns the newline count and UTF-8 size of rs.
+func measureRunes(rs []rune) (newlines, bytes int) {
+	for _, r := range rs {
+		if r == '\n' {
+			newlines++
+		}
+		bytes += runeBytes(r)
+	}
+	return newlines, bytes
+}
+
+// splitPiece cuts p at offset off (0 < off < p.length).
+func (t *PieceTable) splitPiece(p piece, off int) (piece, piece) {
+	left := piece{src: p.src, start: p.start, length: off}
+	left.newlines, left.bytes = measureRunes(t.pieceRunes(left))
+	right := piece{src: p.src, start: p.start + off, length: p.length - off, newlines: p.newlines - left.newlines, bytes: p.bytes - left.bytes}
+	return left, right
+}
+
+// split divides the tree rooted at n into [0,pos) and [pos,size).
+func (t *PieceTable) split(n *pieceNode, pos int) (*pieceNode, *pieceNode) {
+	if n == nil {
+		return nil, nil
+	}
+	leftSize := n.left.sizeOf()
+	switch {
+	case pos <= leftSize:
+		l, r := t.split(n.left, pos)
+		return l, newPieceNode(n.p, n.prio, r, n.right)
+	case pos >= leftSize+n.p.length:
+		l, r := t.split(n.right, pos-leftSize-n.p.length)
+		return newPieceNode(n.p, n.prio, n.left, l), r
+	default:
+		lp, rp := t.splitPiece(n.p, pos-leftSize)
+		l := newPieceNode(lp, n.prio, n.left, nil)
+		r := t.merge(newPieceNode(rp, t.nextPrio(), nil, nil), n.right)
+		return l, r
+	}
+}
+
+// merge concatenates two trees where every position in a precedes b.
+func (t *PieceTable) merge(a, b *pieceNode) *pieceNode {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.prio > b.prio {
+		return newPieceNode(a.p, a.prio, a.left, t.merge(a.right, b))
+	}
+	return newPieceNode(b.p, b.prio, t.merge(a, b.left), b.right)
+}
+
+// extendLast grows the last piece of n when it ends exactly where the add
+// buffer ended before the current insert, so consecutive typing does not
+// create a piece per keystroke.
+func (t *PieceTable) extendLast(n *pieceNode, addEnd int, added piece) (*pieceNode, bool) {
+	if n == nil {
+		return nil, false
+	}
+	if n.right != nil {
+		r, ok := t.extendLast(n.right, addEnd, added)
+		if !ok {
+			return n, false
+		}
+		return newPieceNode(n.p, n.prio, n.left, r), true
+	}
+	p := n.p
+	if p.src != sourceAdd || p.start+p.length != addEnd || p.length+added.length > maxPieceLen {
+		return n, false
+	}
+	p.length += added.length
+	p.newlines += added.newlines
+	p.bytes += added.bytes
+	return newPieceNode(p, n.prio, n.left, nil), true
+}
+
+// Insert inserts runes at position pos (0..Len()).
+func (t *PieceTable) Insert(pos int, s []rune) error {
+	if pos < 0 || pos > t.Len() {
+		return fmt.Errorf("position out of range")
+	}
+	if len(s) == 0 {
+		return nil
+	}
+	addEnd := len(t.add)
+	t.add = append(t.add, s...)
+	l, r := t.split(t.root, pos)
+	added := piece{src: sourceAdd, start: addEnd, length: len(s)}
+	added.newlines, added.bytes = measureRunes(s)
+	if ext, ok := t.extendLast(l, addEnd, added); ok {
+		l = ext
+	} else {
+		l = t.merge(l, t.buildPieces(sourceAdd, addEnd, len(s)))
+	}
+	t.root = t.merge(l, r)
+	t.cacheValid = false
+	t.changed(Change{Pos: pos, Text: string(s)})
+	return nil
+}
+
+// Delete removes runes in [start,end).
+func (t *PieceTable) Delete(start, end int) error {
+	if start < 0 || end < start || end > t.Len() {
+		return fmt.Errorf("invalid range")
+	}
+	if start == end {
+		return nil
+	}
+	l, rest := t.split(t.root, start)
+	_, r := t.split(rest, end-start)
+	t.root = t.merge(l, r)
+	t.cacheValid = false
+	t.changed(Change{Pos: start, Deleted: end - start})
+	return nil
+}
+
+// SetChangeListener registers fn to observe Insert and Delete.
+func (t *PieceTable) SetChangeListener(fn ChangeListener) { t.listener = fn }
+
+// Markers returns the markers that follow this table's edits.
+func (t *PieceTable) Markers() *MarkerSet { return &t.markers }
+
+func (t *PieceTable) changed(c Change) {
+	t.markers.Apply(c)
+	if t.listener != nil {
+		t.listener(c)
+	}
+}
+
+// Len returns the number of runes stored.
+func (t *PieceTable) Len() int {
+	return t.root.sizeOf()
+}
+
+// RuneAt returns the rune at index i. If i is out of bounds, it returns 0.
+func (t *PieceTable) RuneAt(i int) rune {
+	if i < 0 || i >= t.Len() {
+		return 0
+	}
+	n := t.root
+	for n != nil {
+		leftSize := n.left.sizeOf()
+		if i < leftSize {
+			n = n.left
+			continue
+		}
+		i -= leftSize
+		if i < n.p.length {
+			return t.pieceRunes(n.p)[i]
+		}
+		i -= n.p.length
+		n = n.right
+	}
+	return 0
+}
+
+// Slice returns a slice of runes in [start,end)
+func (t *PieceTable) Slice(start, end int) []rune {
+	if start < 0 {
+		start = 0
+	}
+	if end > t.Len() {
+		end = t.Len()
+	}
+	if start >= end {
+		return []rune{}
+	}
+	return t.appendRange(make([]rune, 0, end-start), t.root, start, end)
+}
+
+func (t *PieceTable) appendRange(out []rune, n *pieceNode, start, end int) []rune {
+	if n == nil || start >= end {
+		return out
+	}
+	leftSize := n.left.sizeOf()
+	if start < leftSize {
+		out = t.appendRange(out, n.left, start, min(end, leftSize))
+	}
+	pieceEnd := leftSize + n.p.length
+	if start < pieceEnd && end > leftSize {
+		from := max(start, leftSize) - leftSize
+		to := min(end, pieceEnd) - leftSize
+		out = append(out, t.pieceRunes(n.p)[from:to]...)
+	}
+	if end > pieceEnd {
+		out = t.appendRange(out, n.right, max(start, pieceEnd)-pieceEnd, end-pieceEnd)
+	}
+	return out
+}
+
+// newlineOffset returns the rune index of the k-th (0-based) newline, or -1.
+func (t *PieceTable) newlineOffset(k int) int {
+	n := t.root
+	base := 0
+	for n != nil {
+		leftLines := n.left.linesOf()
+		if k < leftLines {
+			n = n.left
+			continue
+		}
+		k -= leftLines
+		pieceStart := base + n.left.sizeOf()
+		if k < n.p.newlines {
+			for i, r := range t.pieceRunes(n.p) {
+				if r != '\n' {
+					continue
+				}
+				if k == 0 {
+					return pieceStart + i
+				}
+				k--
+			}
+		}
+		k -= n.p.newlines
+		base = pieceStart + n.p.length
+		n = n.right
+	}
+	return -1
+}
+
+// LineAt returns the rune start and end indices for the given line number
+// (0-based). If the line index is past the end, it returns the last line's
+// bounds. The end index includes the terminating '\n' when present.
+func (t *PieceTable) LineAt(idx int) (start, end int) {
+	if idx < 0 {
+		idx = 0
+	}
+	if t.Len() == 0 {
+		return 0, 0
+	}
+	total := t.root.linesOf()
+	if idx > total {
+		idx = total
+	}
+	if idx > 0 {
+		start = t.newlineOffset(idx-1) + 1
+	}
+	if idx < total {
+		return start, t.newlineOffset(idx) + 1
+	}
+	return start, t.Len()
+}
+
+// LineCount returns the number of lines; an empty buffer has one line.
+func (t *PieceTable) LineCount() int {
+	return t.root.linesOf() + 1
+}
+
+// LineStart returns the rune offset where line idx begins. Out of range
+// indices are clamped to the first or last line.
+func (t *PieceTable) LineStart(idx int) int {
+	if idx <= 0 {
+		return 0
+	}
+	if total := t.root.linesOf(); idx > total {
+		idx = total
+	}
+	return t.newlineOffset(idx-1) + 1
+}
+
+// LineOf returns the 0-based line containing rune offset pos.
+func (t *PieceTable) LineOf(pos int) int {
+	line, _ := t.locate(pos)
+	return line
+}
+
+// ByteOffset returns the UTF-8 byte offset of rune offset pos.
+func (t *PieceTable) ByteOffset(pos int) int {
+	_, bytes := t.locate(pos)
+	return bytes
+}
+
+// locate returns the number of newlines and UTF-8 bytes before rune offset
+// pos.
+func (t *PieceTable) locate(pos int) (lines, bytes int) {
+	pos = clampPos(pos, t.Len())
+	n := t.root
+	for n != nil {
+		if pos < n.left.sizeOf() {
+			n = n.left
+			continue
+		}
+		pos -= n.left.sizeOf()
+		lines += n.left.linesOf()
+		bytes += n.left.bytesOf()
+		if pos < n.p.length {
+			nl, b := measureRunes(t.pieceRunes(n.p)[:pos])
+			return lines + nl, bytes + b
+		}
+		pos -= n.p.length
+		lines += n.p.newlines
+		bytes += n.p.bytes
+		n = n.right
+	}
+	return lines, bytes
+}
+
+// String returns the buffer as a string. Building it costs O(n), so
+// per-keystroke paths use Slice, LineAt and ByteOffset instead; the result
+// is cached until the buffer is modified.
+func (t *PieceTable) String() string {
+	if t.cacheValid {
+		return t.cacheString
+	}
+	t.cacheString = t.build()
+	t.cacheLines = nil
+	t.cacheValid = true
+	return t.cacheString
+}
+
+// Lines returns the buffer split into lines. Like String it is O(n) and
+// cached until the buffer is modified.
+func (t *PieceTable) Lines() []string {
+	s := t.String()
+	if t.cacheLines == nil {
+		t.cacheLines = strings.Split(s, "\n")
+	}
+	return t.cacheLines
+}
+
+// build concatenates all pieces into a string.
+func (t *PieceTable) build() string {
+	var sb strings.Builder
+	sb.Grow(t.root.bytesOf())
+	t.walk(t.root, func(rs []rune) {
+		for _, r := range rs {
+			sb.WriteRune(r)
+		}
+	})
+	return sb.String()
+}
+
+// walk visits each piece's runes in document order.
+func (t *PieceTable) walk(n *pieceNode, fn func([]rune)) {
+	if n == nil {
+		return
+	}
+	t.walk(n.left, fn)
+	fn(t.pieceRunes(n.p))
+	t.walk(n.right, fn)
+}
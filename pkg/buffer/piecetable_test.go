@@ -0,0 +1,119 @@
+package buffer
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestPieceTable_InsertDelete(t *testing.T) {
+	p := NewPieceTableFromString("Hello World")
+	if err := p.Insert(5, []rune{','}); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	if p.String() != "Hello, World" {
+		t.Fatalf("expected 'Hello, World', got %q", p.String())
+	}
+	if err := p.Delete(5, 6); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if p.String() != "Hello World" {
+		t.Fatalf("expected 'Hello World' after delete, got %q", p.String())
+	}
+	if err := p.Insert(99, []rune("x")); err == nil {
+		t.Fatalf("expected error for out of range insert")
+	}
+}
+
+func TestPieceTable_LineAt(t *testing.T) {
+	p := NewPieceTableFromString("one\ntwo\nthree")
+	start, end := p.LineAt(1)
+	if line := string(p.Slice(start, end)); line != "two\n" {
+		t.Fatalf("expected line 'two\\n', got %q", line)
+	}
+	start, end = p.LineAt(5)
+	if line := string(p.Slice(start, end)); line != "three" {
+		t.Fatalf("expected last line 'three', got %q", line)
+	}
+}
+
+// TestPieceTable_MatchesGapBuffer applies the same random edits to both
+// backends and checks they stay in agreement.
+func TestPieceTable_MatchesGapBuffer(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	initial := strings.Repeat("line of text\n", 1000)
+	var stores = []TextStorage{NewGapBufferFromString(initial), NewPieceTableFromString(initial)}
+	// build the gap buffer's line index up front so it is maintained
+	// incrementally through the edits below
+	_ = stores[0].LineCount()
+	alphabet := []rune("ab\ncé\n")
+	for i := 0; i < 2000; i++ {
+		n := stores[0].Len()
+		if rng.Intn(3) > 0 {
+			pos := rng.Intn(n + 1)
+			s := make([]rune, rng.Intn(8)+1)
+			for j := range s {
+				s[j] = alphabet[rng.Intn(len(alphabet))]
+			}
+			for _, st := range stores {
+				if err := st.Insert(pos, s); err != nil {
+					t.Fatalf("insert: %v", err)
+				}
+			}
+		} else if n > 0 {
+			start := rng.Intn(n)
+			end := start + rng.Intn(min(20, n-start)+1)
+			for _, st := range stores {
+				if err := st.Delete(start, end); err != nil {
+					t.Fatalf("delete: %v", err)
+				}
+			}
+		}
+	}
+	g, p := stores[0], stores[1]
+	if g.String() != p.String() {
+		t.Fatalf("contents diverged")
+	}
+	for i := 0; i < len(g.Lines())+1; i++ {
+		gs, ge := g.LineAt(i)
+		ps, pe := p.LineAt(i)
+		if gs != ps || ge != pe {
+			t.Fatalf("LineAt(%d): gap=(%d,%d) piece=(%d,%d)", i, gs, ge, ps, pe)
+		}
+	}
+	if g.LineCount() != len(g.Lines()) || p.LineCount() != len(g.Lines()) {
+		t.Fatalf("LineCount: want %d, gap=%d piece=%d", len(g.Lines()), g.LineCount(), p.LineCount())
+	}
+	text := g.String()
+	for i := 0; i < g.Len(); i += 37 {
+		if g.RuneAt(i) != p.RuneAt(i) {
+			t.Fatalf("RuneAt(%d) mismatch", i)
+		}
+		prefix := string([]rune(text)[:i])
+		wantLine := strings.Count(prefix, "\n")
+		if g.LineOf(i) != wantLine || p.LineOf(i) != wantLine {
+			t.Fatalf("LineOf(%d): want %d, gap=%d piece=%d", i, wantLine, g.LineOf(i), p.LineOf(i))
+		}
+		if g.ByteOffset(i) != len(prefix) || p.ByteOffset(i) != len(prefix) {
+			t.Fatalf("ByteOffset(%d): want %d, gap=%d piece=%d", i, len(prefix), g.ByteOffset(i), p.ByteOffset(i))
+		}
+		if g.LineStart(wantLine) != p.LineStart(wantLine) {
+			t.Fatalf("LineStart(%d) mismatch", wantLine)
+		}
+	}
+	if string(g.Slice(100, 900)) != string(p.Slice(100, 900)) {
+		t.Fatalf("Slice mismatch")
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	if k, err := ParseKind("piece-table"); err != nil || k != KindPieceTable {
+		t.Fatalf("expected piece table kind, got %q %v", k, err)
+	}
+	if k, err := ParseKind(""); err != nil || k != KindGapBuffer {
+		t.Fatalf("expected gap buffer default, got %q %v", k, err)
+	}
+	if _, err := ParseKind("rope"); err == nil {
+		t.Fatalf("expected error for unknown backend")
+	}
+}
@@ -0,0 +1,278 @@
+package buffer
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Snapshot is an immutable, read-only view of a TextStorage taken at a given
+// version. Later edits to the storage do not affect it, and it is safe to read
+// from several goroutines at once, so background workers can use it without
+// copying the text on the UI goroutine.
+type Snapshot interface {
+	Reader
+	// Version returns the version passed to TextStorage.Snapshot.
+	Version() int64
+}
+
+// snapChunkSize is the size of the pieces a GapBuffer snapshot is made of.
+// Pieces that an edit did not touch are shared with the next snapshot, so
+// taking one after a small edit copies about two pieces.
+const snapChunkSize = 16 << 10
+
+// Snapshot returns an immutable view of the buffer. The first snapshot copies
+// the text; later ones copy only the span edited since the previous one and
+// share the rest of its pieces.
+func (g *GapBuffer) Snapshot(version int64) Snapshot {
+	if g.snapChunks == nil || g.snapDirty {
+		g.snapChunks = g.nextChunks()
+		g.snapDirty = false
+	}
+	s := newGapSnapshot(g.snapChunks, version)
+	if g.cacheValid {
+		str := g.cacheString
+		s.strOnce.Do(func() { s.str = str })
+	}
+	return s
+}
+
+// noteEdit records an edit replacing [start,end) of the text for the next
+// snapshot. It must run before the edit.
+func (g *GapBuffer) noteEdit(start, end int) {
+	if g.snapChunks == nil {
+		return
+	}
+	if !g.snapDirty {
+		g.snapLo, g.snapTail = start, g.Len()-end
+		g.snapDirty = true
+		return
+	}
+	g.snapLo = min(g.snapLo, start)
+	g.snapTail = min(g.snapTail, g.Len()-end)
+}
+
+// nextChunks returns the pieces of the current text. Pieces of the previous
+// snapshot wholly before snapLo or within the last snapTail runes are kept;
+// the span between them is copied, together with the pieces it touches so
+// that typing at one spot does not leave a trail of tiny pieces.
+func (g *GapBuffer) nextChunks() [][]rune {
+	n := g.Len()
+	old := g.snapChunks
+	if old == nil || len(old) > 2*n/snapChunkSize+64 {
+		return g.appendChunks(make([][]rune, 0, n/snapChunkSize+1), 0, n)
+	}
+	oldLen := 0
+	for _, c := range old {
+		oldLen += len(c)
+	}
+	i, from := 0, 0
+	for i < len(old) && from+len(old[i]) < g.snapLo {
+		from += len(old[i])
+		i++
+	}
+	j, to := len(old), oldLen
+	for j > i && to-len(old[j-1]) > oldLen-g.snapTail {
+		j--
+		to -= len(old[j])
+	}
+	out := make([][]rune, 0, len(old)+2)
+	out = append(out, old[:i]...)
+	out = g.appendChunks(out, from, n-(oldLen-to))
+	return append(out, old[j:]...)
+}
+
+// appendChunks copies [start,end) of the buffer to out in pieces of about
+// snapChunkSize runes.
+func (g *GapBuffer) appendChunks(out [][]rune, start, end int) [][]rune {
+	if start >= end {
+		return out
+	}
+	pieces := (end - start + snapChunkSize - 1) / snapChunkSize
+	size := (end - start + pieces - 1) / pieces
+	for ; start < end; start += size {
+		out = append(out, g.Slice(start, min(start+size, end)))
+	}
+	return out
+}
+
+// gapSnapshot is a GapBuffer's text as immutable pieces, which later
+// snapshots of the same buffer may share.
+type gapSnapshot struct {
+	chunks  [][]rune
+	starts  []int // rune offset of each piece, then the length
+	version int64
+
+	strOnce sync.Once
+	str     string
+
+	linesOnce  sync.Once
+	lineStarts []int // rune offset of each line start
+	byteStarts []int // byte offset of each line start
+}
+
+func newGapSnapshot(chunks [][]rune, version int64) *gapSnapshot {
+	s := &gapSnapshot{chunks: chunks, starts: make([]int, len(chunks)+1), version: version}
+	for i, c := range chunks {
+		s.starts[i+1] = s.starts[i] + len(c)
+	}
+	return s
+}
+
+func (s *gapSnapshot) Version() int64 { return s.version }
+
+func (s *gapSnapshot) Len() int {
+	return s.starts[len(s.chunks)]
+}
+
+// chunkOf returns the index of the piece holding rune offset i < Len().
+func (s *gapSnapshot) chunkOf(i int) int {
+	return sort.Search(len(s.chunks), func(c int) bool { return s.starts[c+1] > i })
+}
+
+func (s *gapSnapshot) runeAt(i int) rune {
+	c := s.chunkOf(i)
+	return s.chunks[c][i-s.starts[c]]
+}
+
+func (s *gapSnapshot) RuneAt(i int) rune {
+	if i < 0 || i >= s.Len() {
+		return 0
+	}
+	return s.runeAt(i)
+}
+
+func (s *gapSnapshot) Slice(start, end int) []rune {
+	start = clampPos(start, s.Len())
+	end = clampPos(end, s.Len())
+	if start >= end {
+		return []rune{}
+	}
+	out := make([]rune, 0, end-start)
+	for c := s.chunkOf(start); c < len(s.chunks) && s.starts[c] < end; c++ {
+		lo := max(start, s.starts[c]) - s.starts[c]
+		hi := min(end, s.starts[c+1]) - s.starts[c]
+		out = append(out, s.chunks[c][lo:hi]...)
+	}
+	return out
+}
+
+func (s *gapSnapshot) String() string {
+	s.strOnce.Do(func() {
+		var sb strings.Builder
+		sb.Grow(s.Len())
+		for _, c := range s.chunks {
+			for _, r := range c {
+				sb.WriteRune(r)
+			}
+		}
+		s.str = sb.String()
+	})
+	return s.str
+}
+
+// lines builds the line start tables on first use. That scans the whole
+// text, so the UI goroutine reads lines from the buffer itself and leaves
+// snapshots to background workers.
+func (s *gapSnapshot) lines() {
+	s.linesOnce.Do(func() {
+		s.lineStarts = []int{0}
+		s.byteStarts = []int{0}
+		i, bytes := 0, 0
+		for _, c := range s.chunks {
+			for _, r := range c {
+				i++
+				bytes += runeBytes(r)
+				if r == '\n' {
+					s.lineStarts = append(s.lineStarts, i)
+					s.byteStarts = append(s.byteStarts, bytes)
+				}
+			}
+		}
+	})
+}
+
+func (s *gapSnapshot) LineCount() int {
+	s.lines()
+	return len(s.lineStarts)
+}
+
+func (s *gapSnapshot) LineStart(idx int) int {
+	s.lines()
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(s.lineStarts) {
+		idx = len(s.lineStarts) - 1
+	}
+	return s.lineStarts[idx]
+}
+
+func (s *gapSnapshot) LineAt(idx int) (start, end int) {
+	s.lines()
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(s.lineStarts)-1 {
+		return s.lineStarts[len(s.lineStarts)-1], s.Len()
+	}
+	return s.lineStarts[idx], s.lineStarts[idx+1]
+}
+
+func (s *gapSnapshot) LineOf(pos int) int {
+	s.lines()
+	pos = clampPos(pos, s.Len())
+	return sort.Search(len(s.lineStarts), func(i int) bool { return s.lineStarts[i] > pos }) - 1
+}
+
+func (s *gapSnapshot) ByteOffset(pos int) int {
+	pos = clampPos(pos, s.Len())
+	line := s.LineOf(pos)
+	bytes := s.byteStarts[line]
+	for i := s.lineStarts[line]; i < pos; i++ {
+		bytes += runeBytes(s.runeAt(i))
+	}
+	return bytes
+}
+
+// Snapshot returns an immutable view of the table. Tree nodes are never
+// mutated and the add buffer is append-only, so the snapshot shares both with
+// the live table at no copying cost.
+func (t *PieceTable) Snapshot(version int64) Snapshot {
+	frozen := &PieceTable{
+		original: t.original,
+		add:      t.add[:len(t.add):len(t.add)],
+		root:     t.root,
+	}
+	s := &pieceSnapshot{t: frozen, version: version}
+	if t.cacheValid {
+		str := t.cacheString
+		s.strOnce.Do(func() { s.str = str })
+	}
+	return s
+}
+
+// pieceSnapshot exposes only the read methods of a frozen PieceTable. String
+// is guarded separately because PieceTable caches it on first use.
+type pieceSnapshot struct {
+	t       *PieceTable
+	version int64
+
+	strOnce sync.Once
+	str     string
+}
+
+func (s *pieceSnapshot) Version() int64                  { return s.version }
+func (s *pieceSnapshot) Len() int                        { return s.t.Len() }
+func (s *pieceSnapshot) RuneAt(i int) rune               { return s.t.RuneAt(i) }
+func (s *pieceSnapshot) Slice(start, end int) []rune     { return s.t.Slice(start, end) }
+func (s *pieceSnapshot) LineCount() int                  { return s.t.LineCount() }
+func (s *pieceSnapshot) LineAt(idx int) (start, end int) { return s.t.LineAt(idx) }
+func (s *pieceSnapshot) LineStart(line int) int          { return s.t.LineStart(line) }
+func (s *pieceSnapshot) LineOf(pos int) int              { return s.t.LineOf(pos) }
+func (s *pieceSnapshot) ByteOffset(pos int) int          { return s.t.ByteOffset(pos) }
+
+func (s *pieceSnapshot) String() string {
+	s.strOnce.Do(func() { s.str = s.t.build() })
+	return s.str
+}
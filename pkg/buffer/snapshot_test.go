@@ -0,0 +1,119 @@
+package buffer
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSnapshot_UnaffectedByEdits(t *testing.T) {
+	for _, st := range []TextStorage{NewGapBufferFromString("one\ntwö\nthree"), NewPieceTableFromString("one\ntwö\nthree")} {
+		snap := st.Snapshot(7)
+		if err := st.Insert(0, []rune("zero\n")); err != nil {
+			t.Fatalf("%T insert: %v", st, err)
+		}
+		if err := st.Delete(st.Len()-5, st.Len()); err != nil {
+			t.Fatalf("%T delete: %v", st, err)
+		}
+		if snap.Version() != 7 {
+			t.Fatalf("%T: expected version 7, got %d", st, snap.Version())
+		}
+		if got := snap.String(); got != "one\ntwö\nthree" {
+			t.Fatalf("%T: snapshot changed after edits: %q", st, got)
+		}
+		if snap.LineCount() != 3 || snap.LineStart(2) != 8 || snap.LineOf(5) != 1 {
+			t.Fatalf("%T: unexpected snapshot line index", st)
+		}
+		if snap.ByteOffset(8) != 9 {
+			t.Fatalf("%T: expected byte offset 9, got %d", st, snap.ByteOffset(8))
+		}
+		if s, e := snap.LineAt(1); string(snap.Slice(s, e)) != "twö\n" {
+			t.Fatalf("%T: unexpected line 1 %q", st, string(snap.Slice(s, e)))
+		}
+		if got := st.String(); got != "zero\none\ntwö\n" {
+			t.Fatalf("%T: unexpected live contents %q", st, got)
+		}
+	}
+}
+
+// TestSnapshot_ConcurrentReads reads a snapshot from several goroutines while
+// the live buffer keeps changing; run with -race to catch sharing bugs.
+func TestSnapshot_ConcurrentReads(t *testing.T) {
+	for _, st := range []TextStorage{NewGapBuffer(0), NewPieceTable()} {
+		_ = st.Insert(0, []rune("alpha\nbeta\ngamma\n"))
+		snap := st.Snapshot(1)
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					if snap.String() != "alpha\nbeta\ngamma\n" || snap.LineCount() != 4 {
+						t.Errorf("%T: snapshot mutated", st)
+						return
+					}
+				}
+			}()
+		}
+		for j := 0; j < 100; j++ {
+			_ = st.Insert(st.Len(), []rune("x"))
+			_ = st.Delete(0, 1)
+		}
+		wg.Wait()
+	}
+}
+
+// TestSnapshot_GapBufferSharesPieces takes snapshots between scattered edits
+// of a text spanning many pieces and checks every one still reads as the
+// text it was taken of.
+func TestSnapshot_GapBufferSharesPieces(t *testing.T) {
+	g := NewGapBufferFromString(strings.Repeat("héllo wörld\n", 10000))
+	rng := rand.New(rand.NewSource(1))
+	type taken struct {
+		snap Snapshot
+		text string
+	}
+	var snaps []taken
+	for i := 0; i < 300; i++ {
+		pos := rng.Intn(g.Len() + 1)
+		if rng.Intn(3) == 0 && pos < g.Len() {
+			_ = g.Delete(pos, min(g.Len(), pos+rng.Intn(40000)))
+		} else {
+			_ = g.Insert(pos, []rune(strings.Repeat("ab\n", rng.Intn(20)+1)))
+		}
+		if i%3 == 0 {
+			snaps = append(snaps, taken{g.Snapshot(int64(i)), g.String()})
+		}
+	}
+	for _, s := range snaps {
+		if got := s.snap.String(); got != s.text {
+			t.Fatalf("snapshot %d: got %d runes, want %d", s.snap.Version(), len([]rune(got)), len([]rune(s.text)))
+		}
+		if s.snap.LineCount() != strings.Count(s.text, "\n")+1 {
+			t.Fatalf("snapshot %d: wrong line count", s.snap.Version())
+		}
+		if n := s.snap.Len(); n > 0 && string(s.snap.Slice(n/2, n)) != string([]rune(s.text)[n/2:]) {
+			t.Fatalf("snapshot %d: wrong slice", s.snap.Version())
+		}
+	}
+	if n := len(g.snapChunks); n > 2*g.Len()/snapChunkSize+64 {
+		t.Fatalf("snapshot fragmented into %d pieces", n)
+	}
+}
+
+// BenchmarkGapBuffer_TypingWithSnapshot types into a 4M-rune buffer taking a
+// snapshot after every keystroke, as syntax highlighting does.
+func BenchmarkGapBuffer_TypingWithSnapshot(b *testing.B) {
+	g := NewGapBufferFromString(strings.Repeat("0123456789abcdef\n", 1<<18))
+	pos := g.Len() / 2
+	snap := g.Snapshot(0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = g.Insert(pos, []rune{'x'})
+		pos++
+		snap = g.Snapshot(int64(i))
+	}
+	_ = snap
+}
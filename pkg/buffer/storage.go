@@ -1,11 +1,87 @@
 package buffer
 
+import (
+	"fmt"
+	"strings"
+)
+
+// Reader is the read-only view shared by TextStorage and Snapshot.
+// Positions and lengths are expressed in runes (not bytes).
+type Reader interface {
+	Len() int
+	RuneAt(i int) rune
+	Slice(start, end int) []rune
+	String() string
+	// LineCount returns the number of lines; an empty buffer has one line.
+	LineCount() int
+	// LineAt returns the rune bounds of a line, including its '\n'.
+	LineAt(idx int) (start, end int)
+	// LineStart returns the rune offset where a line begins.
+	LineStart(line int) int
+	// LineOf returns the line containing a rune offset.
+	LineOf(pos int) int
+	// ByteOffset converts a rune offset into a UTF-8 byte offset.
+	ByteOffset(pos int) int
+}
+
 // TextStorage defines the minimal storage operations used by the editor.
 // Positions and lengths are expressed in runes (not bytes).
 type TextStorage interface {
+	Reader
 	Insert(pos int, s []rune) error
 	Delete(start, end int) error
-	Slice(start, end int) []rune
-	Len() int
-	LineAt(idx int) (start, end int)
+	Lines() []string
+	// Snapshot returns an immutable view of the current contents tagged
+	// with version.
+	Snapshot(version int64) Snapshot
+	// SetChangeListener registers fn to be called after every successful
+	// Insert or Delete, replacing any previous listener. nil removes it.
+	SetChangeListener(fn ChangeListener)
+	// Markers returns the positions kept up to date by Insert and Delete.
+	Markers() *MarkerSet
+}
+
+// Change describes one mutation of a TextStorage. Inserts set Text; deletes
+// set Deleted to the number of runes removed at Pos.
+type Change struct {
+	Pos     int
+	Deleted int
+	Text    string
+}
+
+// ChangeListener observes mutations of a TextStorage.
+type ChangeListener func(Change)
+
+// Kind names a TextStorage implementation.
+type Kind string
+
+const (
+	KindGapBuffer  Kind = "gap"
+	KindPieceTable Kind = "piecetable"
+)
+
+// ParseKind converts a configuration value into a storage Kind. An empty
+// value selects the gap buffer.
+func ParseKind(s string) (Kind, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "gap", "gapbuffer", "gap-buffer":
+		return KindGapBuffer, nil
+	case "piece", "piecetable", "piece-table":
+		return KindPieceTable, nil
+	default:
+		return KindGapBuffer, fmt.Errorf("unknown storage backend: %s", s)
+	}
+}
+
+// New creates an empty storage of the given kind.
+func New(kind Kind) TextStorage {
+	return NewFromString(kind, "")
+}
+
+// NewFromString creates a storage of the given kind holding s.
+func NewFromString(kind Kind, s string) TextStorage {
+	if kind == KindPieceTable {
+		return NewPieceTableFromString(s)
+	}
+	return NewGapBufferFromString(s)
 }
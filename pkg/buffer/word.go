@@ -10,7 +10,7 @@ func IsWordRune(r rune) bool {
 
 // WordStart returns the index of the beginning of the word that ends at or before pos.
 // It behaves similar to Vim's 'b' motion.
-func WordStart(g *GapBuffer, pos int) int {
+func WordStart(g TextStorage, pos int) int {
 	if g == nil || g.Len() == 0 {
 		return 0
 	}
@@ -31,7 +31,7 @@ func WordStart(g *GapBuffer, pos int) int {
 
 // WordEnd returns the index of the end of the word that begins at or after pos.
 // It behaves similar to Vim's 'e' motion.
-func WordEnd(g *GapBuffer, pos int) int {
+func WordEnd(g TextStorage, pos int) int {
 	if g == nil || g.Len() == 0 {
 		return 0
 	}
@@ -55,7 +55,7 @@ func WordEnd(g *GapBuffer, pos int) int {
 
 // NextWordStart returns the index of the start of the next word after pos.
 // It behaves similar to Vim's 'w' motion.
-func NextWordStart(g *GapBuffer, pos int) int {
+func NextWordStart(g TextStorage, pos int) int {
 	if g == nil || g.Len() == 0 {
 		return 0
 	}
@@ -0,0 +1,145 @@
+// Package clipboard exchanges text with the system clipboard.
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Selection names one of the system selections. Only X11 and Wayland tell
+// them apart; elsewhere Primary is the clipboard.
+type Selection int
+
+const (
+	// Clipboard is the selection copy and paste use, register '+'.
+	Clipboard Selection = iota
+	// Primary is the X11 primary selection, register '*'.
+	Primary
+)
+
+// Provider reads and writes a system selection.
+type Provider interface {
+	Write(sel Selection, text string) error
+	Read(sel Selection) (string, error)
+}
+
+var (
+	// ErrPending is returned by Read when the contents arrive later, as
+	// for a terminal answering an OSC 52 query.
+	ErrPending = errors.New("clipboard: contents requested")
+	// ErrUnsupported is returned by a provider that cannot read or write.
+	ErrUnsupported = errors.New("clipboard: not supported")
+)
+
+// Timeout bounds how long a clipboard command may run.
+const Timeout = 2 * time.Second
+
+// Command runs external programs such as xclip or pbcopy. Copy commands get
+// the text on standard input; paste commands print it. Empty primary
+// commands fall back to the clipboard ones.
+type Command struct {
+	Copy, Paste               []string
+	PrimaryCopy, PrimaryPaste []string
+}
+
+// ParseCommand splits a command line configured by the user into its
+// arguments.
+func ParseCommand(s string) []string {
+	return strings.Fields(s)
+}
+
+func (c Command) argv(sel Selection, write bool) []string {
+	switch {
+	case write && sel == Primary && len(c.PrimaryCopy) > 0:
+		return c.PrimaryCopy
+	case write:
+		return c.Copy
+	case sel == Primary && len(c.PrimaryPaste) > 0:
+		return c.PrimaryPaste
+	}
+	return c.Paste
+}
+
+// Write runs the copy command with text on its standard input.
+func (c Command) Write(sel Selection, text string) error {
+	argv := c.argv(sel, true)
+	if len(argv) == 0 {
+		return ErrUnsupported
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	var out strings.Builder
+	cmd.Stdout, cmd.Stderr = &out, &out
+	// xclip and wl-copy leave a child behind to serve the selection; it
+	// keeps the output open, so only wait for it briefly
+	cmd.WaitDelay = 100 * time.Millisecond
+	if err := cmd.Run(); err != nil && !errors.Is(err, exec.ErrWaitDelay) {
+		return commandError(argv[0], err, out.String())
+	}
+	return nil
+}
+
+// Read runs the paste command and returns what it prints.
+func (c Command) Read(sel Selection) (string, error) {
+	argv := c.argv(sel, false)
+	if len(argv) == 0 {
+		return "", ErrUnsupported
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", commandError(argv[0], err, stderr.String())
+	}
+	return string(out), nil
+}
+
+func commandError(name string, err error, out string) error {
+	if msg := strings.TrimSpace(out); msg != "" {
+		return fmt.Errorf("%s: %w: %s", name, err, msg)
+	}
+	return fmt.Errorf("%s: %w", name, err)
+}
+
+// Detect returns the clipboard commands available on this system: wl-copy
+// under Wayland, xclip or xsel under X11, and pbcopy on macOS.
+func Detect() (Command, bool) {
+	return detect(os.Getenv, exec.LookPath)
+}
+
+func detect(getenv func(string) string, lookPath func(string) (string, error)) (Command, bool) {
+	has := func(name string) bool {
+		_, err := lookPath(name)
+		return err == nil
+	}
+	switch {
+	case getenv("WAYLAND_DISPLAY") != "" && has("wl-copy") && has("wl-paste"):
+		return Command{
+			Copy: []string{"wl-copy"}, Paste: []string{"wl-paste", "--no-newline"},
+			PrimaryCopy: []string{"wl-copy", "--primary"}, PrimaryPaste: []string{"wl-paste", "--no-newline", "--primary"},
+		}, true
+	case getenv("DISPLAY") != "" && has("xclip"):
+		return Command{
+			Copy: []string{"xclip", "-selection", "clipboard", "-in"}, Paste: []string{"xclip", "-selection", "clipboard", "-out"},
+			PrimaryCopy: []string{"xclip", "-selection", "primary", "-in"}, PrimaryPaste: []string{"xclip", "-selection", "primary", "-out"},
+		}, true
+	case getenv("DISPLAY") != "" && has("xsel"):
+		return Command{
+			Copy: []string{"xsel", "--clipboard", "--input"}, Paste: []string{"xsel", "--clipboard", "--output"},
+			PrimaryCopy: []string{"xsel", "--primary", "--input"}, PrimaryPaste: []string{"xsel", "--primary", "--output"},
+		}, true
+	case has("pbcopy") && has("pbpaste"):
+		return Command{Copy: []string{"pbcopy"}, Paste: []string{"pbpaste"}}, true
+	}
+	return Command{}, false
+}
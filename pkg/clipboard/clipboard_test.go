@@ -0,0 +1,84 @@
+package clipboard
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCommand_WriteRead(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	dir := t.TempDir()
+	clip := filepath.Join(dir, "clip")
+	primary := filepath.Join(dir, "primary")
+	c := Command{
+		Copy:        []string{"sh", "-c", "cat > " + clip},
+		Paste:       []string{"cat", clip},
+		PrimaryCopy: []string{"sh", "-c", "cat > " + primary},
+	}
+	if err := c.Write(Clipboard, "one\ntwo"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := c.Write(Primary, "sel"); err != nil {
+		t.Fatalf("write primary: %v", err)
+	}
+	if got, err := c.Read(Clipboard); err != nil || got != "one\ntwo" {
+		t.Fatalf("read: %q %v", got, err)
+	}
+	// without a primary paste command the clipboard is read
+	if got, err := c.Read(Primary); err != nil || got != "one\ntwo" {
+		t.Fatalf("read primary: %q %v", got, err)
+	}
+	if _, err := (Command{}).Read(Clipboard); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+	if err := (Command{Copy: []string{"sh", "-c", "echo nope >&2; exit 3"}}).Write(Clipboard, "x"); err == nil {
+		t.Fatalf("expected failing command to report an error")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	env := map[string]string{}
+	tools := map[string]bool{}
+	getenv := func(k string) string { return env[k] }
+	lookPath := func(name string) (string, error) {
+		if tools[name] {
+			return "/usr/bin/" + name, nil
+		}
+		return "", exec.ErrNotFound
+	}
+	if _, ok := detect(getenv, lookPath); ok {
+		t.Fatalf("expected nothing detected")
+	}
+	tools["xclip"] = true
+	if _, ok := detect(getenv, lookPath); ok {
+		t.Fatalf("xclip needs DISPLAY")
+	}
+	env["DISPLAY"] = ":0"
+	if c, ok := detect(getenv, lookPath); !ok || c.Copy[0] != "xclip" {
+		t.Fatalf("expected xclip, got %+v", c)
+	}
+	env["WAYLAND_DISPLAY"] = "wayland-0"
+	tools["wl-copy"], tools["wl-paste"] = true, true
+	if c, ok := detect(getenv, lookPath); !ok || c.Copy[0] != "wl-copy" {
+		t.Fatalf("expected wl-copy under Wayland, got %+v", c)
+	}
+}
+
+func TestCommand_WriteDoesNotWaitForBackgroundChild(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	c := Command{Copy: []string{"sh", "-c", "cat >/dev/null; sleep 5 &"}}
+	start := time.Now()
+	if err := c.Write(Clipboard, "x"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("write waited %v for the background child", d)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/gdamore/tcell/v2"
@@ -20,13 +21,60 @@ type Keybinding struct {
 type Config struct {
 	Keymap map[string]Keybinding `yaml:"keymap"`
 	Theme  Theme                 `yaml:"theme"`
+	// Storage names the text storage backend ("gap" or "piecetable").
+	// Empty selects the default gap buffer.
+	Storage string `yaml:"storage"`
+	// Backup selects the backup kept when saving over a file: "none"
+	// (default), "simple" for "file~" or "numbered" for "file.~N~".
+	Backup string `yaml:"backup"`
+	// BackupDir collects backups in one directory instead of next to each
+	// file. A leading "~/" is expanded to the home directory.
+	BackupDir string `yaml:"backup_dir"`
+	// AutoReload reloads unmodified buffers when their file changes on disk
+	// instead of asking.
+	AutoReload bool `yaml:"auto_reload"`
+	// UndoFile keeps undo history across sessions (default true).
+	UndoFile bool `yaml:"undo_file"`
+	// UndoDir holds the undo history files; empty selects
+	// ~/.texteditor/undo. A leading "~/" is expanded.
+	UndoDir string `yaml:"undo_dir"`
+	// UndoMaxSize caps each undo history file in bytes; older states are
+	// dropped to fit. 0 means no limit.
+	UndoMaxSize int `yaml:"undo_max_size"`
+	// UndoExclude lists path patterns, comma-separated in the file, whose
+	// undo history is not kept. Patterns match the absolute path or the
+	// base name; a trailing "/**" matches everything below a directory.
+	UndoExclude []string `yaml:"undo_exclude"`
+	// UndoMaxOps and UndoMaxBytes cap the undo history kept in memory for
+	// each buffer; the oldest states are dropped first. 0 means no limit.
+	UndoMaxOps   int `yaml:"undo_max_ops"`
+	UndoMaxBytes int `yaml:"undo_max_bytes"`
+	// KillRingSize is the number of kills the kill ring keeps; 0 keeps the
+	// editor's default.
+	KillRingSize int `yaml:"kill_ring_size"`
+	// Clipboard selects how registers + and * reach the system clipboard:
+	// "auto" (default), "osc52", "command" or "none". ClipboardCopy and
+	// ClipboardPaste set the commands, e.g. "xclip -selection clipboard".
+	Clipboard      string `yaml:"clipboard"`
+	ClipboardCopy  string `yaml:"clipboard_copy"`
+	ClipboardPaste string `yaml:"clipboard_paste"`
+	// ClipboardMirror copies every kill and yank to the clipboard.
+	ClipboardMirror bool `yaml:"clipboard_mirror"`
 }
 
+// Default limits of an undo history file and of the history kept in memory.
+const (
+	DefaultUndoMaxSize  = 1 << 20
+	DefaultUndoMaxOps   = 10000
+	DefaultUndoMaxBytes = 64 << 20
+)
+
 // Default returns a Config with default key mappings.
 func Default() *Config {
 	// Default to the terminal-compliant theme so the editor inherits
 	// the user's terminal colors when no config is provided.
-	return &Config{Keymap: DefaultKeymap(), Theme: TerminalTheme()}
+	return &Config{Keymap: DefaultKeymap(), Theme: TerminalTheme(), UndoFile: true, UndoMaxSize: DefaultUndoMaxSize,
+		UndoMaxOps: DefaultUndoMaxOps, UndoMaxBytes: DefaultUndoMaxBytes}
 }
 
 // DefaultKeymap provides builtin command bindings.
@@ -57,25 +105,32 @@ func Load(path string) (*Config, error) {
 	inTheme := false
 	// allow "theme" block with flat keys like "ui.background: black"
 	// and "syntax.<group>: <color>" as well as "preset: <name>"
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
+	for _, raw := range lines {
+		line := strings.TrimSpace(raw)
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
+		topLevel := raw[0] != ' ' && raw[0] != '\t'
 		// section entry
-		if !inKeymap && !inTheme {
+		if topLevel {
 			switch line {
 			case "keymap:":
-				inKeymap = true
+				inKeymap, inTheme = true, false
 				continue
 			case "theme:":
-				inTheme = true
+				inKeymap, inTheme = false, true
 				continue
-			default:
-				// ignore unknown top-level for now
+			}
+			if k, v, ok := strings.Cut(line, ":"); ok && isTopLevelKey(strings.TrimSpace(k)) {
+				inKeymap, inTheme = false, false
+				applyTopLevel(cfg, strings.TrimSpace(k), strings.TrimSpace(v))
 				continue
 			}
 		}
+		if !inKeymap && !inTheme {
+			// ignore unknown top-level for now
+			continue
+		}
 		parts := strings.SplitN(line, ":", 2)
 		if len(parts) != 2 {
 			return nil, errors.New("invalid config line: " + line)
@@ -162,6 +217,83 @@ func Load(path string) (*Config, error) {
 	return cfg, nil
 }
 
+// isTopLevelKey reports whether k is a scalar setting that lives outside the
+// keymap and theme sections.
+func isTopLevelKey(k string) bool {
+	switch k {
+	case "storage", "backup", "backup_dir", "auto_reload", "undo_file", "undo_dir", "undo_max_size", "undo_exclude", "undo_max_ops", "undo_max_bytes", "kill_ring_size",
+		"clipboard", "clipboard_copy", "clipboard_paste", "clipboard_mirror":
+		return true
+	}
+	return false
+}
+
+// applyTopLevel stores a top-level scalar setting on cfg.
+func applyTopLevel(cfg *Config, k, v string) {
+	switch k {
+	case "storage":
+		cfg.Storage = v
+	case "backup":
+		cfg.Backup = v
+	case "backup_dir":
+		cfg.BackupDir = expandHome(v)
+	case "auto_reload":
+		cfg.AutoReload = parseBool(v)
+	case "undo_file":
+		cfg.UndoFile = parseBool(v)
+	case "undo_dir":
+		cfg.UndoDir = expandHome(v)
+	case "undo_max_size":
+		parseSize(v, &cfg.UndoMaxSize)
+	case "undo_max_ops":
+		parseSize(v, &cfg.UndoMaxOps)
+	case "undo_max_bytes":
+		parseSize(v, &cfg.UndoMaxBytes)
+	case "kill_ring_size":
+		parseSize(v, &cfg.KillRingSize)
+	case "clipboard":
+		cfg.Clipboard = v
+	case "clipboard_copy":
+		cfg.ClipboardCopy = v
+	case "clipboard_paste":
+		cfg.ClipboardPaste = v
+	case "clipboard_mirror":
+		cfg.ClipboardMirror = parseBool(v)
+	case "undo_exclude":
+		cfg.UndoExclude = nil
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				cfg.UndoExclude = append(cfg.UndoExclude, expandHome(p))
+			}
+		}
+	}
+}
+
+// expandHome replaces a leading "~/" with the home directory.
+func expandHome(v string) string {
+	if rest, ok := strings.CutPrefix(v, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return v
+}
+
+// parseSize stores v in *dst when it is a non-negative integer.
+func parseSize(v string, dst *int) {
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+		*dst = n
+	}
+}
+
+func parseBool(v string) bool {
+	switch strings.ToLower(v) {
+	case "true", "yes", "on", "1":
+		return true
+	}
+	return false
+}
+
 // LoadDefault attempts to read ~/.texteditor/config.yaml.
 func LoadDefault() (*Config, error) {
 	home, err := os.UserHomeDir()
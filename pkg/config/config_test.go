@@ -41,3 +41,82 @@ func TestLoadConfigRemap(t *testing.T) {
 		t.Fatalf("expected remapped quit to Ctrl+X")
 	}
 }
+
+func TestLoadConfigStorage(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	data := []byte("keymap:\n  quit: Ctrl+X\nstorage: piecetable\ntheme:\n  preset: dark\n")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Storage != "piecetable" {
+		t.Fatalf("expected storage piecetable, got %q", cfg.Storage)
+	}
+	ev := tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModCtrl)
+	if !cfg.Keymap["quit"].Matches(ev) {
+		t.Fatalf("expected keymap to survive top-level storage key")
+	}
+}
+
+func TestLoadConfigBackup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	data := []byte("backup: numbered\nbackup_dir: /tmp/texteditor-backups\nauto_reload: yes\n")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Backup != "numbered" || cfg.BackupDir != "/tmp/texteditor-backups" {
+		t.Fatalf("unexpected backup settings %q %q", cfg.Backup, cfg.BackupDir)
+	}
+	if !cfg.AutoReload {
+		t.Fatalf("expected auto_reload enabled")
+	}
+}
+
+func TestLoadConfigUndoFile(t *testing.T) {
+	cfg := Default()
+	if !cfg.UndoFile || cfg.UndoMaxSize != DefaultUndoMaxSize {
+		t.Fatalf("expected persistent undo on by default, got %v %d", cfg.UndoFile, cfg.UndoMaxSize)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	data := []byte("undo_file: off\nundo_max_size: 4096\nundo_exclude: *.log, /tmp/**\nundo_max_ops: 0\nundo_max_bytes: 1000\n")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.UndoFile || cfg.UndoMaxSize != 4096 {
+		t.Fatalf("unexpected undo settings %v %d", cfg.UndoFile, cfg.UndoMaxSize)
+	}
+	if len(cfg.UndoExclude) != 2 || cfg.UndoExclude[0] != "*.log" || cfg.UndoExclude[1] != "/tmp/**" {
+		t.Fatalf("unexpected undo_exclude %q", cfg.UndoExclude)
+	}
+	if cfg.UndoMaxOps != 0 || cfg.UndoMaxBytes != 1000 {
+		t.Fatalf("unexpected undo limits %d %d", cfg.UndoMaxOps, cfg.UndoMaxBytes)
+	}
+}
+
+func TestLoadConfigKillRingSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("kill_ring_size: 120\n"), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.KillRingSize != 120 {
+		t.Fatalf("expected kill ring size 120, got %d", cfg.KillRingSize)
+	}
+}
@@ -0,0 +1,131 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDiffCells bounds the LCS table; larger differences are reported as one
+// replaced block.
+const maxDiffCells = 4 << 20
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 2
+
+// LineDiff compares two texts line by line and returns a unified-style
+// listing: "@@ -a +b @@" hunk headers (1-based line numbers) followed by
+// lines prefixed with " ", "-" or "+". Identical texts produce no lines.
+func LineDiff(a, b string) []string {
+	al := strings.SplitAfter(a, "\n")
+	bl := strings.SplitAfter(b, "\n")
+	// trim the common prefix and suffix so the table only covers the
+	// changed region
+	pre := 0
+	for pre < len(al) && pre < len(bl) && al[pre] == bl[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(al)-pre && suf < len(bl)-pre && al[len(al)-1-suf] == bl[len(bl)-1-suf] {
+		suf++
+	}
+	if pre == len(al) && pre == len(bl) {
+		return nil
+	}
+	ops := make([]diffOp, 0, len(al)+len(bl))
+	for _, s := range al[:pre] {
+		ops = append(ops, diffOp{' ', s})
+	}
+	ops = append(ops, diffOps(al[pre:len(al)-suf], bl[pre:len(bl)-suf])...)
+	for _, s := range al[len(al)-suf:] {
+		ops = append(ops, diffOp{' ', s})
+	}
+
+	// line numbers before each op
+	aNum := make([]int, len(ops))
+	bNum := make([]int, len(ops))
+	an, bn := 1, 1
+	for i, o := range ops {
+		aNum[i], bNum[i] = an, bn
+		if o.op != '+' {
+			an++
+		}
+		if o.op != '-' {
+			bn++
+		}
+	}
+	var out []string
+	for i := 0; i < len(ops); {
+		if ops[i].op == ' ' {
+			i++
+			continue
+		}
+		// extend the hunk while the next change is within two contexts
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].op != ' ' {
+				end = j
+			} else if j-end > 2*diffContext {
+				break
+			}
+		}
+		from := max(0, i-diffContext)
+		to := min(len(ops), end+1+diffContext)
+		out = append(out, fmt.Sprintf("@@ -%d +%d @@", aNum[from], bNum[from]))
+		for _, o := range ops[from:to] {
+			out = append(out, string(o.op)+strings.TrimSuffix(o.text, "\n"))
+		}
+		i = to
+	}
+	return out
+}
+
+type diffOp struct {
+	op   byte
+	text string
+}
+
+// diffOps returns the edit script turning a into b using a longest common
+// subsequence table.
+func diffOps(a, b []string) []diffOp {
+	if len(a)*len(b) > maxDiffCells {
+		ops := make([]diffOp, 0, len(a)+len(b))
+		for _, s := range a {
+			ops = append(ops, diffOp{'-', s})
+		}
+		for _, s := range b {
+			ops = append(ops, diffOp{'+', s})
+		}
+		return ops
+	}
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	return ops
+}
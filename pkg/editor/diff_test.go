@@ -0,0 +1,21 @@
+package editor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLineDiff(t *testing.T) {
+	if got := LineDiff("same\n", "same\n"); got != nil {
+		t.Fatalf("expected no diff, got %q", got)
+	}
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\nten\n"
+	want := []string{
+		"@@ -1 +1 @@", " 1", " 2", "-3", "+three", " 4", " 5",
+		"@@ -8 +8 @@", " 8", " 9", "+ten", " ",
+	}
+	if got := LineDiff(a, b); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected diff:\n%q\nwant\n%q", got, want)
+	}
+}
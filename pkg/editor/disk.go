@@ -0,0 +1,59 @@
+package editor
+
+import (
+	"crypto/sha256"
+	"errors"
+	"os"
+	"time"
+)
+
+// ErrChangedOnDisk is returned when saving would overwrite changes another
+// program made to the file since it was loaded.
+var ErrChangedOnDisk = errors.New("file changed on disk since it was loaded")
+
+// DiskInfo identifies the on-disk version of a file a buffer was loaded from
+// or last saved to. The zero value means the buffer has no known version.
+type DiskInfo struct {
+	Exists  bool
+	ModTime time.Time
+	Size    int64
+	Hash    [sha256.Size]byte
+}
+
+// Known reports whether d records a file version.
+func (d DiskInfo) Known() bool { return d.Exists }
+
+// DiskInfoFor records the identity of data just read from or written to
+// path.
+func DiskInfoFor(path string, data []byte) DiskInfo {
+	d := DiskInfo{Exists: true, Size: int64(len(data)), Hash: sha256.Sum256(data)}
+	if fi, err := os.Stat(path); err == nil {
+		d.ModTime = fi.ModTime()
+		d.Size = fi.Size()
+	}
+	return d
+}
+
+// CheckDisk compares the file at path with d. It only reads the file when
+// its size or modification time differ, and reports a change only if the
+// contents differ too; the returned DiskInfo is the file's current identity
+// either way. A file that disappeared is reported as changed with Exists
+// false.
+func (d DiskInfo) CheckDisk(path string) (changed bool, now DiskInfo, err error) {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return d.Exists, DiskInfo{}, nil
+	}
+	if err != nil {
+		return false, d, err
+	}
+	if d.Exists && fi.Size() == d.Size && fi.ModTime().Equal(d.ModTime) {
+		return false, d, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, d, err
+	}
+	now = DiskInfo{Exists: true, ModTime: fi.ModTime(), Size: fi.Size(), Hash: sha256.Sum256(data)}
+	return !d.Exists || now.Hash != d.Hash, now, nil
+}
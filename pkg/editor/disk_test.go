@@ -0,0 +1,27 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskInfo_CheckDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.txt")
+	_ = os.WriteFile(path, []byte("abc"), 0644)
+	d := DiskInfoFor(path, []byte("abc"))
+	later := d.ModTime.Add(time.Minute)
+	_ = os.Chtimes(path, later, later)
+	if changed, now, err := d.CheckDisk(path); err != nil || changed || !now.ModTime.Equal(later) {
+		t.Fatalf("touch should not count as a change: %v %v", changed, err)
+	}
+	_ = os.WriteFile(path, []byte("abd"), 0644)
+	if changed, _, _ := d.CheckDisk(path); !changed {
+		t.Fatal("expected content change to be detected")
+	}
+	_ = os.Remove(path)
+	if changed, now, _ := d.CheckDisk(path); !changed || now.Exists {
+		t.Fatal("expected deletion to be reported")
+	}
+}
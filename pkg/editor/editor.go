@@ -2,23 +2,42 @@ package editor
 
 import (
 	"os"
-	"strings"
+	"path/filepath"
 
 	"example.com/texteditor/pkg/buffer"
+	"example.com/texteditor/pkg/history"
 )
 
 // BufferState holds the state of a single editor buffer.
 type BufferState struct {
 	FilePath string
-	Buf      *buffer.GapBuffer
+	Buf      buffer.TextStorage
 	Cursor   int
 	Dirty    bool
+	// Format records the file's line endings, BOM and final newline so
+	// saving reproduces them.
+	Format FileFormat
+	// Encoding is the character encoding the file is read and written in.
+	Encoding Encoding
+	// Disk identifies the file version last loaded or saved, to detect
+	// changes made by other programs.
+	Disk DiskInfo
+	// History is the buffer's own undo/redo history; nil until the buffer
+	// is first focused.
+	History    *history.History
+	CursorLine int
+	TopLine    int
+	// UI holds front-end state (mode, selection, highlight caches) that
+	// travels with the buffer. The editor stores it without looking inside.
+	UI any
 }
 
 // Editor manages multiple buffers and the focused buffer index.
 type Editor struct {
 	Buffers []BufferState
 	Current int
+	// Storage selects the TextStorage implementation used for loaded files.
+	Storage buffer.Kind
 }
 
 // New creates an empty Editor.
@@ -65,15 +84,41 @@ func (e *Editor) Prev() BufferState {
 	return e.Buffers[e.Current]
 }
 
+// Find returns the index of the buffer editing path, or -1.
+func (e *Editor) Find(path string) int {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return -1
+	}
+	for i, bs := range e.Buffers {
+		if bs.FilePath == "" {
+			continue
+		}
+		if p, err := filepath.Abs(bs.FilePath); err == nil && p == abs {
+			return i
+		}
+	}
+	return -1
+}
+
+// Focus makes buffer i the current one and returns it.
+func (e *Editor) Focus(i int) BufferState {
+	if i < 0 || i >= len(e.Buffers) {
+		return BufferState{}
+	}
+	e.Current = i
+	return e.Buffers[i]
+}
+
 // LoadFile reads a file and adds it as a new buffer.
 func (e *Editor) LoadFile(path string) (BufferState, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return BufferState{}, err
 	}
-	normalized := strings.ReplaceAll(string(data), "\r\n", "\n")
-	gb := buffer.NewGapBufferFromString(normalized)
-	bs := BufferState{FilePath: path, Buf: gb, Cursor: gb.Len(), Dirty: false}
+	text, format, enc := DecodeFile(data)
+	buf := buffer.NewFromString(e.Storage, text)
+	bs := BufferState{FilePath: path, Buf: buf, Cursor: buf.Len(), Dirty: false, Format: format, Encoding: enc, Disk: DiskInfoFor(path, data)}
 	e.AddBuffer(bs)
 	return bs, nil
 }
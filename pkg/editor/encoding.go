@@ -0,0 +1,312 @@
+package editor
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+)
+
+// Encoding names a character encoding supported for reading and writing
+// files. The zero value means UTF-8.
+type Encoding string
+
+const (
+	EncodingUTF8        Encoding = "UTF-8"
+	EncodingUTF16LE     Encoding = "UTF-16LE"
+	EncodingUTF16BE     Encoding = "UTF-16BE"
+	EncodingUTF32LE     Encoding = "UTF-32LE"
+	EncodingUTF32BE     Encoding = "UTF-32BE"
+	EncodingLatin1      Encoding = "ISO-8859-1"
+	EncodingWindows1252 Encoding = "Windows-1252"
+	EncodingShiftJIS    Encoding = "Shift_JIS"
+)
+
+// Encodings lists the supported encodings in the order offered to users.
+var Encodings = []Encoding{
+	EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE, EncodingUTF32LE, EncodingUTF32BE,
+	EncodingLatin1, EncodingWindows1252, EncodingShiftJIS,
+}
+
+// String returns the canonical name, treating the zero value as UTF-8.
+func (e Encoding) String() string {
+	if e == "" {
+		return string(EncodingUTF8)
+	}
+	return string(e)
+}
+
+// ParseEncoding resolves a user supplied encoding name such as "latin1",
+// "cp1252" or "sjis".
+func ParseEncoding(name string) (Encoding, error) {
+	key := strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(name)))
+	switch key {
+	case "", "utf8":
+		return EncodingUTF8, nil
+	case "utf16", "utf16le":
+		return EncodingUTF16LE, nil
+	case "utf16be":
+		return EncodingUTF16BE, nil
+	case "utf32", "utf32le":
+		return EncodingUTF32LE, nil
+	case "utf32be":
+		return EncodingUTF32BE, nil
+	case "latin1", "iso88591", "l1":
+		return EncodingLatin1, nil
+	case "windows1252", "cp1252", "win1252":
+		return EncodingWindows1252, nil
+	case "shiftjis", "sjis", "cp932", "mskanji":
+		return EncodingShiftJIS, nil
+	}
+	return EncodingUTF8, fmt.Errorf("unknown encoding: %s", name)
+}
+
+func (e Encoding) codec() encoding.Encoding {
+	switch e {
+	case EncodingUTF16LE:
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case EncodingUTF16BE:
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	case EncodingUTF32LE:
+		return utf32.UTF32(utf32.LittleEndian, utf32.IgnoreBOM)
+	case EncodingUTF32BE:
+		return utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM)
+	case EncodingLatin1:
+		return charmap.ISO8859_1
+	case EncodingWindows1252:
+		return charmap.Windows1252
+	case EncodingShiftJIS:
+		return japanese.ShiftJIS
+	}
+	return nil
+}
+
+// bom returns the byte order mark for e, or nil for encodings without one.
+func (e Encoding) bom() []byte {
+	switch e {
+	case "", EncodingUTF8:
+		return utf8BOM
+	case EncodingUTF16LE:
+		return []byte{0xFF, 0xFE}
+	case EncodingUTF16BE:
+		return []byte{0xFE, 0xFF}
+	case EncodingUTF32LE:
+		return []byte{0xFF, 0xFE, 0x00, 0x00}
+	case EncodingUTF32BE:
+		return []byte{0x00, 0x00, 0xFE, 0xFF}
+	}
+	return nil
+}
+
+// DetectEncoding guesses the encoding of data. Byte order marks are trusted
+// first; otherwise UTF-16 is recognized by its zero bytes, valid UTF-8 is
+// accepted as is, and remaining data is tested against Shift_JIS before
+// falling back to Windows-1252 or ISO-8859-1. Data with a byte Windows-1252
+// leaves undefined is ISO-8859-1.
+func DetectEncoding(data []byte) Encoding {
+	for _, e := range []Encoding{EncodingUTF32LE, EncodingUTF32BE, EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE} {
+		if bytes.HasPrefix(data, e.bom()) {
+			return e
+		}
+	}
+	if e, ok := detectUTF16(data); ok {
+		return e
+	}
+	if utf8.Valid(data) {
+		return EncodingUTF8
+	}
+	if looksShiftJIS(data) {
+		return EncodingShiftJIS
+	}
+	c1 := false
+	for _, b := range data {
+		switch b {
+		case 0x81, 0x8D, 0x8F, 0x90, 0x9D:
+			// undefined in Windows-1252, so they could not be saved back
+			return EncodingLatin1
+		}
+		if b >= 0x80 && b <= 0x9F {
+			// C1 range: printable in Windows-1252, control codes in Latin-1
+			c1 = true
+		}
+	}
+	if c1 {
+		return EncodingWindows1252
+	}
+	return EncodingLatin1
+}
+
+// detectUTF16 recognizes BOM-less UTF-16 from the share of zero high bytes,
+// which is large for text dominated by ASCII characters.
+func detectUTF16(data []byte) (Encoding, bool) {
+	n := len(data)
+	if n > 4096 {
+		n = 4096
+	}
+	n &^= 1
+	if n < 4 {
+		return "", false
+	}
+	var evenZeros, oddZeros int
+	for i := 0; i < n; i += 2 {
+		if data[i] == 0 {
+			evenZeros++
+		}
+		if data[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	pairs := n / 2
+	switch {
+	case oddZeros*10 >= pairs*4 && evenZeros*10 < pairs:
+		return EncodingUTF16LE, true
+	case evenZeros*10 >= pairs*4 && oddZeros*10 < pairs:
+		return EncodingUTF16BE, true
+	}
+	return "", false
+}
+
+// looksShiftJIS reports whether data is well-formed Shift_JIS containing kana
+// double-byte characters. Requiring kana avoids mistaking Latin-1 text whose
+// accented letters happen to pair up with the following byte.
+func looksShiftJIS(data []byte) bool {
+	kana := false
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		switch {
+		case b < 0x80 || (b >= 0xA1 && b <= 0xDF):
+			// ASCII or half-width katakana
+		case (b >= 0x81 && b <= 0x9F) || (b >= 0xE0 && b <= 0xFC):
+			if i+1 >= len(data) {
+				return false
+			}
+			t := data[i+1]
+			if t < 0x40 || t == 0x7F || t > 0xFC {
+				return false
+			}
+			if b == 0x82 || b == 0x83 {
+				kana = true
+			}
+			i++
+		default:
+			return false
+		}
+	}
+	return kana
+}
+
+// DecodeFile detects the encoding of data and decodes it as DecodeFileAs
+// does.
+func DecodeFile(data []byte) (string, FileFormat, Encoding) {
+	enc := DetectEncoding(data)
+	text, format, err := DecodeFileAs(data, enc)
+	if err != nil {
+		// detection only picks encodings that decode data; fall back to
+		// UTF-8 with replacement characters if that ever fails
+		text, format = DecodeText(data)
+		return text, format, EncodingUTF8
+	}
+	return text, format, enc
+}
+
+// DecodeFileAs decodes data from enc, strips a matching byte order mark and
+// normalizes line endings to '\n'.
+func DecodeFileAs(data []byte, enc Encoding) (string, FileFormat, error) {
+	codec := enc.codec()
+	if codec == nil {
+		text, f := DecodeText(data)
+		return text, f, nil
+	}
+	bom := false
+	if mark := enc.bom(); mark != nil && bytes.HasPrefix(data, mark) {
+		bom = true
+		data = data[len(mark):]
+	}
+	decoded, err := codec.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", FileFormat{}, err
+	}
+	text, f := normalizeLineEndings(decoded)
+	f.BOM = bom
+	return text, f, nil
+}
+
+// EncodeFile converts normalized buffer text to bytes in enc using the line
+// ending and BOM from f. If some characters cannot be represented in enc it
+// returns an *UnencodableError; EncodeFileLossy writes them as substitutes.
+func EncodeFile(text string, f FileFormat, enc Encoding) ([]byte, error) {
+	codec := enc.codec()
+	if codec == nil {
+		return f.EncodeText(text), nil
+	}
+	if lost := Unencodable(text, enc); len(lost) > 0 {
+		return nil, &UnencodableError{Encoding: enc, Runes: lost}
+	}
+	return encodeWith(codec.NewEncoder(), text, f, enc)
+}
+
+// EncodeFileLossy is like EncodeFile but replaces characters that enc cannot
+// represent with the encoding's substitute character.
+func EncodeFileLossy(text string, f FileFormat, enc Encoding) ([]byte, error) {
+	codec := enc.codec()
+	if codec == nil {
+		return f.EncodeText(text), nil
+	}
+	return encodeWith(encoding.ReplaceUnsupported(codec.NewEncoder()), text, f, enc)
+}
+
+func encodeWith(e *encoding.Encoder, text string, f FileFormat, enc Encoding) ([]byte, error) {
+	out, err := e.Bytes([]byte(f.withLineEndings(text)))
+	if err != nil {
+		return nil, err
+	}
+	if mark := enc.bom(); f.BOM && mark != nil {
+		out = append(append([]byte(nil), mark...), out...)
+	}
+	return out, nil
+}
+
+// Unencodable returns the distinct characters of text that enc cannot
+// represent, in order of first appearance.
+func Unencodable(text string, enc Encoding) []rune {
+	codec := enc.codec()
+	if codec == nil {
+		return nil
+	}
+	if _, err := codec.NewEncoder().String(text); err == nil {
+		return nil
+	}
+	e := codec.NewEncoder()
+	seen := map[rune]bool{}
+	var lost []rune
+	for _, r := range text {
+		if seen[r] {
+			continue
+		}
+		seen[r] = true
+		if _, err := e.String(string(r)); err != nil {
+			lost = append(lost, r)
+		}
+	}
+	return lost
+}
+
+// UnencodableError reports characters that would be lost when saving.
+type UnencodableError struct {
+	Encoding Encoding
+	Runes    []rune
+}
+
+func (e *UnencodableError) Error() string {
+	sample := e.Runes
+	if len(sample) > 10 {
+		sample = sample[:10]
+	}
+	return fmt.Sprintf("%d characters cannot be saved as %s: %s", len(e.Runes), e.Encoding, string(sample))
+}
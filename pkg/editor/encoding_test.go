@@ -0,0 +1,87 @@
+package editor
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Encoding
+	}{
+		{"plain ascii\n", EncodingUTF8},
+		{"caf\xC3\xA9\n", EncodingUTF8},
+		{"caf\xE9\n", EncodingLatin1},
+		{"\x93quoted\x94 caf\xE9\n", EncodingWindows1252},
+		{"\x93quoted\x94 \x81\n", EncodingLatin1},
+		{"\x82\xB1\x82\xF1\x82\xC9\x82\xBF\x82\xCD\n", EncodingShiftJIS},
+		{"\xFF\xFEh\x00i\x00", EncodingUTF16LE},
+		{"\xFE\xFF\x00h\x00i", EncodingUTF16BE},
+		{"h\x00e\x00l\x00l\x00o\x00", EncodingUTF16LE},
+		{"\xFF\xFE\x00\x00h\x00\x00\x00", EncodingUTF32LE},
+		{"\x00\x00\xFE\xFF\x00\x00\x00h", EncodingUTF32BE},
+	}
+	for _, c := range cases {
+		if got := DetectEncoding([]byte(c.in)); got != c.want {
+			t.Fatalf("DetectEncoding(%q) = %s, want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestDecodeFile_RoundTrip(t *testing.T) {
+	cases := []struct {
+		in   string
+		text string
+		enc  Encoding
+	}{
+		{"caf\xE9\r\nna\xEFve\r\n", "café\nnaïve\n", EncodingLatin1},
+		{"\x93hi\x94\n", "“hi”\n", EncodingWindows1252},
+		{"\x93hi\x9D\n", "\u0093hi\u009d\n", EncodingLatin1},
+		{"\x82\xB1\x82\xF1\x82\xC9\x82\xBF\x82\xCD", "こんにちは", EncodingShiftJIS},
+		{"\xFF\xFEa\x00\r\x00\n\x00\xE9\x00", "a\né", EncodingUTF16LE},
+		{"\x00\x00\xFE\xFF\x00\x00\x00a\x00\x00\x00\n", "a\n", EncodingUTF32BE},
+		// mixed line endings are kept as they are
+		{"caf\xE9\r\nb\nc\r\n", "café\r\nb\nc\r\n", EncodingLatin1},
+		{"\xFF\xFEa\x00\r\x00\n\x00b\x00\n\x00c\x00\r\x00\n\x00", "a\r\nb\nc\r\n", EncodingUTF16LE},
+	}
+	for _, c := range cases {
+		text, f, enc := DecodeFile([]byte(c.in))
+		if text != c.text || enc != c.enc {
+			t.Fatalf("DecodeFile(%q) = %q %s, want %q %s", c.in, text, enc, c.text, c.enc)
+		}
+		out, err := EncodeFile(text, f, enc)
+		if err != nil {
+			t.Fatalf("EncodeFile(%q, %s): %v", text, enc, err)
+		}
+		if string(out) != c.in {
+			t.Fatalf("round trip of %q as %s produced %q", c.in, enc, out)
+		}
+	}
+}
+
+func TestEncodeFile_ReportsLostCharacters(t *testing.T) {
+	_, err := EncodeFile("café ☃ ☃ 日", FileFormat{}, EncodingLatin1)
+	var lossy *UnencodableError
+	if !errors.As(err, &lossy) {
+		t.Fatalf("expected UnencodableError, got %v", err)
+	}
+	if string(lossy.Runes) != "☃日" {
+		t.Fatalf("unexpected lost runes %q", string(lossy.Runes))
+	}
+	out, err := EncodeFileLossy("café ☃", FileFormat{}, EncodingLatin1)
+	if err != nil || string(out) != "caf\xE9 \x1A" {
+		t.Fatalf("lossy encode = %q, %v", out, err)
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	for name, want := range map[string]Encoding{"latin1": EncodingLatin1, "CP1252": EncodingWindows1252, "sjis": EncodingShiftJIS, "utf-16be": EncodingUTF16BE, "UTF8": EncodingUTF8} {
+		if got, err := ParseEncoding(name); err != nil || got != want {
+			t.Fatalf("ParseEncoding(%q) = %s, %v", name, got, err)
+		}
+	}
+	if _, err := ParseEncoding("klingon"); err == nil {
+		t.Fatal("expected error for unknown encoding")
+	}
+}
@@ -0,0 +1,188 @@
+package editor
+
+import (
+	"bytes"
+	"strings"
+)
+
+// LineEnding identifies the newline sequence a file uses.
+type LineEnding int
+
+const (
+	LineEndingLF LineEnding = iota
+	LineEndingCRLF
+	LineEndingCR
+)
+
+// String returns the conventional short name of the line ending.
+func (l LineEnding) String() string {
+	switch l {
+	case LineEndingCRLF:
+		return "CRLF"
+	case LineEndingCR:
+		return "CR"
+	default:
+		return "LF"
+	}
+}
+
+// Sequence returns the bytes written for each newline.
+func (l LineEnding) Sequence() string {
+	switch l {
+	case LineEndingCRLF:
+		return "\r\n"
+	case LineEndingCR:
+		return "\r"
+	default:
+		return "\n"
+	}
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// FileFormat records the on-disk details that are normalized away while a
+// file is edited: buffers hold '\n' line endings and no BOM. Files mixing
+// line ending styles are the exception; see Mixed.
+type FileFormat struct {
+	// LineEnding is written on save. For mixed files it is the most common
+	// ending found at load.
+	LineEnding LineEnding
+	// Mixed reports that the file contained more than one line ending style.
+	// Such files are not normalized: the buffer keeps each "\r\n" as found,
+	// and saving writes it back unchanged until the line ending is set
+	// explicitly. In a file that mostly ends lines with '\r' the lone '\r's
+	// still become '\n' so its lines show as lines; they are written back as
+	// '\r', as is any lone '\n'.
+	Mixed bool
+	// BOM reports a leading byte order mark in the file's encoding.
+	BOM bool
+	// FinalNewline reports whether the file ended with a line ending (empty
+	// files count as terminated).
+	FinalNewline bool
+}
+
+// DecodeText strips a UTF-8 BOM, detects the line ending style and returns
+// the text normalized to '\n' line endings together with its format.
+func DecodeText(data []byte) (string, FileFormat) {
+	bom := bytes.HasPrefix(data, utf8BOM)
+	if bom {
+		data = data[len(utf8BOM):]
+	}
+	text, f := normalizeLineEndings(data)
+	f.BOM = bom
+	return text, f
+}
+
+// normalizeLineEndings replaces the line endings of already decoded text
+// with '\n' and records which style the file used. A lone '\r' ends a line
+// only in files that mostly use them; elsewhere it is an ordinary character.
+// Mixed files keep their "\r\n"s.
+func normalizeLineEndings(data []byte) (string, FileFormat) {
+	var f FileFormat
+	var lf, crlf, cr int
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '\r':
+			if i+1 < len(data) && data[i+1] == '\n' {
+				crlf++
+				i++
+			} else {
+				cr++
+			}
+		case '\n':
+			lf++
+		}
+	}
+	f.LineEnding = LineEndingLF
+	switch {
+	case cr > lf && cr > crlf:
+		f.LineEnding = LineEndingCR
+	case crlf > lf:
+		f.LineEnding = LineEndingCRLF
+	}
+	f.Mixed = lf > 0 && crlf > 0 || f.LineEnding == LineEndingCR && lf+crlf > 0
+	text := string(data)
+	switch {
+	case f.Mixed && f.LineEnding == LineEndingCR:
+		text = replaceLone(text, '\r', '\n')
+	case f.Mixed:
+	case f.LineEnding == LineEndingCRLF:
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	case f.LineEnding == LineEndingCR:
+		text = strings.ReplaceAll(text, "\r", "\n")
+	}
+	f.FinalNewline = text == "" || strings.HasSuffix(text, "\n")
+	return text, f
+}
+
+// replaceLone replaces each from byte that is not part of a "\r\n" with to.
+func replaceLone(text string, from, to byte) string {
+	b := []byte(text)
+	for i, c := range b {
+		if c != from {
+			continue
+		}
+		if c == '\r' && i+1 < len(b) && b[i+1] == '\n' || c == '\n' && i > 0 && text[i-1] == '\r' {
+			continue
+		}
+		b[i] = to
+	}
+	return string(b)
+}
+
+// withLineEndings returns buffer text with the line endings written for f.
+func (f FileFormat) withLineEndings(text string) string {
+	switch {
+	case f.LineEnding == LineEndingLF:
+		return text
+	case !f.Mixed:
+		return strings.ReplaceAll(text, "\n", f.LineEnding.Sequence())
+	case f.LineEnding == LineEndingCR:
+		return replaceLone(text, '\n', '\r')
+	}
+	return text
+}
+
+// EncodeText converts '\n'-normalized buffer text back to the file's line
+// ending and BOM. Mixed files keep their "\r\n"s; see FileFormat.Mixed.
+func (f FileFormat) EncodeText(text string) []byte {
+	text = f.withLineEndings(text)
+	if !f.BOM {
+		return []byte(text)
+	}
+	out := make([]byte, 0, len(utf8BOM)+len(text))
+	out = append(out, utf8BOM...)
+	return append(out, text...)
+}
+
+// LineEndingEdits returns the positions, in runes, of the '\r' of each
+// "\r\n" in the text of a mixed file, which are deleted for it to hold '\n'
+// line endings only.
+func (f FileFormat) LineEndingEdits(text string) (deletes []int) {
+	if !f.Mixed {
+		return nil
+	}
+	rs := []rune(text)
+	for i, r := range rs {
+		if r == '\r' && i+1 < len(rs) && rs[i+1] == '\n' {
+			deletes = append(deletes, i)
+		}
+	}
+	return deletes
+}
+
+// Describe returns a short summary for the status line, such as "CRLF BOM"
+// or "LF (mixed) noeol".
+func (f FileFormat) Describe() string {
+	parts := []string{f.LineEnding.String()}
+	if f.Mixed {
+		parts[0] += " (mixed)"
+	}
+	if f.BOM {
+		parts = append(parts, "BOM")
+	}
+	if !f.FinalNewline {
+		parts = append(parts, "noeol")
+	}
+	return strings.Join(parts, " ")
+}
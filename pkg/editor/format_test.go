@@ -0,0 +1,57 @@
+package editor
+
+import "testing"
+
+func TestDecodeText_DetectsFormat(t *testing.T) {
+	cases := []struct {
+		in     string
+		text   string
+		format FileFormat
+	}{
+		{"a\nb\n", "a\nb\n", FileFormat{LineEnding: LineEndingLF, FinalNewline: true}},
+		{"a\r\nb", "a\nb", FileFormat{LineEnding: LineEndingCRLF}},
+		{"a\rb\r", "a\nb\n", FileFormat{LineEnding: LineEndingCR, FinalNewline: true}},
+		{"\xEF\xBB\xBFa\r\nb\r\nc\n", "a\r\nb\r\nc\n", FileFormat{LineEnding: LineEndingCRLF, Mixed: true, BOM: true, FinalNewline: true}},
+		{"a^\rM\nb\n", "a^\rM\nb\n", FileFormat{LineEnding: LineEndingLF, FinalNewline: true}},
+		{"a\r\r\nb\r\n", "a\r\nb\n", FileFormat{LineEnding: LineEndingCRLF, FinalNewline: true}},
+		{"a\rb\nc\r\r\n", "a\nb\nc\n\r\n", FileFormat{LineEnding: LineEndingCR, Mixed: true, FinalNewline: true}},
+		{"", "", FileFormat{FinalNewline: true}},
+	}
+	for _, c := range cases {
+		text, f := DecodeText([]byte(c.in))
+		if text != c.text || f != c.format {
+			t.Fatalf("DecodeText(%q) = %q %+v, want %q %+v", c.in, text, f, c.text, c.format)
+		}
+	}
+}
+
+func TestFileFormat_RoundTrip(t *testing.T) {
+	for _, in := range []string{"a\r\nb\r\n", "\xEF\xBB\xBFx\ry", "plain\n", "lf\nwith\r^M\n", "mixed\r\nlf\ncrlf\r\n", "cr\rcrlf\r\ncr\r"} {
+		text, f := DecodeText([]byte(in))
+		if got := string(f.EncodeText(text)); got != in {
+			t.Fatalf("round trip of %q produced %q", in, got)
+		}
+	}
+	// a file mostly ending lines with '\r' is split on them; a stray '\n'
+	// is written back as '\r'
+	if text, f := DecodeText([]byte("cr\rlf\ncr\r")); string(f.EncodeText(text)) != "cr\rlf\rcr\r" {
+		t.Fatalf("unexpected save of %q", text)
+	}
+	f := FileFormat{LineEnding: LineEndingCRLF, BOM: true}
+	if got := f.Describe(); got != "CRLF BOM noeol" {
+		t.Fatalf("unexpected description %q", got)
+	}
+}
+
+func TestFileFormat_LineEndingEdits(t *testing.T) {
+	text, f := DecodeText([]byte("a\r\nb\nc\r\n"))
+	deletes := f.LineEndingEdits(text)
+	if len(deletes) != 2 || deletes[0] != 1 || deletes[1] != 6 {
+		t.Fatalf("unexpected edits %v", deletes)
+	}
+	text, f = DecodeText([]byte("a\rb\rc\r\nd\n"))
+	deletes = f.LineEndingEdits(text)
+	if text != "a\nb\nc\r\nd\n" || len(deletes) != 1 || deletes[0] != 5 {
+		t.Fatalf("unexpected edits %v of %q", deletes, text)
+	}
+}
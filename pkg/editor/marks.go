@@ -0,0 +1,51 @@
+package editor
+
+import (
+	"encoding/json"
+	"os"
+
+	"example.com/texteditor/pkg/state"
+)
+
+// Marks is the on-disk record of Vim-style marks. Positions are rune
+// offsets; files are absolute paths.
+type Marks struct {
+	// Global holds the file marks A-Z.
+	Global map[string]FileMark `json:"global,omitempty"`
+	// Local holds the marks a-z of each file.
+	Local map[string]map[string]int `json:"local,omitempty"`
+}
+
+// FileMark is a position in a file.
+type FileMark struct {
+	Path string `json:"path"`
+	Pos  int    `json:"pos"`
+}
+
+// DefaultMarksPath returns ~/.texteditor/marks.json, or "" if the home
+// directory is unknown.
+func DefaultMarksPath() string {
+	return state.Path("marks.json")
+}
+
+// ReadMarks loads marks written by WriteFile.
+func ReadMarks(path string) (*Marks, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Marks{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WriteFile stores m at path.
+func (m *Marks) WriteFile(path string) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return state.WriteFile(path, data)
+}
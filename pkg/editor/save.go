@@ -0,0 +1,228 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BackupMode selects what WriteFile keeps of the previous file contents.
+type BackupMode int
+
+const (
+	// BackupNone keeps no copy.
+	BackupNone BackupMode = iota
+	// BackupSimple keeps a single "file~" copy, replaced on every save.
+	BackupSimple
+	// BackupNumbered keeps "file.~1~", "file.~2~", ... one per save.
+	BackupNumbered
+)
+
+// ParseBackupMode converts a config value ("none", "simple" or "numbered")
+// to a BackupMode. Empty selects BackupNone.
+func ParseBackupMode(s string) (BackupMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "none", "off", "false":
+		return BackupNone, nil
+	case "simple", "on", "true":
+		return BackupSimple, nil
+	case "numbered":
+		return BackupNumbered, nil
+	}
+	return BackupNone, fmt.Errorf("unknown backup mode: %s", s)
+}
+
+// SaveOptions configures WriteFile.
+type SaveOptions struct {
+	Backup BackupMode
+	// BackupDir, when set, collects backups in one directory instead of
+	// next to each file. Backup names there encode the file's full path.
+	BackupDir string
+}
+
+// maxSymlinkHops bounds symlink resolution so loops fail instead of spinning.
+const maxSymlinkHops = 40
+
+// WriteFile replaces the file at path with data without ever leaving a
+// truncated file behind: data goes to a temporary file in the same directory
+// which is synced and then renamed over the target. Symlinks are followed so
+// the link survives and the real file is replaced, and the target's mode and
+// (where possible) ownership are kept. Files with several hard links are
+// rewritten in place instead, since a rename would split them from their
+// other names. New files are created with mode 0644.
+func WriteFile(path string, data []byte, opts SaveOptions) error {
+	target, err := resolveSymlinks(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(target)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if exists && !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", target)
+	}
+	if exists && opts.Backup != BackupNone {
+		if err := writeBackup(target, info, opts); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+	}
+	if exists && linkCount(info) > 1 {
+		return writeInPlace(target, data)
+	}
+	mode := os.FileMode(0644)
+	if exists {
+		mode = info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	}
+	return writeAndRename(target, data, mode, info)
+}
+
+// resolveSymlinks follows path to the file it ultimately names. Unlike
+// filepath.EvalSymlinks it accepts a dangling final link, so saving through
+// a link to a not yet created file creates the file rather than replacing
+// the link.
+func resolveSymlinks(path string) (string, error) {
+	for i := 0; i < maxSymlinkHops; i++ {
+		fi, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return path, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return path, nil
+		}
+		dest, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(filepath.Dir(path), dest)
+		}
+		path = dest
+	}
+	return "", fmt.Errorf("too many levels of symbolic links: %s", path)
+}
+
+func writeAndRename(target string, data []byte, mode os.FileMode, orig os.FileInfo) (err error) {
+	dir, base := filepath.Split(target)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	// CreateTemp uses 0600; apply the final mode explicitly so the umask
+	// does not strip bits the original file had
+	if err = tmp.Chmod(mode); err != nil {
+		return err
+	}
+	if orig != nil {
+		copyOwner(tmp, orig)
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// writeInPlace overwrites target through its existing inode.
+func writeInPlace(target string, data []byte) error {
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir flushes a directory entry change such as a rename. Not every
+// platform supports syncing directories, so failures are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
+
+// BackupPath returns where the backup of target is written for opts. For
+// numbered backups it is the next unused number.
+func BackupPath(target string, opts SaveOptions) (string, error) {
+	dir, base := filepath.Split(target)
+	if opts.BackupDir != "" {
+		abs, err := filepath.Abs(target)
+		if err != nil {
+			return "", err
+		}
+		dir = opts.BackupDir
+		base = strings.ReplaceAll(abs, string(filepath.Separator), "!")
+	}
+	if opts.Backup != BackupNumbered {
+		return filepath.Join(dir, base+"~"), nil
+	}
+	next := 1
+	matches, err := filepath.Glob(filepath.Join(dir, globEscape(base)+".~*~"))
+	if err != nil {
+		return "", err
+	}
+	for _, m := range matches {
+		num := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(m), base+".~"), "~")
+		if n, err := strconv.Atoi(num); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s.~%d~", base, next)), nil
+}
+
+func globEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`)
+	return r.Replace(s)
+}
+
+// writeBackup copies the current contents of target to its backup path.
+func writeBackup(target string, info os.FileInfo, opts SaveOptions) error {
+	if opts.BackupDir != "" {
+		if err := os.MkdirAll(opts.BackupDir, 0700); err != nil {
+			return err
+		}
+	}
+	dst, err := BackupPath(target, opts)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return err
+	}
+	return writeAndRename(dst, data, info.Mode().Perm(), nil)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package editor
+
+import "os"
+
+func linkCount(info os.FileInfo) int { return 1 }
+
+func copyOwner(f *os.File, orig os.FileInfo) {}
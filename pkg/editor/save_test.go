@@ -0,0 +1,92 @@
+//go:build unix
+
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile_PreservesModeAndSymlink(t *testing.T) {
+	dir := t.TempDir()
+	real := filepath.Join(dir, "script.sh")
+	if err := os.WriteFile(real, []byte("old"), 0755); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	link := filepath.Join(dir, "link.sh")
+	if err := os.Symlink("script.sh", link); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if err := WriteFile(link, []byte("new"), SaveOptions{}); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("symlink replaced by save: %v", err)
+	}
+	fi, _ := os.Stat(real)
+	if fi.Mode().Perm() != 0755 {
+		t.Fatalf("expected mode 0755, got %v", fi.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(real); string(data) != "new" {
+		t.Fatalf("unexpected contents %q", data)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Fatalf("expected no leftover temp files, found %d entries", len(entries))
+	}
+}
+
+func TestWriteFile_KeepsHardLinks(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+	_ = os.WriteFile(a, []byte("old"), 0644)
+	if err := os.Link(a, b); err != nil {
+		t.Skipf("hard links unsupported: %v", err)
+	}
+	if err := WriteFile(a, []byte("new"), SaveOptions{}); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if data, _ := os.ReadFile(b); string(data) != "new" {
+		t.Fatalf("hard link not updated: %q", data)
+	}
+}
+
+func TestWriteFile_Backups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	_ = os.WriteFile(path, []byte("v1"), 0600)
+	if err := WriteFile(path, []byte("v2"), SaveOptions{Backup: BackupSimple}); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if data, _ := os.ReadFile(path + "~"); string(data) != "v1" {
+		t.Fatalf("unexpected simple backup %q", data)
+	}
+	for _, v := range []string{"v3", "v4"} {
+		if err := WriteFile(path, []byte(v), SaveOptions{Backup: BackupNumbered}); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	if data, _ := os.ReadFile(path + ".~1~"); string(data) != "v2" {
+		t.Fatalf("unexpected first numbered backup %q", data)
+	}
+	if data, _ := os.ReadFile(path + ".~2~"); string(data) != "v3" {
+		t.Fatalf("unexpected second numbered backup %q", data)
+	}
+	backups := filepath.Join(dir, "backups")
+	opts := SaveOptions{Backup: BackupSimple, BackupDir: backups}
+	if err := WriteFile(path, []byte("v5"), opts); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	dst, _ := BackupPath(path, opts)
+	if filepath.Dir(dst) != backups {
+		t.Fatalf("backup outside backup dir: %s", dst)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "v4" {
+		t.Fatalf("unexpected backup dir copy %q", data)
+	}
+	if fi, _ := os.Stat(dst); fi.Mode().Perm() != 0600 {
+		t.Fatalf("backup should keep mode 0600, got %v", fi.Mode().Perm())
+	}
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package editor
+
+import (
+	"os"
+	"syscall"
+)
+
+// linkCount returns the number of hard links to the file described by info.
+func linkCount(info os.FileInfo) int {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(st.Nlink)
+	}
+	return 1
+}
+
+// copyOwner gives f the owner and group of orig. Only root may change the
+// owner, so failures are ignored and the file keeps the saving user's.
+func copyOwner(f *os.File, orig os.FileInfo) {
+	if st, ok := orig.Sys().(*syscall.Stat_t); ok {
+		_ = f.Chown(int(st.Uid), int(st.Gid))
+	}
+}
@@ -0,0 +1,262 @@
+// Package grep searches the files of a project tree for a query, skipping
+// what .gitignore excludes and binary files.
+package grep
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"example.com/texteditor/pkg/editor"
+	"example.com/texteditor/pkg/search"
+)
+
+// Hit is one match found in a file.
+type Hit struct {
+	// Path is the file, relative to the root searched.
+	Path string
+	// Line and Col locate the start of the match, counting from 1; Col
+	// counts characters.
+	Line, Col int
+	// Text is the line the match starts on, without its line ending.
+	Text string
+}
+
+// String formats the hit as "path:line:col: text".
+func (h Hit) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", h.Path, h.Line, h.Col, h.Text)
+}
+
+var hitLine = regexp.MustCompile(`^(.+?):(\d+):(\d+): ?(.*)$`)
+
+// Parse reads back a line written by Hit.String. ok is false for lines in
+// another form.
+func Parse(line string) (h Hit, ok bool) {
+	m := hitLine.FindStringSubmatch(line)
+	if m == nil {
+		return Hit{}, false
+	}
+	h.Path, h.Text = m[1], m[4]
+	var err1, err2 error
+	h.Line, err1 = strconv.Atoi(m[2])
+	h.Col, err2 = strconv.Atoi(m[3])
+	if err1 != nil || err2 != nil || h.Line < 1 || h.Col < 1 {
+		return Hit{}, false
+	}
+	return h, true
+}
+
+// File is a file with hits, as Run reports it.
+type File struct {
+	// Path is the file, relative to the root searched.
+	Path string
+	Hits []Hit
+	// Data is the file as it was searched, so callers can tell whether it
+	// changed since.
+	Data []byte
+}
+
+// Options controls a search.
+type Options struct {
+	Search search.Options
+	// Workers is the number of files searched at once; 0 means one per
+	// CPU.
+	Workers int
+}
+
+// Stats sums up a search.
+type Stats struct {
+	Files int // text files searched
+	Hits  int
+}
+
+// binaryProbe is how much of a file is checked for NUL bytes, which mark it
+// as binary, as git does.
+const binaryProbe = 8000
+
+// Run searches the files below root for query. The tree is walked in one
+// goroutine, skipping .git and whatever the .gitignore files along the way
+// exclude, while opt.Workers goroutines search the files. emit receives each
+// file that has hits, with its hits in order; files arrive as they are done,
+// and emit is never called concurrently. Run returns once every file is
+// searched, or ctx.Err() when cancelled.
+func Run(ctx context.Context, root, query string, opt Options, emit func(File)) (Stats, error) {
+	if opt.Search.Regex {
+		if _, err := search.Compile(query, opt.Search); err != nil {
+			return Stats{}, err
+		}
+	}
+	workers := opt.Workers
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	paths := make(chan string)
+	var (
+		mu    sync.Mutex
+		stats Stats
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range paths {
+				f, ok := searchFile(root, p, query, opt.Search)
+				if !ok || ctx.Err() != nil {
+					continue
+				}
+				mu.Lock()
+				stats.Files++
+				stats.Hits += len(f.Hits)
+				if len(f.Hits) > 0 {
+					emit(f)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	err := walk(ctx, root, paths)
+	close(paths)
+	wg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+	return stats, err
+}
+
+// walk sends the path of each file below root that is not ignored to paths,
+// relative to root.
+func walk(ctx context.Context, root string, paths chan<- string) error {
+	// the .gitignore files in effect, from the root down to the directory
+	// being walked
+	var stack []*ignoreFile
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// unreadable entries are skipped rather than ending the search
+			if d != nil && d.IsDir() && p != root {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+		for len(stack) > 0 && !within(rel, stack[len(stack)-1].dir) {
+			stack = stack[:len(stack)-1]
+		}
+		if d.IsDir() {
+			if rel != "" && (d.Name() == ".git" || ignored(stack, rel, true)) {
+				return fs.SkipDir
+			}
+			if ig := readIgnoreFile(p, rel); ig != nil {
+				stack = append(stack, ig)
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || ignored(stack, rel, false) {
+			return nil
+		}
+		select {
+		case paths <- filepath.FromSlash(rel):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
+	})
+}
+
+// within reports whether the slash-separated path rel lies in dir, "" being
+// the root.
+func within(rel, dir string) bool {
+	return dir == "" || rel == dir || strings.HasPrefix(rel, dir+"/")
+}
+
+// searchFile searches the file rel below root for query. ok is false for
+// files that cannot be read or are binary.
+func searchFile(root, rel, query string, opt search.Options) (f File, ok bool) {
+	data, err := os.ReadFile(filepath.Join(root, rel))
+	if err != nil {
+		return File{}, false
+	}
+	// UTF-16 and UTF-32 text is full of NUL bytes, so the encoding is
+	// detected before the probe for binary files
+	enc := editor.DetectEncoding(data)
+	switch enc {
+	case editor.EncodingUTF16LE, editor.EncodingUTF16BE, editor.EncodingUTF32LE, editor.EncodingUTF32BE:
+	default:
+		if bytes.IndexByte(data[:min(len(data), binaryProbe)], 0) >= 0 {
+			return File{}, false
+		}
+	}
+	f = File{Path: rel, Data: data}
+	// decoded as the editor loads it, so the hits match the buffer
+	text, _, err := editor.DecodeFileAs(data, enc)
+	if err != nil {
+		return File{}, false
+	}
+	ranges, err := search.Find(text, query, opt)
+	if err != nil {
+		return File{}, false
+	}
+	line, lineStart := 1, 0
+	pos := 0 // bytes before pos are counted into line
+	for _, m := range ranges {
+		for {
+			i := strings.IndexByte(text[pos:m.Start], '\n')
+			if i < 0 {
+				break
+			}
+			pos += i + 1
+			line++
+			lineStart = pos
+		}
+		pos = m.Start
+		end := strings.IndexByte(text[lineStart:], '\n')
+		if end < 0 {
+			end = len(text) - lineStart
+		}
+		f.Hits = append(f.Hits, Hit{
+			Path: rel,
+			Line: line,
+			Col:  utf8.RuneCountInString(text[lineStart:m.Start]) + 1,
+			Text: strings.TrimSuffix(text[lineStart:lineStart+end], "\r"),
+		})
+	}
+	return f, true
+}
+
+// FindRoot returns the project directory containing dir: the nearest one
+// holding a .git, or dir itself if there is none.
+func FindRoot(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	for d := abs; ; {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return abs
+		}
+		d = parent
+	}
+}
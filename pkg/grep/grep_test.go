@@ -0,0 +1,104 @@
+package grep
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"example.com/texteditor/pkg/search"
+)
+
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestRun(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		".gitignore":        "*.log\n/build/\nvendor/**\n!keep.log\n",
+		"main.go":           "package main\n\nfunc main() { todo() }\n",
+		"pkg/a.go":          "\ufeff// TODO: é todo\n",
+		"pkg/.gitignore":    "gen_*.go\n",
+		"pkg/gen_x.go":      "todo\n",
+		"pkg/sub/build/b":   "todo\n",
+		"build/out.txt":     "todo\n",
+		"debug.log":         "todo\n",
+		"keep.log":          "todo\r\n",
+		"vendor/x/y.go":     "todo\n",
+		".git/config":       "todo\n",
+		"image.bin":         "todo\x00\x01",
+		"docs/notes.md":     "nothing here\n",
+		"docs/sub/deep.txt": "x todo\n",
+		"docs/latin1.txt":   "caf\xe9 todo\n",
+		"docs/utf16.txt":    "\xff\xfex\x00 \x00t\x00o\x00d\x00o\x00\n\x00",
+	})
+	var hits []Hit
+	stats, err := Run(context.Background(), root, "todo", Options{Search: search.Options{SmartCase: true}, Workers: 3}, func(f File) {
+		hits = append(hits, f.Hits...)
+	})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	var got []string
+	for _, h := range hits {
+		h.Path = filepath.ToSlash(h.Path)
+		got = append(got, h.String())
+	}
+	sort.Strings(got)
+	want := []string{
+		"docs/sub/deep.txt:1:3: x todo",
+		"docs/latin1.txt:1:6: café todo",
+		"docs/utf16.txt:1:3: x todo",
+		"keep.log:1:1: todo",
+		"main.go:3:15: func main() { todo() }",
+		"pkg/a.go:1:4: // TODO: é todo",
+		"pkg/a.go:1:12: // TODO: é todo",
+		"pkg/sub/build/b:1:1: todo",
+	}
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+	if stats.Hits != 8 || stats.Files != 10 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	if _, err := Run(context.Background(), root, "a(", Options{Search: search.Options{Regex: true}}, func(File) {}); err == nil {
+		t.Fatalf("expected an invalid pattern error")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Run(ctx, root, "todo", Options{}, func(File) {}); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	h := Hit{Path: "dir/a:b.go", Line: 12, Col: 3, Text: " x := 1: y"}
+	got, ok := Parse(h.String())
+	if !ok || got != h {
+		t.Fatalf("round trip gave %+v, %v", got, ok)
+	}
+	for _, line := range []string{"", `grep "x" in /tmp`, "a.go:0:1: x", "a.go:1: x"} {
+		if _, ok := Parse(line); ok {
+			t.Fatalf("expected %q not to parse", line)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package grep
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule is one pattern of a .gitignore file.
+type ignoreRule struct {
+	segments []string // the pattern split at slashes
+	negate   bool     // "!pattern" re-includes what an earlier rule ignored
+	dirOnly  bool     // "pattern/" only matches directories
+	anchored bool     // a slash before the end ties the pattern to its directory
+}
+
+// ignoreFile holds the rules of the .gitignore in dir, a slash-separated
+// path relative to the root searched ("" for the root itself).
+type ignoreFile struct {
+	dir   string
+	rules []ignoreRule
+}
+
+// readIgnoreFile reads the .gitignore in the directory at abs, which is rel
+// below the root. It returns nil if there is none.
+func readIgnoreFile(abs, rel string) *ignoreFile {
+	f, err := os.Open(filepath.Join(abs, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	ig := &ignoreFile{dir: rel}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if rule, ok := parseIgnoreRule(sc.Text()); ok {
+			ig.rules = append(ig.rules, rule)
+		}
+	}
+	return ig
+}
+
+// parseIgnoreRule parses one line of a .gitignore. Blank lines and comments
+// give ok == false.
+func parseIgnoreRule(line string) (rule ignoreRule, ok bool) {
+	line = strings.TrimRight(line, "\r")
+	// trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false
+	}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return rule, false
+	}
+	rule.segments = strings.Split(line, "/")
+	return rule, true
+}
+
+// match reports whether rule matches the path rel, relative to the
+// directory of its .gitignore.
+func (rule ignoreRule) match(rel string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	if !rule.anchored {
+		ok, _ := path.Match(rule.segments[0], path.Base(rel))
+		return ok
+	}
+	return matchSegments(rule.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments matches a path against a pattern segment by segment, where
+// a "**" segment stands for any number of directories.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ignored reports whether the slash-separated path rel, relative to the
+// root, is ignored by the .gitignore files in effect for it, given from
+// the root down. As in git the last matching rule decides.
+func ignored(files []*ignoreFile, rel string, isDir bool) bool {
+	result := false
+	for _, ig := range files {
+		sub := rel
+		if ig.dir != "" {
+			if !strings.HasPrefix(rel, ig.dir+"/") {
+				continue
+			}
+			sub = rel[len(ig.dir)+1:]
+		}
+		for _, rule := range ig.rules {
+			if rule.match(sub, isDir) {
+				result = !rule.negate
+			}
+		}
+	}
+	return result
+}
@@ -2,6 +2,8 @@ package history
 
 import (
     "fmt"
+    "time"
+    "unicode/utf8"
 
     "example.com/texteditor/pkg/buffer"
 )
@@ -22,22 +24,113 @@ type Operation struct {
     Text string
 }
 
-// History keeps stacks of past/future operations for undo/redo.
+// Selection is the cursor and visual selection around an edit group.
+// Anchor is -1 when nothing is selected.
+type Selection struct {
+    Cursor   int
+    Anchor   int
+    Linewise bool
+}
+
+// node is one state of the undo tree: the text after applying ops to the
+// parent's text. The root is the text the history started from.
+type node struct {
+    seq      int
+    parent   *node
+    ops      []Operation
+    time     time.Time
+    children []*node
+    // redo is the child Redo moves to: the one most recently created or
+    // left by Undo.
+    redo int
+    // before and after are where undo and redo put the cursor; nil when
+    // the edit was recorded outside a group.
+    before, after *Selection
+}
+
+// History is an undo tree. Undo moves to the parent state and Redo to the
+// most recently visited child, so undoing and then editing starts a new
+// branch instead of discarding the undone edits.
+//
+// Edits recorded between Begin and End form one group that undoes and
+// redoes as a unit; groups nest and only the outermost one counts.
 type History struct {
-    past   []Operation
-    future []Operation
+    // Now returns the time recorded for new states; tests replace it.
+    Now   func() time.Time
+    nodes []*node // indexed by seq, i.e. in creation order
+    cur   *node
+
+    depth  int       // Begin calls without a matching End
+    open   *node     // state receiving the open group's edits
+    before Selection // selection at the outermost Begin
+    sealed bool      // the open group was cut short by undo or redo
+    // landing is the selection recorded for the state the last Undo or
+    // Redo moved to.
+    landing *Selection
+
+    limits Limits
+    nops   int // operations held by all states
+    nbytes int // bytes of text held by all operations
 }
 
 // New creates an empty History.
-func New() *History { return &History{} }
+func New() *History {
+    h := &History{Now: time.Now}
+    h.init()
+    return h
+}
+
+func (h *History) init() {
+    if h.cur != nil {
+        return
+    }
+    root := &node{time: h.now()}
+    h.nodes = []*node{root}
+    h.cur = root
+}
+
+func (h *History) now() time.Time {
+    if h.Now == nil {
+        return time.Now()
+    }
+    return h.Now()
+}
+
+// Begin starts an edit group with the selection before it.
+func (h *History) Begin(sel Selection) {
+    if h.depth == 0 {
+        h.before = sel
+        h.open = nil
+        h.sealed = false
+    }
+    h.depth++
+}
+
+// End closes the group started by the matching Begin. The outermost End
+// records sel as the selection after the group. Unbalanced calls are
+// ignored.
+func (h *History) End(sel Selection) {
+    if h.depth == 0 {
+        return
+    }
+    h.depth--
+    if h.depth == 0 {
+        if h.open != nil {
+            h.open.after = &sel
+        }
+        h.open = nil
+    }
+}
+
+// InGroup reports whether a group is open.
+func (h *History) InGroup() bool { return h.depth > 0 }
 
 // RecordInsert records an insertion at pos.
 func (h *History) RecordInsert(pos int, text string) {
     if text == "" {
         return
     }
-    h.past = append(h.past, Operation{Type: InsertOp, Pos: pos, Text: text})
-    h.future = nil
+    h.record(Operation{Type: InsertOp, Pos: pos, Text: text})
 }
 
 // RecordDelete records a deletion at pos of the given text.
@@ -45,69 +138,147 @@ func (h *History) RecordDelete(pos int, text string) {
     if text == "" {
         return
     }
-    h.past = append(h.past, Operation{Type: DeleteOp, Pos: pos, Text: text})
-    h.future = nil
+    h.record(Operation{Type: DeleteOp, Pos: pos, Text: text})
+}
+
+func (h *History) record(op Operation) {
+    h.init()
+    h.nbytes += len(op.Text)
+    if h.open != nil {
+        h.open.time = h.now()
+        if !merge(h.open.ops, op) {
+            h.open.ops = append(h.open.ops, op)
+            h.nops++
+        }
+        h.prune()
+        return
+    }
+    h.nops++
+    n := &node{seq: len(h.nodes), parent: h.cur, ops: []Operation{op}, time: h.now()}
+    if h.depth > 0 {
+        // after a seal the group goes on as a new state whose starting
+        // selection is unknown
+        if !h.sealed {
+            before := h.before
+            n.before = &before
+        }
+        h.open = n
+    }
+    h.cur.children = append(h.cur.children, n)
+    h.cur.redo = len(h.cur.children) - 1
+    h.nodes = append(h.nodes, n)
+    h.cur = n
+    h.prune()
+}
+
+// merge folds a single-character op into the last of ops when it continues
+// it: typing after an insert, or backspacing or deleting forward next to a
+// deletion. It reports whether op was merged.
+func merge(ops []Operation, op Operation) bool {
+    if len(ops) == 0 || utf8.RuneCountInString(op.Text) != 1 {
+        return false
+    }
+    last := &ops[len(ops)-1]
+    if last.Type != op.Type {
+        return false
+    }
+    switch {
+    case op.Type == InsertOp && op.Pos == last.Pos+utf8.RuneCountInString(last.Text):
+        last.Text += op.Text
+    case op.Type == DeleteOp && op.Pos == last.Pos:
+        last.Text += op.Text
+    case op.Type == DeleteOp && op.Pos+1 == last.Pos:
+        last.Pos = op.Pos
+        last.Text = op.Text + last.Text
+    default:
+        return false
+    }
+    return true
+}
+
+// seal stops the open group from taking more edits, so undo and redo never
+// split a state. Later edits in the group form a new state.
+func (h *History) seal(cursor *int) {
+    if h.open == nil {
+        return
+    }
+    if cursor != nil {
+        h.open.after = &Selection{Cursor: *cursor, Anchor: -1}
+    }
+    h.open = nil
+    h.sealed = true
+}
+
+// Landing returns the selection recorded for the state the last Undo, Redo
+// or GoTo moved to, if any.
+func (h *History) Landing() (Selection, bool) {
+    if h.landing == nil {
+        return Selection{}, false
+    }
+    return *h.landing, true
 }
 
 // CanUndo reports whether there is an operation to undo.
-func (h *History) CanUndo() bool { return len(h.past) > 0 }
+func (h *History) CanUndo() bool { return h.cur != nil && h.cur.parent != nil }
 
 // CanRedo reports whether there is an operation to redo.
-func (h *History) CanRedo() bool { return len(h.future) > 0 }
+func (h *History) CanRedo() bool { return h.cur != nil && len(h.cur.children) > 0 }
 
-// Undo applies the inverse of the last operation to buf and updates the cursor.
-func (h *History) Undo(buf *buffer.GapBuffer, cursor *int) error {
+// Undo reverts the last edit group in buf and updates the cursor.
+func (h *History) Undo(buf buffer.TextStorage, cursor *int) error {
     if !h.CanUndo() {
         return fmt.Errorf("nothing to undo")
     }
-    op := h.past[len(h.past)-1]
-    h.past = h.past[:len(h.past)-1]
-    // Apply inverse
-    switch op.Type {
-    case InsertOp:
-        // inverse of insert is delete the inserted text
-        start := op.Pos
-        end := op.Pos + len([]rune(op.Text))
-        if err := buf.Delete(start, end); err != nil {
+    h.seal(cursor)
+    h.landing = nil
+    n := h.cur
+    for i := len(n.ops) - 1; i >= 0; i-- {
+        if err := revert(buf, cursor, n.ops[i]); err != nil {
             return err
         }
-        if cursor != nil {
-            if *cursor > end {
-                *cursor -= len([]rune(op.Text))
-            } else {
-                // move cursor to start of deletion if it was inside
-                if *cursor > start {
-                    *cursor = start
-                }
-            }
-        }
-        // push onto future as original op for redo
-        h.future = append(h.future, op)
-        return nil
-    case DeleteOp:
-        // inverse of delete is insert the deleted text
-        if err := buf.Insert(op.Pos, []rune(op.Text)); err != nil {
-            return err
-        }
-        if cursor != nil {
-            if *cursor >= op.Pos {
-                *cursor += len([]rune(op.Text))
-            }
+    }
+    p := n.parent
+    for i, c := range p.children {
+        if c == n {
+            p.redo = i
         }
-        h.future = append(h.future, op)
-        return nil
-    default:
-        return fmt.Errorf("unknown op type")
     }
+    h.cur = p
+    h.land(buf, cursor, n.before)
+    return nil
 }
 
-// Redo reapplies the next operation to buf and updates the cursor.
-func (h *History) Redo(buf *buffer.GapBuffer, cursor *int) error {
+// Redo reapplies the next edit group to buf and updates the cursor.
+func (h *History) Redo(buf buffer.TextStorage, cursor *int) error {
     if !h.CanRedo() {
         return fmt.Errorf("nothing to redo")
     }
-    op := h.future[len(h.future)-1]
-    h.future = h.future[:len(h.future)-1]
+    h.seal(cursor)
+    h.landing = nil
+    n := h.cur.children[h.cur.redo]
+    for _, op := range n.ops {
+        if err := apply(buf, cursor, op); err != nil {
+            return err
+        }
+    }
+    h.cur = n
+    h.land(buf, cursor, n.after)
+    return nil
+}
+
+// land moves the cursor to sel when the group recorded one.
+func (h *History) land(buf buffer.TextStorage, cursor *int, sel *Selection) {
+    if sel == nil {
+        return
+    }
+    h.landing = sel
+    if cursor != nil {
+        *cursor = min(sel.Cursor, buf.Len())
+    }
+}
+
+// apply performs op on buf, moving the cursor with the text after it.
+func apply(buf buffer.TextStorage, cursor *int, op Operation) error {
     switch op.Type {
     case InsertOp:
         if err := buf.Insert(op.Pos, []rune(op.Text)); err != nil {
@@ -118,7 +289,6 @@ func (h *History) Redo(buf *buffer.GapBuffer, cursor *int) error {
                 *cursor += len([]rune(op.Text))
             }
         }
-        h.past = append(h.past, op)
         return nil
     case DeleteOp:
         start := op.Pos
@@ -130,15 +300,26 @@ func (h *History) Redo(buf *buffer.GapBuffer, cursor *int) error {
             if *cursor > end {
                 *cursor -= len([]rune(op.Text))
             } else {
+                // move cursor to start of deletion if it was inside
                 if *cursor > start {
                     *cursor = start
                 }
             }
         }
-        h.past = append(h.past, op)
         return nil
     default:
         return fmt.Errorf("unknown op type")
     }
 }
 
+// revert performs the inverse of op.
+func revert(buf buffer.TextStorage, cursor *int, op Operation) error {
+    switch op.Type {
+    case InsertOp:
+        return apply(buf, cursor, Operation{Type: DeleteOp, Pos: op.Pos, Text: op.Text})
+    case DeleteOp:
+        return apply(buf, cursor, Operation{Type: InsertOp, Pos: op.Pos, Text: op.Text})
+    default:
+        return fmt.Errorf("unknown op type")
+    }
+}
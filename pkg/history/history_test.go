@@ -1,7 +1,9 @@
 package history
 
 import (
+	"path/filepath"
 	"testing"
+	"time"
 
 	"example.com/texteditor/pkg/buffer"
 )
@@ -64,6 +66,137 @@ func TestHistory_UndoRedo_InsertDelete(t *testing.T) {
 	}
 }
 
+// insert applies and records an insertion the way the editor does.
+func insert(t *testing.T, b buffer.TextStorage, h *History, pos int, text string) {
+	t.Helper()
+	if err := b.Insert(pos, []rune(text)); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	h.RecordInsert(pos, text)
+}
+
+func TestHistory_EditAfterUndoKeepsBranch(t *testing.T) {
+	b := buffer.NewGapBufferFromString("")
+	h := New()
+	insert(t, b, h, 0, "hello")
+	insert(t, b, h, 5, " world")
+	cursor := b.Len()
+	if err := h.Undo(b, &cursor); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	insert(t, b, h, 5, "!")
+	if b.String() != "hello!" {
+		t.Fatalf("expected hello!, got %q", b.String())
+	}
+	if err := h.SwitchBranch(b, &cursor, 1); err != nil {
+		t.Fatalf("switch branch failed: %v", err)
+	}
+	if b.String() != "hello world" {
+		t.Fatalf("expected the undone branch back, got %q", b.String())
+	}
+	if err := h.SwitchBranch(b, &cursor, 1); err != nil {
+		t.Fatalf("switch branch failed: %v", err)
+	}
+	if b.String() != "hello!" {
+		t.Fatalf("expected wrap to newest branch, got %q", b.String())
+	}
+	// g- walks creation order across branches: 3 -> 2 -> 1
+	if err := h.Step(b, &cursor, -1); err != nil || b.String() != "hello world" {
+		t.Fatalf("step back: %q %v", b.String(), err)
+	}
+	if err := h.Step(b, &cursor, -1); err != nil || b.String() != "hello" {
+		t.Fatalf("step back: %q %v", b.String(), err)
+	}
+	kids, _ := h.Children(1)
+	if len(kids) != 2 {
+		t.Fatalf("expected two branches from state 1, got %v", kids)
+	}
+}
+
+func TestHistory_EarlierLater(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	b := buffer.NewGapBufferFromString("")
+	h := &History{Now: func() time.Time { return now }}
+	h.init() // original text at 10:00
+	for _, s := range []string{"a", "b", "c"} {
+		now = now.Add(time.Minute)
+		insert(t, b, h, b.Len(), s)
+	}
+	cursor := b.Len()
+	if err := h.Earlier(b, &cursor, 90*time.Second); err != nil {
+		t.Fatalf("earlier failed: %v", err)
+	}
+	if b.String() != "a" {
+		t.Fatalf("expected a after earlier 90s, got %q", b.String())
+	}
+	if err := h.Earlier(b, &cursor, time.Hour); err != nil || b.String() != "" {
+		t.Fatalf("expected original text, got %q (%v)", b.String(), err)
+	}
+	if err := h.Later(b, &cursor, 2*time.Minute); err != nil || b.String() != "ab" {
+		t.Fatalf("expected ab after later 2m, got %q (%v)", b.String(), err)
+	}
+	if err := h.Later(b, &cursor, time.Hour); err != nil || b.String() != "abc" {
+		t.Fatalf("expected abc, got %q (%v)", b.String(), err)
+	}
+	if h.Current() != 3 || h.States()[2].Delta != 1 {
+		t.Fatalf("unexpected states: current %d %+v", h.Current(), h.States())
+	}
+}
+
+func TestHistory_GroupUndoesAsOneAndRestoresSelection(t *testing.T) {
+	b := buffer.NewGapBufferFromString("one two")
+	h := New()
+	h.Begin(Selection{Cursor: 4, Anchor: 6})
+	h.Begin(Selection{Cursor: 4, Anchor: -1}) // nested groups join the outer one
+	if err := b.Delete(4, 7); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	h.RecordDelete(4, "two")
+	h.End(Selection{Cursor: 4, Anchor: -1})
+	insert(t, b, h, 4, "2")
+	h.End(Selection{Cursor: 5, Anchor: -1})
+	if b.String() != "one 2" {
+		t.Fatalf("expected one 2, got %q", b.String())
+	}
+
+	cursor := 0
+	if err := h.Undo(b, &cursor); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if b.String() != "one two" || h.CanUndo() {
+		t.Fatalf("expected the whole group undone, got %q", b.String())
+	}
+	if sel, ok := h.Landing(); !ok || cursor != 4 || sel.Anchor != 6 {
+		t.Fatalf("expected selection 4..6 restored, got cursor %d %+v %v", cursor, sel, ok)
+	}
+	if err := h.Redo(b, &cursor); err != nil {
+		t.Fatalf("redo failed: %v", err)
+	}
+	if sel, _ := h.Landing(); b.String() != "one 2" || cursor != 5 || sel.Anchor != -1 {
+		t.Fatalf("expected redo to land at 5, got %q cursor %d", b.String(), cursor)
+	}
+}
+
+func TestHistory_UndoInsideGroupSealsIt(t *testing.T) {
+	b := buffer.NewGapBufferFromString("")
+	h := New()
+	h.Begin(Selection{Cursor: 0, Anchor: -1})
+	insert(t, b, h, 0, "ab")
+	cursor := 2
+	if err := h.Undo(b, &cursor); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	insert(t, b, h, 0, "c")
+	insert(t, b, h, 1, "d")
+	h.End(Selection{Cursor: 2, Anchor: -1})
+	if err := h.Undo(b, &cursor); err != nil || b.String() != "" {
+		t.Fatalf("expected the resumed group undone, got %q (%v)", b.String(), err)
+	}
+	if len(h.States()) != 3 {
+		t.Fatalf("expected two branches from the original text, got %+v", h.States())
+	}
+}
+
 func TestKillRing_Basic(t *testing.T) {
 	var k KillRing
 	if k.HasData() {
@@ -119,3 +252,64 @@ func TestKillRing_EntriesFromCurrent(t *testing.T) {
 		t.Fatalf("unexpected entries order: %v", entries)
 	}
 }
+
+func TestKillRing_AppendAndMax(t *testing.T) {
+	var k KillRing
+	k.Append("one")
+	k.Append(" two")
+	k.Push("three")
+	k.Append("\n")
+	if got := k.Entries(); len(got) != 2 || got[0] != "three\n" || got[1] != "one two" {
+		t.Fatalf("unexpected entries %q", got)
+	}
+	k.SetMax(1)
+	if got := k.Entries(); len(got) != 1 || got[0] != "three\n" {
+		t.Fatalf("expected ring trimmed to the newest entry, got %q", got)
+	}
+	k.SetMax(0)
+	for i := 0; i < DefaultKillRingSize+5; i++ {
+		k.Push("x")
+	}
+	if k.Len() != DefaultKillRingSize {
+		t.Fatalf("expected default size %d, got %d", DefaultKillRingSize, k.Len())
+	}
+}
+
+func TestKillRing_SelectAndRemove(t *testing.T) {
+	var k KillRing
+	k.Push("one")
+	k.Push("two")
+	k.Push("three")
+	if !k.Select(1) || k.Get() != "two" {
+		t.Fatalf("expected select to make 'two' current, got %q", k.Get())
+	}
+	k.Remove(0)
+	if k.Get() != "two" || k.Index() != 0 {
+		t.Fatalf("expected current entry kept after removing a newer one, got %q at %d", k.Get(), k.Index())
+	}
+	k.Remove(0)
+	if k.Get() != "one" || k.Len() != 1 {
+		t.Fatalf("expected next entry current after removing the current one, got %q", k.Get())
+	}
+	if k.Select(3) || k.Remove(3) {
+		t.Fatalf("expected out of range index to fail")
+	}
+}
+
+func TestKillRing_WriteAndRead(t *testing.T) {
+	var k KillRing
+	k.Push("one")
+	k.Push("two\nlines")
+	path := filepath.Join(t.TempDir(), "killring.json")
+	if err := k.WriteFile(path); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var got KillRing
+	got.SetMax(1)
+	if err := got.ReadFile(path); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if e := got.Entries(); len(e) != 1 || e[0] != "two\nlines" {
+		t.Fatalf("expected newest entry within the ring size, got %q", e)
+	}
+}
@@ -1,22 +1,48 @@
 package history
 
-// KillRing stores a small history of killed text entries.
+import (
+	"encoding/json"
+	"os"
+
+	"example.com/texteditor/pkg/state"
+)
+
+// KillRing stores a small history of killed text entries, newest first.
 type KillRing struct {
 	entries []string
 	pos     int
+	max     int
 }
 
-const killRingMax = 10
+// DefaultKillRingSize is the number of entries a ring keeps unless SetMax
+// is called.
+const DefaultKillRingSize = 10
+
+func (k *KillRing) size() int {
+	if k.max < 1 {
+		return DefaultKillRingSize
+	}
+	return k.max
+}
+
+// SetMax sets how many entries the ring keeps, dropping the oldest ones
+// beyond it. n < 1 selects DefaultKillRingSize.
+func (k *KillRing) SetMax(n int) {
+	k.max = max(n, 0)
+	if len(k.entries) > k.size() {
+		k.entries = k.entries[:k.size()]
+		if k.pos >= len(k.entries) {
+			k.pos = 0
+		}
+	}
+}
 
 // Push adds killed text to the ring.
 func (k *KillRing) Push(s string) {
 	if s == "" {
 		return
 	}
-	if k.entries == nil {
-		k.entries = make([]string, 0, killRingMax)
-	}
-	if len(k.entries) < killRingMax {
+	if len(k.entries) < k.size() {
 		k.entries = append(k.entries, "")
 	}
 	copy(k.entries[1:], k.entries[:len(k.entries)-1])
@@ -24,6 +50,17 @@ func (k *KillRing) Push(s string) {
 	k.pos = 0
 }
 
+// Append adds s to the end of the newest entry, as consecutive kills do, and
+// makes that entry current. An empty ring gets a new entry.
+func (k *KillRing) Append(s string) {
+	if len(k.entries) == 0 {
+		k.Push(s)
+		return
+	}
+	k.entries[0] += s
+	k.pos = 0
+}
+
 // Set stores the killed text.
 func (k *KillRing) Set(s string) { k.Push(s) }
 
@@ -83,3 +120,77 @@ func (k *KillRing) Len() int { return len(k.entries) }
 
 // HasData reports whether the ring contains text.
 func (k *KillRing) HasData() bool { return len(k.entries) > 0 }
+
+// Entries returns the entries newest first.
+func (k *KillRing) Entries() []string {
+	return append([]string(nil), k.entries...)
+}
+
+// Index returns the position in Entries of the current entry.
+func (k *KillRing) Index() int { return k.pos }
+
+// Select makes entry i of Entries current.
+func (k *KillRing) Select(i int) bool {
+	if i < 0 || i >= len(k.entries) {
+		return false
+	}
+	k.pos = i
+	return true
+}
+
+// Remove deletes entry i of Entries. The current entry stays current unless
+// it is the one removed, in which case the next one in the ring is.
+func (k *KillRing) Remove(i int) bool {
+	if i < 0 || i >= len(k.entries) {
+		return false
+	}
+	k.entries = append(k.entries[:i], k.entries[i+1:]...)
+	if k.pos > i {
+		k.pos--
+	}
+	if k.pos >= len(k.entries) {
+		k.pos = 0
+	}
+	return true
+}
+
+// killRingFile is the on-disk form of a KillRing.
+type killRingFile struct {
+	Entries []string `json:"entries"`
+}
+
+// DefaultKillRingPath returns ~/.texteditor/killring.json, or "" if the
+// home directory is unknown.
+func DefaultKillRingPath() string {
+	return state.Path("killring.json")
+}
+
+// WriteFile stores the entries at path, newest first.
+func (k *KillRing) WriteFile(path string) error {
+	data, err := json.Marshal(killRingFile{Entries: k.entries})
+	if err != nil {
+		return err
+	}
+	return state.WriteFile(path, data)
+}
+
+// ReadFile replaces the entries with those written by WriteFile, keeping as
+// many as the ring holds. The newest entry becomes current.
+func (k *KillRing) ReadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var f killRingFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	k.entries = k.entries[:0]
+	for _, e := range f.Entries {
+		if e != "" && len(k.entries) < k.size() {
+			k.entries = append(k.entries, e)
+		}
+	}
+	k.pos = 0
+	return nil
+}
@@ -0,0 +1,98 @@
+package history
+
+// Limits caps the memory an undo tree keeps. When a cap is exceeded the
+// oldest states are dropped; the current state is always kept. Zero fields
+// mean no limit.
+type Limits struct {
+	MaxOps   int // operations across all states
+	MaxBytes int // bytes of inserted and deleted text
+}
+
+// Stats describes the size of an undo tree.
+type Stats struct {
+	States int
+	Ops    int
+	Bytes  int
+}
+
+// SetLimits changes the caps of h, dropping old states right away if needed.
+func (h *History) SetLimits(l Limits) {
+	h.init()
+	h.limits = l
+	h.prune()
+}
+
+// Limits returns the caps of h.
+func (h *History) Limits() Limits { return h.limits }
+
+// Stats returns the current size of h.
+func (h *History) Stats() Stats {
+	h.init()
+	return Stats{States: len(h.nodes), Ops: h.nops, Bytes: h.nbytes}
+}
+
+func (h *History) overLimit() bool {
+	return h.limits.MaxOps > 0 && h.nops > h.limits.MaxOps ||
+		h.limits.MaxBytes > 0 && h.nbytes > h.limits.MaxBytes
+}
+
+// prune drops the oldest states until h fits its limits. The root moves
+// towards the current state one step at a time; branches that leave the
+// path from the old root are dropped with it, since they are older than the
+// state the new root was created after.
+func (h *History) prune() {
+	if !h.overLimit() {
+		return
+	}
+	path := map[*node]bool{}
+	for n := h.cur; n != nil; n = n.parent {
+		path[n] = true
+	}
+	dropped := map[*node]bool{}
+	root := h.nodes[0]
+	for h.overLimit() && root != h.cur {
+		var next *node
+		for _, c := range root.children {
+			if path[c] {
+				next = c
+			} else {
+				h.drop(c, dropped)
+			}
+		}
+		dropped[root] = true
+		h.forget(next.ops)
+		next.parent, next.ops = nil, nil
+		next.before, next.after = nil, nil
+		root = next
+	}
+	if h.open == root {
+		// the open group's edits are now part of the original text
+		h.open = nil
+		h.sealed = true
+	}
+	kept := h.nodes[:0]
+	for _, n := range h.nodes {
+		if !dropped[n] {
+			n.seq = len(kept)
+			kept = append(kept, n)
+		}
+	}
+	clear(h.nodes[len(kept):])
+	h.nodes = kept
+}
+
+// drop marks n and everything below it as dropped.
+func (h *History) drop(n *node, dropped map[*node]bool) {
+	dropped[n] = true
+	h.forget(n.ops)
+	for _, c := range n.children {
+		h.drop(c, dropped)
+	}
+}
+
+func (h *History) forget(ops []Operation) {
+	h.nops -= len(ops)
+	for _, op := range ops {
+		h.nbytes -= len(op.Text)
+	}
+}
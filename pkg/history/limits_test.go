@@ -0,0 +1,75 @@
+package history
+
+import (
+	"testing"
+
+	"example.com/texteditor/pkg/buffer"
+)
+
+func TestHistory_MergesSingleCharacterEdits(t *testing.T) {
+	b := buffer.NewGapBufferFromString("")
+	h := New()
+	h.Begin(Selection{Anchor: -1})
+	for i, r := range "hello" {
+		_ = b.Insert(i, []rune{r})
+		h.RecordInsert(i, string(r))
+	}
+	// backspace twice, then delete forward at the new position
+	_ = b.Delete(4, 5)
+	h.RecordDelete(4, "o")
+	_ = b.Delete(3, 4)
+	h.RecordDelete(3, "l")
+	h.End(Selection{Cursor: 3, Anchor: -1})
+	if st := h.Stats(); st.States != 2 || st.Ops != 2 || st.Bytes != 7 {
+		t.Fatalf("expected merged operations, got %+v", st)
+	}
+	cursor := 3
+	if err := h.Undo(b, &cursor); err != nil || b.String() != "" {
+		t.Fatalf("undo: %v %q", err, b.String())
+	}
+	if err := h.Redo(b, &cursor); err != nil || b.String() != "hel" {
+		t.Fatalf("redo: %v %q", err, b.String())
+	}
+}
+
+func TestHistory_LimitsDropOldestStates(t *testing.T) {
+	b := buffer.NewGapBufferFromString("")
+	h := New()
+	h.SetLimits(Limits{MaxOps: 3})
+	for i, s := range []string{"a", "bb", "ccc", "dddd"} {
+		_ = b.Insert(b.Len(), []rune(s))
+		h.RecordInsert(b.Len()-len(s), s)
+		if i == 1 {
+			// a branch off the first state goes when the root passes it
+			cursor := b.Len()
+			_ = h.Undo(b, &cursor)
+			_ = b.Insert(1, []rune("x"))
+			h.RecordInsert(1, "x")
+			_ = h.Undo(b, &cursor)
+			_ = h.Redo(b, &cursor)
+			_ = h.SwitchBranch(b, &cursor, 1)
+		}
+	}
+	if b.String() != "abbcccdddd" {
+		t.Fatalf("unexpected text %q", b.String())
+	}
+	// "a" and the "x" branch below it are gone
+	if st := h.Stats(); st.States != 3 || st.Ops != 2 || st.Bytes != 7 {
+		t.Fatalf("expected oldest states dropped, got %+v", st)
+	}
+	cursor := b.Len()
+	for h.CanUndo() {
+		_ = h.Undo(b, &cursor)
+	}
+	if b.String() != "abb" {
+		t.Fatalf("expected to undo back to the new root, got %q", b.String())
+	}
+	for h.CanRedo() {
+		_ = h.Redo(b, &cursor)
+	}
+
+	h.SetLimits(Limits{MaxBytes: 4})
+	if st := h.Stats(); st.States != 2 || st.Bytes != 4 || h.Current() != 1 {
+		t.Fatalf("expected bytes within limit, got %+v at %d", st, h.Current())
+	}
+}
@@ -0,0 +1,187 @@
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"example.com/texteditor/pkg/state"
+)
+
+// ErrStale reports an undo file written for different file contents.
+var ErrStale = errors.New("undo file does not match the file contents")
+
+// ErrTooLarge reports a history that does not fit the size limit even when
+// cut down to the current state.
+var ErrTooLarge = errors.New("undo history does not fit the size limit")
+
+const undoFileVersion = 1
+
+// undoFile is the on-disk form of a History. States are listed in creation
+// order and refer to their parent by index.
+type undoFile struct {
+	Version int         `json:"version"`
+	Hash    string      `json:"hash"`
+	Current int         `json:"current"`
+	States  []undoState `json:"states"`
+}
+
+type undoState struct {
+	Parent int        `json:"parent"`
+	Time   time.Time  `json:"time"`
+	Ops    []undoOp   `json:"ops,omitempty"`
+	Redo   int        `json:"redo,omitempty"`
+	Before *Selection `json:"before,omitempty"`
+	After  *Selection `json:"after,omitempty"`
+}
+
+type undoOp struct {
+	Del  bool   `json:"del,omitempty"`
+	Pos  int    `json:"pos"`
+	Text string `json:"text"`
+}
+
+// DefaultDir returns ~/.texteditor/undo, or "" if the home directory is
+// unknown.
+func DefaultDir() string {
+	return state.Path("undo")
+}
+
+// PathFor returns the undo file used for file inside dir. The absolute path
+// is encoded into the name so files with the same base name do not collide.
+func PathFor(dir, file string) string {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		abs = file
+	}
+	name := strings.NewReplacer(string(filepath.Separator), "%", ":", "%").Replace(abs)
+	return filepath.Join(dir, name+".undo")
+}
+
+func textHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// WriteFile stores h at path for a buffer holding text, which must be the
+// text of the current state. When the encoding exceeds maxSize bytes (0
+// means no limit) the oldest states are dropped: the tree is cut at an
+// ancestor of the current state, as close to the original text as fits. If
+// not even the current state alone fits, nothing is written and WriteFile
+// returns ErrTooLarge.
+func (h *History) WriteFile(path, text string, maxSize int) error {
+	h.init()
+	var ancestors []*node
+	for n := h.cur; n != nil; n = n.parent {
+		ancestors = append(ancestors, n)
+	}
+	// ancestors[len-1] is the root; try it first, then cut closer to the
+	// current state until the file fits
+	data, err := h.encode(ancestors[len(ancestors)-1], text)
+	if err != nil {
+		return err
+	}
+	if maxSize > 0 && len(data) > maxSize {
+		// binary search for the oldest ancestor that fits
+		var best []byte
+		lo, hi := 0, len(ancestors)-2
+		for lo <= hi {
+			mid := (lo + hi) / 2
+			d, err := h.encode(ancestors[mid], text)
+			if err != nil {
+				return err
+			}
+			if len(d) <= maxSize {
+				best, lo = d, mid+1
+			} else {
+				hi = mid - 1
+			}
+		}
+		if best == nil {
+			return ErrTooLarge
+		}
+		data = best
+	}
+	return state.WriteFile(path, data)
+}
+
+// encode serializes the subtree below root, which becomes state 0.
+func (h *History) encode(root *node, text string) ([]byte, error) {
+	index := map[*node]int{}
+	f := undoFile{Version: undoFileVersion, Hash: textHash(text)}
+	for _, n := range h.nodes {
+		// parents precede their children, so one pass finds the subtree
+		st := undoState{Parent: -1, Time: n.time, Redo: n.redo}
+		if n != root {
+			p, ok := index[n.parent]
+			if !ok {
+				continue
+			}
+			st.Parent = p
+			st.Before, st.After = n.before, n.after
+			for _, op := range n.ops {
+				st.Ops = append(st.Ops, undoOp{Del: op.Type == DeleteOp, Pos: op.Pos, Text: op.Text})
+			}
+		}
+		index[n] = len(f.States)
+		f.States = append(f.States, st)
+	}
+	f.Current = index[h.cur]
+	return json.Marshal(f)
+}
+
+// ReadFile loads the history stored at path. It returns ErrStale when the
+// file was written for a buffer other than text.
+func ReadFile(path, text string) (*History, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f undoFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("undo file: %w", err)
+	}
+	if f.Version != undoFileVersion {
+		return nil, fmt.Errorf("undo file version %d not supported", f.Version)
+	}
+	if f.Hash != textHash(text) {
+		return nil, ErrStale
+	}
+	if len(f.States) == 0 || f.Current < 0 || f.Current >= len(f.States) {
+		return nil, fmt.Errorf("undo file has no current state")
+	}
+	h := &History{Now: time.Now}
+	for i, st := range f.States {
+		n := &node{seq: i, time: st.Time, before: st.Before, after: st.After}
+		if i > 0 {
+			if st.Parent < 0 || st.Parent >= i {
+				return nil, fmt.Errorf("undo file state %d has bad parent %d", i, st.Parent)
+			}
+			n.parent = h.nodes[st.Parent]
+			n.parent.children = append(n.parent.children, n)
+			for _, op := range st.Ops {
+				t := InsertOp
+				if op.Del {
+					t = DeleteOp
+				}
+				n.ops = append(n.ops, Operation{Type: t, Pos: op.Pos, Text: op.Text})
+				h.nops++
+				h.nbytes += len(op.Text)
+			}
+		}
+		h.nodes = append(h.nodes, n)
+	}
+	for i, st := range f.States {
+		if n := h.nodes[i]; st.Redo >= 0 && st.Redo < len(n.children) {
+			n.redo = st.Redo
+		}
+	}
+	h.cur = h.nodes[f.Current]
+	return h, nil
+}
@@ -0,0 +1,81 @@
+package history
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"example.com/texteditor/pkg/buffer"
+)
+
+func TestHistory_WriteReadFile(t *testing.T) {
+	b := buffer.NewGapBufferFromString("")
+	h := New()
+	insert(t, b, h, 0, "one")
+	insert(t, b, h, 3, " two")
+	cursor := b.Len()
+	_ = h.Undo(b, &cursor)
+	insert(t, b, h, 3, " 2")
+	path := PathFor(t.TempDir(), "/src/notes.txt")
+	if err := h.WriteFile(path, b.String(), 0); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := ReadFile(path, "changed"); !errors.Is(err, ErrStale) {
+		t.Fatalf("expected ErrStale for other contents, got %v", err)
+	}
+	got, err := ReadFile(path, b.String())
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if err := got.SwitchBranch(b, &cursor, 1); err != nil || b.String() != "one two" {
+		t.Fatalf("expected the other branch after reload, got %q (%v)", b.String(), err)
+	}
+	for got.CanUndo() {
+		_ = got.Undo(b, &cursor)
+	}
+	if b.String() != "" {
+		t.Fatalf("expected original text, got %q", b.String())
+	}
+}
+
+func TestHistory_WriteFileDropsOldStatesToFit(t *testing.T) {
+	b := buffer.NewGapBufferFromString("")
+	h := New()
+	for i := 0; i < 50; i++ {
+		insert(t, b, h, b.Len(), "0123456789")
+	}
+	path := filepath.Join(t.TempDir(), "big.undo")
+	if err := h.WriteFile(path, b.String(), 1500); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() > 1500 {
+		t.Fatalf("expected file within limit, got %v %v", fi, err)
+	}
+	got, err := ReadFile(path, b.String())
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	steps := 0
+	cursor := 0
+	for got.CanUndo() {
+		_ = got.Undo(b, &cursor)
+		steps++
+	}
+	if steps == 0 || steps == 50 || b.Len() != (50-steps)*10 {
+		t.Fatalf("expected the newest states kept, undid %d to %d runes", steps, b.Len())
+	}
+}
+
+func TestHistory_WriteFileTooLarge(t *testing.T) {
+	b := buffer.NewGapBufferFromString("")
+	h := New()
+	insert(t, b, h, 0, "text")
+	path := filepath.Join(t.TempDir(), "small.undo")
+	if err := h.WriteFile(path, b.String(), 10); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing written, got %v", err)
+	}
+}
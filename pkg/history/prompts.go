@@ -0,0 +1,160 @@
+package history
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"example.com/texteditor/pkg/state"
+)
+
+// PromptHistory keeps what was entered at each prompt, such as search
+// queries or opened paths, in one ring per prompt name, oldest first.
+// The zero value is ready to use.
+type PromptHistory struct {
+	rings map[string][]string
+	max   int
+}
+
+// DefaultPromptHistorySize is the number of entries each prompt keeps
+// unless SetMax is called.
+const DefaultPromptHistorySize = 100
+
+func (h *PromptHistory) size() int {
+	if h.max < 1 {
+		return DefaultPromptHistorySize
+	}
+	return h.max
+}
+
+// SetMax sets how many entries each prompt keeps, dropping the oldest ones
+// beyond it. n < 1 selects DefaultPromptHistorySize.
+func (h *PromptHistory) SetMax(n int) {
+	h.max = max(n, 0)
+	for name, ring := range h.rings {
+		if len(ring) > h.size() {
+			h.rings[name] = ring[len(ring)-h.size():]
+		}
+	}
+}
+
+// Add records entry as the newest of prompt. An entry already in the ring
+// moves to the end instead of appearing twice; blank entries are ignored.
+func (h *PromptHistory) Add(prompt, entry string) {
+	if strings.TrimSpace(entry) == "" {
+		return
+	}
+	if h.rings == nil {
+		h.rings = map[string][]string{}
+	}
+	ring := h.rings[prompt]
+	for i, e := range ring {
+		if e == entry {
+			ring = append(ring[:i], ring[i+1:]...)
+			break
+		}
+	}
+	ring = append(ring, entry)
+	if len(ring) > h.size() {
+		ring = ring[len(ring)-h.size():]
+	}
+	h.rings[prompt] = ring
+}
+
+// Entries returns the entries of prompt, oldest first.
+func (h *PromptHistory) Entries(prompt string) []string {
+	return append([]string(nil), h.rings[prompt]...)
+}
+
+// Recall returns a cursor over the entries of prompt for Up/Down style
+// browsing.
+func (h *PromptHistory) Recall(prompt string) *Recall {
+	entries := h.Entries(prompt)
+	return &Recall{entries: entries, pos: len(entries)}
+}
+
+// Recall steps through a prompt's history from the newest entry back. Only
+// entries starting with what was typed before browsing began are visited,
+// and stepping past the newest gives back the typed text.
+type Recall struct {
+	entries []string
+	pos     int // len(entries) while not browsing
+	prefix  string
+}
+
+// Prev returns the entry before the current one that starts with the
+// prefix. input is the prompt's text; it becomes the prefix when browsing
+// starts. ok is false when there is no older entry.
+func (c *Recall) Prev(input string) (entry string, ok bool) {
+	if c.pos == len(c.entries) {
+		c.prefix = input
+	}
+	for i := c.pos - 1; i >= 0; i-- {
+		if strings.HasPrefix(c.entries[i], c.prefix) && c.entries[i] != input {
+			c.pos = i
+			return c.entries[i], true
+		}
+	}
+	return "", false
+}
+
+// Next returns the entry after the current one that starts with the prefix,
+// or the prefix itself after the newest. ok is false when not browsing.
+func (c *Recall) Next() (entry string, ok bool) {
+	if c.pos == len(c.entries) {
+		return "", false
+	}
+	for i := c.pos + 1; i < len(c.entries); i++ {
+		if strings.HasPrefix(c.entries[i], c.prefix) {
+			c.pos = i
+			return c.entries[i], true
+		}
+	}
+	c.pos = len(c.entries)
+	return c.prefix, true
+}
+
+// Reset ends browsing, as typing does; the next Prev filters by the text
+// then in the prompt.
+func (c *Recall) Reset() {
+	c.pos = len(c.entries)
+}
+
+type promptHistoryFile struct {
+	Prompts map[string][]string `json:"prompts"`
+}
+
+// DefaultPromptHistoryPath returns ~/.texteditor/history.json, or "" if the
+// home directory is unknown.
+func DefaultPromptHistoryPath() string {
+	return state.Path("history.json")
+}
+
+// WriteFile stores every prompt's entries at path.
+func (h *PromptHistory) WriteFile(path string) error {
+	data, err := json.Marshal(promptHistoryFile{Prompts: h.rings})
+	if err != nil {
+		return err
+	}
+	return state.WriteFile(path, data)
+}
+
+// ReadFile replaces the entries with those written by WriteFile, keeping as
+// many of the newest as each ring holds.
+func (h *PromptHistory) ReadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var f promptHistoryFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	h.rings = nil
+	for name, entries := range f.Prompts {
+		for _, e := range entries {
+			h.Add(name, e)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package history
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPromptHistory_AddAndRecall(t *testing.T) {
+	var h PromptHistory
+	h.SetMax(3)
+	for _, e := range []string{"foo", "bar", "  ", "foobar", "foo", "baz"} {
+		h.Add("search", e)
+	}
+	h.Add("open", "main.go")
+	if got := h.Entries("search"); !reflect.DeepEqual(got, []string{"foobar", "foo", "baz"}) {
+		t.Fatalf("unexpected entries %q", got)
+	}
+
+	c := h.Recall("search")
+	if _, ok := c.Next(); ok {
+		t.Fatalf("Next before Prev should do nothing")
+	}
+	// only entries starting with the typed "fo"
+	if e, ok := c.Prev("fo"); !ok || e != "foo" {
+		t.Fatalf("expected foo, got %q %v", e, ok)
+	}
+	if e, ok := c.Prev("foo"); !ok || e != "foobar" {
+		t.Fatalf("expected foobar, got %q %v", e, ok)
+	}
+	if _, ok := c.Prev("foobar"); ok {
+		t.Fatalf("expected no older match")
+	}
+	if e, _ := c.Next(); e != "foo" {
+		t.Fatalf("expected foo going forward, got %q", e)
+	}
+	if e, _ := c.Next(); e != "fo" {
+		t.Fatalf("expected the typed text back after the newest, got %q", e)
+	}
+	c.Reset()
+	if e, _ := c.Prev(""); e != "baz" {
+		t.Fatalf("expected the newest entry, got %q", e)
+	}
+}
+
+func TestPromptHistory_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "history.json")
+	var h PromptHistory
+	h.Add("search", "one")
+	h.Add("search", "two")
+	h.Add("ex", "noh")
+	if err := h.WriteFile(path); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var got PromptHistory
+	got.SetMax(1)
+	if err := got.ReadFile(path); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if e := got.Entries("search"); !reflect.DeepEqual(e, []string{"two"}) {
+		t.Fatalf("expected the newest entry kept, got %q", e)
+	}
+	if e := got.Entries("ex"); !reflect.DeepEqual(e, []string{"noh"}) {
+		t.Fatalf("unexpected ex entries %q", e)
+	}
+}
@@ -0,0 +1,148 @@
+package history
+
+import (
+	"encoding/json"
+	"os"
+
+	"example.com/texteditor/pkg/state"
+)
+
+// Registers holds Vim-style registers next to the kill ring, which plays
+// the unnamed register:
+//
+//   - a-z are named registers; writing to A-Z appends to a-z
+//   - 0 holds the last yank made without naming a register
+//   - 1-9 hold the last deletes made without naming a register, 1 newest
+//   - _ is the black hole: writes are dropped and reads are empty
+//
+// The zero value is empty and ready to use.
+type Registers struct {
+	named   [26]string
+	yank    string
+	deletes [9]string
+}
+
+// IsRegister reports whether name can follow '"' to select a register.
+// '"' itself names the unnamed register; '+' and '*' name the system
+// clipboard and selection, which Registers does not hold.
+func IsRegister(name rune) bool {
+	switch {
+	case name >= 'a' && name <= 'z', name >= 'A' && name <= 'Z', name >= '0' && name <= '9':
+		return true
+	}
+	return name == '_' || name == '"' || name == '+' || name == '*'
+}
+
+func unnamed(name rune) bool { return name == 0 || name == '"' }
+
+// store writes text to a named register and reports whether name was one.
+func (rs *Registers) store(name rune, text string) bool {
+	switch {
+	case name >= 'a' && name <= 'z':
+		rs.named[name-'a'] = text
+	case name >= 'A' && name <= 'Z':
+		rs.named[name-'A'] += text
+	default:
+		return false
+	}
+	return true
+}
+
+// Yank records yanked text in register name, or in register 0 when name is
+// 0 or '"'. Numbered registers cannot be written directly.
+func (rs *Registers) Yank(name rune, text string) {
+	if unnamed(name) {
+		rs.yank = text
+		return
+	}
+	rs.store(name, text)
+}
+
+// Delete records deleted text in register name. Without a name the
+// numbered registers shift down and text becomes register 1.
+func (rs *Registers) Delete(name rune, text string) {
+	if unnamed(name) {
+		copy(rs.deletes[1:], rs.deletes[:len(rs.deletes)-1])
+		rs.deletes[0] = text
+		return
+	}
+	rs.store(name, text)
+}
+
+// AppendDelete adds text to register 1, for a kill that continues the
+// previous one.
+func (rs *Registers) AppendDelete(text string) {
+	rs.deletes[0] += text
+}
+
+// Get returns the text of register name. It reports false for registers
+// that are empty or that Registers does not hold, such as '"'.
+func (rs *Registers) Get(name rune) (string, bool) {
+	var text string
+	switch {
+	case name >= 'a' && name <= 'z':
+		text = rs.named[name-'a']
+	case name >= 'A' && name <= 'Z':
+		text = rs.named[name-'A']
+	case name == '0':
+		text = rs.yank
+	case name >= '1' && name <= '9':
+		text = rs.deletes[name-'1']
+	}
+	return text, text != ""
+}
+
+// registersFile is the on-disk form of Registers, keyed by register name.
+type registersFile struct {
+	Registers map[string]string `json:"registers"`
+}
+
+// DefaultRegistersPath returns ~/.texteditor/registers.json, or "" if the
+// home directory is unknown.
+func DefaultRegistersPath() string {
+	return state.Path("registers.json")
+}
+
+// WriteFile stores the non-empty registers at path.
+func (rs *Registers) WriteFile(path string) error {
+	f := registersFile{Registers: map[string]string{}}
+	for _, name := range "abcdefghijklmnopqrstuvwxyz0123456789" {
+		if text, ok := rs.Get(name); ok {
+			f.Registers[string(name)] = text
+		}
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return state.WriteFile(path, data)
+}
+
+// ReadRegisters loads registers written by WriteFile. Unknown names are
+// ignored.
+func ReadRegisters(path string) (*Registers, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f registersFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	rs := &Registers{}
+	for key, text := range f.Registers {
+		name := []rune(key)
+		if len(name) != 1 {
+			continue
+		}
+		switch n := name[0]; {
+		case n >= 'a' && n <= 'z':
+			rs.named[n-'a'] = text
+		case n == '0':
+			rs.yank = text
+		case n >= '1' && n <= '9':
+			rs.deletes[n-'1'] = text
+		}
+	}
+	return rs, nil
+}
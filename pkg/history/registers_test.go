@@ -0,0 +1,49 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRegisters_YankDeleteAppend(t *testing.T) {
+	var rs Registers
+	rs.Yank(0, "yanked")
+	rs.Yank('a', "one")
+	rs.Yank('A', " two")
+	rs.Delete(0, "first")
+	rs.Delete(0, "second")
+	rs.Delete('_', "gone")
+	if got, _ := rs.Get('0'); got != "yanked" {
+		t.Fatalf("register 0: %q", got)
+	}
+	if got, _ := rs.Get('a'); got != "one two" {
+		t.Fatalf("register a: %q", got)
+	}
+	if got, _ := rs.Get('1'); got != "second" {
+		t.Fatalf("register 1: %q", got)
+	}
+	if got, _ := rs.Get('2'); got != "first" {
+		t.Fatalf("register 2: %q", got)
+	}
+	if _, ok := rs.Get('_'); ok {
+		t.Fatalf("black hole register should read empty")
+	}
+}
+
+func TestRegisters_WriteAndRead(t *testing.T) {
+	var rs Registers
+	rs.Yank('q', "named")
+	rs.Yank(0, "yank")
+	rs.Delete(0, "del")
+	path := filepath.Join(t.TempDir(), "sub", "registers.json")
+	if err := rs.WriteFile(path); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got, err := ReadRegisters(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if *got != rs {
+		t.Fatalf("round trip: got %+v, want %+v", *got, rs)
+	}
+}
@@ -0,0 +1,163 @@
+package history
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"example.com/texteditor/pkg/buffer"
+)
+
+// StateInfo describes one state of the undo tree for display.
+type StateInfo struct {
+	Seq    int
+	Parent int // -1 for the original text
+	Time   time.Time
+	// Delta is the net number of runes the state's edits inserted
+	// (positive) or deleted (negative).
+	Delta int
+	Text  string // text inserted by the edits, or deleted if none was inserted
+}
+
+// States returns every state in creation order. State 0 is the original
+// text.
+func (h *History) States() []StateInfo {
+	h.init()
+	out := make([]StateInfo, len(h.nodes))
+	for i, n := range h.nodes {
+		out[i] = StateInfo{Seq: n.seq, Parent: -1, Time: n.time}
+		if n.parent == nil {
+			continue
+		}
+		out[i].Parent = n.parent.seq
+		var inserted, deleted strings.Builder
+		for _, op := range n.ops {
+			if op.Type == DeleteOp {
+				out[i].Delta -= len([]rune(op.Text))
+				deleted.WriteString(op.Text)
+			} else {
+				out[i].Delta += len([]rune(op.Text))
+				inserted.WriteString(op.Text)
+			}
+		}
+		out[i].Text = inserted.String()
+		if out[i].Text == "" {
+			out[i].Text = deleted.String()
+		}
+	}
+	return out
+}
+
+// Current returns the sequence number of the state the buffer is in.
+func (h *History) Current() int {
+	h.init()
+	return h.cur.seq
+}
+
+// Children returns the states reachable by one Redo from seq, oldest first,
+// and the index of the one Redo follows.
+func (h *History) Children(seq int) (children []int, redo int) {
+	h.init()
+	if seq < 0 || seq >= len(h.nodes) {
+		return nil, 0
+	}
+	n := h.nodes[seq]
+	for _, c := range n.children {
+		children = append(children, c.seq)
+	}
+	return children, n.redo
+}
+
+// GoTo moves buf to state seq, undoing up to the closest common ancestor
+// and redoing down from there.
+func (h *History) GoTo(buf buffer.TextStorage, cursor *int, seq int) error {
+	h.init()
+	if seq < 0 || seq >= len(h.nodes) {
+		return fmt.Errorf("no undo state %d", seq)
+	}
+	target := h.nodes[seq]
+	onPath := map[*node]bool{}
+	for n := target; n != nil; n = n.parent {
+		onPath[n] = true
+	}
+	for !onPath[h.cur] {
+		if err := h.Undo(buf, cursor); err != nil {
+			return err
+		}
+	}
+	var down []*node
+	for n := target; n != h.cur; n = n.parent {
+		down = append(down, n)
+	}
+	for i := len(down) - 1; i >= 0; i-- {
+		n := down[i]
+		for j, c := range n.parent.children {
+			if c == n {
+				n.parent.redo = j
+			}
+		}
+		if err := h.Redo(buf, cursor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SwitchBranch moves to the sibling of the current state delta branches
+// away, wrapping around. It fails when the current state has no siblings.
+func (h *History) SwitchBranch(buf buffer.TextStorage, cursor *int, delta int) error {
+	h.init()
+	p := h.cur.parent
+	if p == nil || len(p.children) < 2 {
+		return fmt.Errorf("no other branch")
+	}
+	i := 0
+	for j, c := range p.children {
+		if c == h.cur {
+			i = j
+		}
+	}
+	i = ((i+delta)%len(p.children) + len(p.children)) % len(p.children)
+	return h.GoTo(buf, cursor, p.children[i].seq)
+}
+
+// Step moves n states forward (positive) or back in creation order,
+// regardless of branches, like Vim's g+ and g-.
+func (h *History) Step(buf buffer.TextStorage, cursor *int, n int) error {
+	h.init()
+	seq := h.cur.seq + n
+	if seq < 0 {
+		seq = 0
+	}
+	if seq >= len(h.nodes) {
+		seq = len(h.nodes) - 1
+	}
+	return h.GoTo(buf, cursor, seq)
+}
+
+// Earlier moves to the newest state created at least d before the current
+// one, or to the original text if there is none.
+func (h *History) Earlier(buf buffer.TextStorage, cursor *int, d time.Duration) error {
+	h.init()
+	limit := h.cur.time.Add(-d)
+	seq := 0
+	for _, n := range h.nodes[:h.cur.seq] {
+		if !n.time.After(limit) {
+			seq = n.seq
+		}
+	}
+	return h.GoTo(buf, cursor, seq)
+}
+
+// Later moves to the newest state created within d after the current one.
+func (h *History) Later(buf buffer.TextStorage, cursor *int, d time.Duration) error {
+	h.init()
+	limit := h.cur.time.Add(d)
+	seq := h.cur.seq
+	for _, n := range h.nodes[h.cur.seq:] {
+		if !n.time.After(limit) {
+			seq = n.seq
+		}
+	}
+	return h.GoTo(buf, cursor, seq)
+}
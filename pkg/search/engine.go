@@ -0,0 +1,321 @@
+package search
+
+import (
+	"context"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode/utf8"
+)
+
+// ChunkSize is how many bytes Stream searches between checks for
+// cancellation.
+const ChunkSize = 256 << 10
+
+// spanningScan holds the one scan of a regular expression that can match
+// across lines that may run at a time. Such a scan cannot be stopped once
+// started, so searches that come meanwhile wait here, and those cancelled
+// before their turn never start one.
+var spanningScan = make(chan struct{}, 1)
+
+// Batch is a group of matches delivered by Stream.
+type Batch struct {
+	// Ranges holds matches in document order. Preview batches cover the
+	// window Stream was asked to search first; the others follow each
+	// other through the text and together make up the result.
+	Ranges  []Range
+	Preview bool
+	// Done marks the last batch; Total is then the number of matches.
+	Done  bool
+	Total int
+	Err   error
+}
+
+// Stream searches text like Find, but in chunks, so a large text can be
+// searched off the UI goroutine and abandoned by cancelling ctx. The
+// matches in the byte window [lo, hi), usually the viewport, are reported
+// first as a preview; the whole text is then searched from the start and
+// reported as it goes, ending with a Done batch. A regular expression that
+// cannot match across lines is searched in chunks of whole lines; any other
+// is matched in one piece, one such search at a time, which Stream abandons
+// if ctx is cancelled first. Stream returns ctx.Err() if cancelled, in which case no Done batch is
+// sent.
+func Stream(ctx context.Context, text, query string, opt Options, lo, hi int, emit func(Batch)) error {
+	if query == "" {
+		emit(Batch{Done: true})
+		return nil
+	}
+	keep := func(ranges []Range) []Range {
+		if opt.WholeWord {
+			return wholeWords(text, ranges)
+		}
+		return ranges
+	}
+	if opt.Regex {
+		return streamRegex(ctx, text, query, opt, lo, hi, keep, emit)
+	}
+	m := newMatcher(query, opt.FoldCase(query))
+	lo, hi = max(lo, 0), min(hi, len(text))
+	if lo < hi {
+		if preview := keep(m.findAll(text, lo, hi, nil)); len(preview) > 0 {
+			emit(Batch{Ranges: preview, Preview: true})
+		}
+	}
+	total := 0
+	next := 0 // matches do not overlap, so the next one starts here at the earliest
+	for start, end := 0, 0; start < len(text); start = end {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// chunks end on rune boundaries, where any match has to start
+		end = min(start+ChunkSize, len(text))
+		for end < len(text) && !utf8.RuneStart(text[end]) {
+			end++
+		}
+		found := m.findAll(text, max(next, start), end, nil)
+		if len(found) > 0 {
+			next = found[len(found)-1].End
+		}
+		if found = keep(found); len(found) > 0 {
+			total += len(found)
+			emit(Batch{Ranges: found})
+		}
+	}
+	emit(Batch{Done: true, Total: total})
+	return nil
+}
+
+// streamRegex is Stream for a regular expression.
+func streamRegex(ctx context.Context, text, query string, opt Options, lo, hi int, keep func([]Range) []Range, emit func(Batch)) error {
+	re, err := Compile(query, opt)
+	if err != nil {
+		emit(Batch{Done: true, Err: err})
+		return nil
+	}
+	if !lineLocal(re) {
+		select {
+		case spanningScan <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err := ctx.Err(); err != nil {
+			<-spanningScan
+			return err
+		}
+		found := make(chan []Range, 1)
+		go func() {
+			defer func() { <-spanningScan }()
+			found <- keep(findRegex(re, text, 0, nil))
+		}()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ranges := <-found:
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			emit(Batch{Ranges: ranges, Done: true, Total: len(ranges)})
+			return nil
+		}
+	}
+	// the matches of a line do not depend on the lines around it, so each
+	// piece of whole lines is searched on its own
+	lo, hi = lineStart(text, min(max(lo, 0), len(text))), lineEnd(text, max(min(hi, len(text)), 0))
+	if lo < hi {
+		if preview := keep(findRegex(re, text[lo:hi], lo, nil)); len(preview) > 0 {
+			emit(Batch{Ranges: preview, Preview: true})
+		}
+	}
+	total := 0
+	for start, end := 0, 0; start < len(text); start = end {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end = lineEnd(text, min(start+ChunkSize, len(text)))
+		if found := keep(findRegex(re, text[start:end], start, nil)); len(found) > 0 {
+			total += len(found)
+			emit(Batch{Ranges: found})
+		}
+	}
+	emit(Batch{Done: true, Total: total})
+	return nil
+}
+
+// lineStart returns the start of the line holding byte offset pos.
+func lineStart(text string, pos int) int {
+	return strings.LastIndexByte(text[:pos], '\n') + 1
+}
+
+// lineEnd returns the offset just past the newline ending the line that
+// holds the byte before pos, or len(text) for the last line.
+func lineEnd(text string, pos int) int {
+	if pos == 0 || text[pos-1] == '\n' {
+		return pos
+	}
+	if i := strings.IndexByte(text[pos:], '\n'); i >= 0 {
+		return pos + i + 1
+	}
+	return len(text)
+}
+
+// lineLocal reports whether re only matches within a line and without
+// regard to where the text starts or ends, so that searching a text a few
+// whole lines at a time finds the same matches as searching it in one go.
+func lineLocal(re *regexp.Regexp) bool {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return false
+	}
+	return !spansLines(parsed)
+}
+
+func spansLines(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpAnyChar, syntax.OpBeginText, syntax.OpEndText:
+		return true
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if r == '\n' {
+				return true
+			}
+		}
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			if re.Rune[i] <= '\n' && '\n' <= re.Rune[i+1] {
+				return true
+			}
+		}
+	}
+	for _, sub := range re.Sub {
+		if spansLines(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// matcher finds a literal pattern. Exact patterns use strings.Index, which
+// the runtime vectorises; ASCII patterns matched without regard to case use
+// Boyer–Moore–Horspool on case-folded bytes. Other case-folded patterns fall
+// back to comparing lower-cased runes.
+type matcher struct {
+	pattern string
+	fold    bool
+	ascii   bool
+	skip    [256]int
+}
+
+func newMatcher(pattern string, fold bool) *matcher {
+	// a pattern without letters matches the same either way
+	if fold && strings.ToLower(pattern) == pattern && strings.ToUpper(pattern) == pattern {
+		fold = false
+	}
+	m := &matcher{pattern: pattern, fold: fold, ascii: isASCII(pattern)}
+	if fold && m.ascii {
+		m.pattern = asciiLower(pattern)
+		n := len(m.pattern)
+		for i := range m.skip {
+			m.skip[i] = n
+		}
+		for i := 0; i < n-1; i++ {
+			c := m.pattern[i]
+			m.skip[c] = n - 1 - i
+			m.skip[asciiUpper(c)] = n - 1 - i
+		}
+	}
+	return m
+}
+
+// findAll appends to out the non-overlapping matches that start in the
+// byte range [from, to) of text; a match may run past to. from must be on a
+// rune boundary.
+func (m *matcher) findAll(text string, from, to int, out []Range) []Range {
+	// a match starting before to ends by limit, so neither scan needs to
+	// look further; searching the rest of the text for each chunk would
+	// make Stream quadratic
+	limit := min(len(text), to+len(m.pattern)-1)
+	switch {
+	case !m.fold:
+		for pos := from; pos < to; {
+			i := strings.Index(text[pos:limit], m.pattern)
+			if i < 0 {
+				break
+			}
+			pos += i
+			out = append(out, Range{Start: pos, End: pos + len(m.pattern)})
+			pos += len(m.pattern)
+		}
+	case m.ascii:
+		for pos := from; pos < to; {
+			i := m.horspool(text[:limit], pos)
+			if i < 0 {
+				break
+			}
+			out = append(out, Range{Start: i, End: i + len(m.pattern)})
+			pos = i + len(m.pattern)
+		}
+	default:
+		// lower-casing can change a rune's length, so allow for the
+		// longest encoding past the end of the range
+		end := min(len(text), to+utf8.UTFMax*utf8.RuneCountInString(m.pattern))
+		if from >= end {
+			break
+		}
+		for _, r := range searchRunes(text[from:end], m.pattern, false) {
+			if from+r.Start >= to {
+				break
+			}
+			out = append(out, Range{Start: from + r.Start, End: from + r.End})
+		}
+	}
+	return out
+}
+
+// horspool returns the first index at or after from where the folded
+// pattern matches text, or -1.
+func (m *matcher) horspool(text string, from int) int {
+	n := len(m.pattern)
+	last := n - 1
+	for i := from; i+n <= len(text); {
+		j := last
+		for j >= 0 && asciiLowerByte(text[i+j]) == m.pattern[j] {
+			j--
+		}
+		if j < 0 {
+			return i
+		}
+		i += m.skip[text[i+last]]
+	}
+	return -1
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func asciiLowerByte(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func asciiUpper(c byte) byte {
+	if 'a' <= c && c <= 'z' {
+		return c - ('a' - 'A')
+	}
+	return c
+}
+
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i := range b {
+		b[i] = asciiLowerByte(b[i])
+	}
+	return string(b)
+}
@@ -0,0 +1,201 @@
+package search
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchAllCase_MatchesRuneScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	alphabet := []rune("aAbB é\nÉ")
+	word := func(n int) string {
+		rs := make([]rune, n)
+		for i := range rs {
+			rs[i] = alphabet[rng.Intn(len(alphabet))]
+		}
+		return string(rs)
+	}
+	for i := 0; i < 2000; i++ {
+		text, query := word(rng.Intn(40)), word(1+rng.Intn(3))
+		for _, cs := range []bool{true, false} {
+			got, want := SearchAllCase(text, query, cs), searchRunes(text, query, cs)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("SearchAllCase(%q, %q, %v) = %v, want %v", text, query, cs, got, want)
+			}
+		}
+	}
+	// self-overlapping patterns match left to right without overlap
+	if got := SearchAllCase("aAaA", "aa", false); len(got) != 2 || got[1].Start != 2 {
+		t.Fatalf("expected two matches, got %v", got)
+	}
+}
+
+func TestStream(t *testing.T) {
+	line := "the quick brown fox jumps over the lazy dog\n"
+	text := strings.Repeat(line, 3*ChunkSize/len(line))
+	want, _ := Find(text, "the", Options{SmartCase: true})
+	lo, hi := len(text)/2, len(text)/2+10*len(line)
+	var preview, all []Range
+	done := Batch{}
+	err := Stream(context.Background(), text, "the", Options{SmartCase: true}, lo, hi, func(b Batch) {
+		switch {
+		case b.Preview:
+			if all != nil {
+				t.Fatalf("preview after results")
+			}
+			preview = b.Ranges
+		case b.Done:
+			done = b
+		default:
+			all = append(all, b.Ranges...)
+		}
+	})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if len(preview) != 20 || preview[0].Start < lo || preview[len(preview)-1].Start >= hi {
+		t.Fatalf("expected the window's 20 matches first, got %d", len(preview))
+	}
+	if !done.Done || done.Total != len(want) || !reflect.DeepEqual(all, want) {
+		t.Fatalf("expected %d matches, got %d (total %d)", len(want), len(all), done.Total)
+	}
+
+	// a cancelled search stops without a Done batch
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Stream(ctx, text, "fox", Options{}, 0, 0, func(b Batch) {
+		if b.Done {
+			t.Fatalf("unexpected Done batch")
+		}
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestStream_Regex(t *testing.T) {
+	line := "key=value other=thing\n"
+	text := strings.Repeat(line, 3*ChunkSize/len(line))
+	collect := func(query string, lo, hi int) (preview, all []Range, done Batch) {
+		err := Stream(context.Background(), text, query, Options{Regex: true}, lo, hi, func(b Batch) {
+			switch {
+			case b.Preview:
+				preview = b.Ranges
+			case b.Done:
+				all = append(all, b.Ranges...)
+				done = b
+			default:
+				all = append(all, b.Ranges...)
+			}
+		})
+		if err != nil {
+			t.Fatalf("stream %q: %v", query, err)
+		}
+		return preview, all, done
+	}
+	// searched a few lines at a time, with the window first
+	for _, query := range []string{`^(\w+)=`, `\bt\w+$`, `=t`} {
+		want, _ := Find(text, query, Options{Regex: true})
+		preview, all, done := collect(query, len(text)/2+3, len(text)/2+2*len(line))
+		if len(preview) == 0 || preview[0].Start < len(text)/2-len(line) {
+			t.Fatalf("%q: expected a preview of the window, got %v", query, preview)
+		}
+		if done.Total != len(want) || !reflect.DeepEqual(all, want) {
+			t.Fatalf("%q: expected %d matches, got %d (total %d)", query, len(want), len(all), done.Total)
+		}
+	}
+	// a pattern that can span lines is matched in one piece
+	want, _ := Find(text, `thing\nkey`, Options{Regex: true})
+	if preview, all, done := collect(`thing\nkey`, 0, len(line)); preview != nil || done.Total != len(want) || !reflect.DeepEqual(all, want) {
+		t.Fatalf("expected %d matches across lines, got %d", len(want), len(all))
+	}
+	if _, _, done := collect(`(`, 0, 0); done.Err == nil {
+		t.Fatalf("expected the error of an invalid pattern")
+	}
+
+	// either way a cancelled search stops without a Done batch
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, query := range []string{`o\w+`, `o\s+`} {
+		err := Stream(ctx, text, query, Options{Regex: true}, 0, 0, func(b Batch) {
+			if b.Done {
+				t.Fatalf("%q: unexpected Done batch", query)
+			}
+		})
+		if err != context.Canceled {
+			t.Fatalf("%q: expected context.Canceled, got %v", query, err)
+		}
+	}
+
+	// while a pattern that can span lines is being matched, another waits
+	// its turn and does not start once cancelled
+	spanningScan <- struct{}{}
+	ctx, cancel = context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		result <- Stream(ctx, text, `o\s+`, Options{Regex: true}, 0, 0, func(Batch) {
+			t.Errorf("unexpected batch from a search waiting its turn")
+		})
+	}()
+	select {
+	case err := <-result:
+		t.Fatalf("expected the search to wait, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	cancel()
+	if err := <-result; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	<-spanningScan
+	if _, _, done := collect(`o\s+`, 0, 0); !done.Done {
+		t.Fatalf("expected the search to run once the other is done")
+	}
+}
+
+func TestLineLocal(t *testing.T) {
+	for query, want := range map[string]bool{
+		`^foo$`:     true,
+		`\bfo+\S`:   true,
+		`[a-z]+`:    true,
+		`a.b`:       true,
+		`a\nb`:      false,
+		`a\sb`:      false,
+		`[^"]*`:     false,
+		`(?s)a.b`:   false,
+		`\Afoo`:     false,
+		`(?-m)foo$`: false,
+	} {
+		re, err := Compile(query, Options{})
+		if err != nil {
+			t.Fatalf("compile %q: %v", query, err)
+		}
+		if got := lineLocal(re); got != want {
+			t.Errorf("lineLocal(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestStream_LinearTime(t *testing.T) {
+	if testing.Short() {
+		t.Skip("times a large search")
+	}
+	// each chunk only scans its own bytes, so streaming a text without a
+	// match costs about as much as one search of the whole
+	text := strings.Repeat("lorem ipsum dolor sit amet\n", 16<<20/27)
+	for _, query := range []string{"absent", "Absent"} {
+		opt := Options{CaseSensitive: query == "Absent"}
+		start := time.Now()
+		Find(text, query, opt)
+		once := time.Since(start)
+		start = time.Now()
+		Stream(context.Background(), text, query, opt, 0, 0, func(Batch) {})
+		streamed := time.Since(start)
+		if streamed > 8*once+100*time.Millisecond {
+			t.Fatalf("streaming %q took %v against %v in one go", query, streamed, once)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package search
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Options select how Find matches a query.
+type Options struct {
+	// Regex treats the query as a Go regular expression. ^ and $ match at
+	// line boundaries and a pattern may span lines, e.g. "end\n\\s*begin".
+	Regex bool
+	// CaseSensitive matches letter case exactly.
+	CaseSensitive bool
+	// SmartCase ignores case unless the query has an upper-case letter. It
+	// only applies when CaseSensitive is false.
+	SmartCase bool
+	// WholeWord only keeps matches that neither start nor end inside a word.
+	WholeWord bool
+}
+
+// FoldCase reports whether query is matched without regard to case.
+func (o Options) FoldCase(query string) bool {
+	if o.CaseSensitive {
+		return false
+	}
+	return !o.SmartCase || !HasUpper(query, o.Regex)
+}
+
+// HasUpper reports whether query contains an upper-case letter. For a
+// regular expression the letter after a backslash is skipped, so escapes
+// such as \S or \W do not count.
+func HasUpper(query string, regex bool) bool {
+	escaped := false
+	for _, r := range query {
+		if regex && !escaped && r == '\\' {
+			escaped = true
+			continue
+		}
+		if !escaped && unicode.IsUpper(r) {
+			return true
+		}
+		escaped = false
+	}
+	return false
+}
+
+// Compile returns the regular expression Find uses for a regex query.
+func Compile(query string, opt Options) (*regexp.Regexp, error) {
+	flags := "(?m)"
+	if opt.FoldCase(query) {
+		flags = "(?mi)"
+	}
+	re, err := regexp.Compile(flags + query)
+	if err != nil {
+		// report the pattern as typed, without the flags
+		if serr, ok := err.(*syntax.Error); ok {
+			serr.Expr = strings.TrimPrefix(serr.Expr, flags)
+		}
+		return nil, err
+	}
+	return re, nil
+}
+
+// Find returns all non-overlapping matches of query in text as byte ranges.
+// The error is only set for an invalid regular expression. Empty matches,
+// which a pattern like "x*" produces everywhere, are left out.
+func Find(text, query string, opt Options) ([]Range, error) {
+	if query == "" {
+		return nil, nil
+	}
+	var res []Range
+	if opt.Regex {
+		re, err := Compile(query, opt)
+		if err != nil {
+			return nil, err
+		}
+		res = findRegex(re, text, 0, nil)
+	} else {
+		res = SearchAllCase(text, query, !opt.FoldCase(query))
+	}
+	if opt.WholeWord {
+		res = wholeWords(text, res)
+	}
+	return res, nil
+}
+
+// findRegex appends the non-empty matches of re in text to out, with their
+// capture groups, offset by base.
+func findRegex(re *regexp.Regexp, text string, base int, out []Range) []Range {
+	for _, loc := range re.FindAllStringSubmatchIndex(text, -1) {
+		if loc[0] == loc[1] {
+			continue
+		}
+		m := Range{Start: base + loc[0], End: base + loc[1]}
+		if len(loc) > 2 {
+			m.Submatches = loc[2:]
+			for i, off := range m.Submatches {
+				if off >= 0 {
+					m.Submatches[i] = base + off
+				}
+			}
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// Captures returns the text of the capture groups of match, a regex match
+// Find reported in text; the whole match is not included.
+func Captures(text string, match Range) []string {
+	if len(match.Submatches) == 0 {
+		return nil
+	}
+	groups := make([]string, 0, len(match.Submatches)/2)
+	for i := 0; i+1 < len(match.Submatches); i += 2 {
+		start, end := match.Submatches[i], match.Submatches[i+1]
+		if start < 0 || end > len(text) {
+			groups = append(groups, "")
+			continue
+		}
+		groups = append(groups, text[start:end])
+	}
+	return groups
+}
+
+func wholeWords(text string, ranges []Range) []Range {
+	out := ranges[:0]
+	for _, rg := range ranges {
+		before, _ := utf8.DecodeLastRuneInString(text[:rg.Start])
+		after, _ := utf8.DecodeRuneInString(text[rg.End:])
+		first, _ := utf8.DecodeRuneInString(text[rg.Start:])
+		last, _ := utf8.DecodeLastRuneInString(text[:rg.End])
+		if isWordRune(first) && isWordRune(before) || isWordRune(last) && isWordRune(after) {
+			continue
+		}
+		out = append(out, rg)
+	}
+	return out
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
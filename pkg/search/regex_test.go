@@ -0,0 +1,90 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFind_Regex(t *testing.T) {
+	text := "foo1 Foo22\nbar foo333"
+	got, err := Find(text, `foo\d+`, Options{Regex: true, CaseSensitive: true})
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if len(got) != 2 || text[got[0].Start:got[0].End] != "foo1" || text[got[1].Start:got[1].End] != "foo333" {
+		t.Fatalf("unexpected matches %v", got)
+	}
+	// ^ and $ match at line boundaries
+	got, _ = Find(text, `^\w+`, Options{Regex: true})
+	if len(got) != 2 || text[got[1].Start:got[1].End] != "bar" {
+		t.Fatalf("expected a match at each line start, got %v", got)
+	}
+	// a match may span lines
+	got, _ = Find(text, `22\nbar`, Options{Regex: true})
+	if len(got) != 1 || text[got[0].Start:got[0].End] != "22\nbar" {
+		t.Fatalf("expected a multi-line match, got %v", got)
+	}
+	// empty matches are dropped
+	if got, _ := Find(text, `x*`, Options{Regex: true}); len(got) != 0 {
+		t.Fatalf("expected no empty matches, got %v", got)
+	}
+	_, err = Find(text, `foo(`, Options{Regex: true})
+	if err == nil || !strings.Contains(err.Error(), "`foo(`") {
+		t.Fatalf("expected the error to quote the pattern as typed, got %v", err)
+	}
+}
+
+func TestFind_SmartCase(t *testing.T) {
+	text := "Foo foo FOO"
+	if got, _ := Find(text, "foo", Options{SmartCase: true}); len(got) != 3 {
+		t.Fatalf("lower-case query should ignore case, got %v", got)
+	}
+	if got, _ := Find(text, "Foo", Options{SmartCase: true}); len(got) != 1 || got[0].Start != 0 {
+		t.Fatalf("upper-case query should match case, got %v", got)
+	}
+	// \S is an escape, not an upper-case letter
+	if got, _ := Find(text, `f\S+`, Options{Regex: true, SmartCase: true}); len(got) != 3 {
+		t.Fatalf("escapes should not turn on case sensitivity, got %v", got)
+	}
+	if got, _ := Find(text, "foo", Options{CaseSensitive: true, SmartCase: true}); len(got) != 1 || got[0].Start != 4 {
+		t.Fatalf("case-sensitive should win over smart case, got %v", got)
+	}
+}
+
+func TestFind_WholeWord(t *testing.T) {
+	text := "cat concat cat_x cats cat, é"
+	got, _ := Find(text, "cat", Options{CaseSensitive: true, WholeWord: true})
+	if len(got) != 2 || got[0].Start != 0 || got[1].Start != 22 {
+		t.Fatalf("unexpected whole-word matches %v", got)
+	}
+	got, _ = Find(text, `\w+at`, Options{Regex: true, WholeWord: true})
+	if len(got) != 3 || got[1].Start != 4 {
+		t.Fatalf("expected regex matches at word boundaries, got %v", got)
+	}
+}
+
+func TestCaptures(t *testing.T) {
+	text := "a key=value b"
+	got, _ := Find(text, `(\w+)=(\w+)`, Options{Regex: true})
+	if len(got) != 1 {
+		t.Fatalf("expected one match, got %v", got)
+	}
+	groups := Captures(text, got[0])
+	if len(groups) != 2 || groups[0] != "key" || groups[1] != "value" {
+		t.Fatalf("unexpected captures %q", groups)
+	}
+	// the groups are those of the match as found, in the context of the
+	// text before it
+	text = "xab"
+	got, _ = Find(text, `\B(\w)b`, Options{Regex: true})
+	if len(got) != 1 || got[0].Start != 1 {
+		t.Fatalf("unexpected matches %v", got)
+	}
+	if groups := Captures(text, got[0]); len(groups) != 1 || groups[0] != "a" {
+		t.Fatalf("unexpected captures %q", groups)
+	}
+	got, _ = Find("a1 b", `(\d)|(b)`, Options{Regex: true})
+	if groups := Captures("a1 b", got[1]); len(groups) != 2 || groups[0] != "" || groups[1] != "b" {
+		t.Fatalf("unexpected captures %q", groups)
+	}
+}
@@ -10,6 +10,10 @@ type Range struct {
 	// Group is an optional category for styling (e.g. "keyword", "string").
 	// Empty means generic highlight (used for search/selection background).
 	Group string
+	// Submatches holds the byte offsets of the capture groups of a regex
+	// match, in pairs as regexp.FindStringSubmatchIndex reports them
+	// without the whole match; -1 marks a group that took no part.
+	Submatches []int
 }
 
 // SearchAll returns all non-overlapping occurrences of query in text as byte ranges.
@@ -21,15 +25,23 @@ func SearchAll(text, query string) []Range {
 // SearchAllCase returns all non-overlapping occurrences of query in text as byte ranges.
 // When caseSensitive is false, the search is performed case-insensitively.
 func SearchAllCase(text, query string, caseSensitive bool) []Range {
+	if query == "" {
+		return nil
+	}
+	return newMatcher(query, !caseSensitive).findAll(text, 0, len(text), nil)
+}
+
+// searchRunes is SearchAllCase comparing runes, folded with unicode.ToLower
+// unless caseSensitive. It handles the patterns the byte matchers cannot.
+func searchRunes(text, query string, caseSensitive bool) []Range {
 	if query == "" {
 		return nil
 	}
 	queryRunes := []rune(query)
-	var textRunes []rune
-	if caseSensitive {
-		textRunes = []rune(text)
-	} else {
-		textRunes = foldRunes([]rune(text))
+	origRunes := []rune(text)
+	textRunes := origRunes
+	if !caseSensitive {
+		textRunes = foldRunes(origRunes)
 		queryRunes = foldRunes(queryRunes)
 	}
 	queryLen := len(queryRunes)
@@ -39,7 +51,8 @@ func SearchAllCase(text, query string, caseSensitive bool) []Range {
 
 	prefixBytes := make([]int, len(textRunes)+1)
 	byteOffset := 0
-	for i, r := range textRunes {
+	// offsets are those of text, as folding can change a rune's length
+	for i, r := range origRunes {
 		prefixBytes[i] = byteOffset
 		byteOffset += len(string(r))
 	}
@@ -0,0 +1,48 @@
+// Package state locates and writes the files the editor keeps between
+// sessions below ~/.texteditor: undo histories, swap files, registers,
+// marks, the kill ring and prompt history.
+package state
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Path returns ~/.texteditor/name, or "" if the home directory is unknown.
+func Path(name string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".texteditor", name)
+}
+
+// WriteFile replaces the file at path with data, readable by the user only,
+// creating its directory as needed. The data is written to a temporary file
+// beside path and renamed over it, so readers never see a partial file and
+// editors writing the same file at once do not interfere.
+func WriteFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
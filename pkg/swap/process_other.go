@@ -0,0 +1,7 @@
+//go:build !unix
+
+package swap
+
+// processRunning cannot probe other processes on this platform, so every
+// swap file is treated as left behind by a crashed editor.
+func processRunning(pid int) bool { return false }
@@ -0,0 +1,187 @@
+// Package swap keeps crash-recovery journals for buffers with unsaved
+// changes. A swap file starts with a header and the buffer text at the time
+// journaling began, followed by one record per edit, so flushing a few
+// keystrokes appends a few short lines instead of rewriting the file.
+package swap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"example.com/texteditor/pkg/buffer"
+	"example.com/texteditor/pkg/state"
+)
+
+// Header identifies the file and editor process a swap file belongs to.
+type Header struct {
+	Path     string    `json:"path"`
+	PID      int       `json:"pid"`
+	Encoding string    `json:"encoding,omitempty"`
+	Created  time.Time `json:"created"`
+}
+
+// record is one journal line. The first record after the header carries the
+// base text; later ones replay edits.
+type record struct {
+	Base *string `json:"base,omitempty"`
+	Pos  int     `json:"pos,omitempty"`
+	Del  int     `json:"del,omitempty"`
+	Ins  string  `json:"ins,omitempty"`
+}
+
+// DefaultDir returns ~/.texteditor/swap, or "" if the home directory is
+// unknown.
+func DefaultDir() string {
+	return state.Path("swap")
+}
+
+// PathFor returns the swap file used for file inside dir. The absolute path
+// is encoded into the name so files with the same base name do not collide.
+func PathFor(dir, file string) string {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		abs = file
+	}
+	name := strings.NewReplacer(string(filepath.Separator), "%", ":", "%").Replace(abs)
+	return filepath.Join(dir, name+".swp")
+}
+
+// Writer appends edits to one swap file.
+type Writer struct {
+	path string
+	f    *os.File
+}
+
+// Create starts a new swap file at path holding hdr and base, replacing any
+// existing one.
+func Create(path string, hdr Header, base string) (*Writer, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(hdr); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(record{Base: &base}); err != nil {
+		return nil, err
+	}
+	// written whole so a crash while writing the base never leaves a swap
+	// file without one
+	if err := state.WriteFile(path, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{path: path, f: f}, nil
+}
+
+// Path returns the swap file location.
+func (w *Writer) Path() string { return w.path }
+
+// Append journals changes and syncs them to disk.
+func (w *Writer) Append(changes []buffer.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	bw := bufio.NewWriter(w.f)
+	enc := json.NewEncoder(bw)
+	for _, c := range changes {
+		if err := enc.Encode(record{Pos: c.Pos, Del: c.Deleted, Ins: c.Text}); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return w.f.Sync()
+}
+
+// Close closes the file and keeps it on disk.
+func (w *Writer) Close() error { return w.f.Close() }
+
+// Remove closes and deletes the swap file.
+func (w *Writer) Remove() error {
+	_ = w.f.Close()
+	if err := os.Remove(w.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Recovered is the buffer state rebuilt from a swap file.
+type Recovered struct {
+	Header Header
+	Text   string
+	// ModTime is when the swap file was last written.
+	ModTime time.Time
+}
+
+// ErrNoBase reports a swap file that ends before its base text.
+var ErrNoBase = errors.New("swap file has no base text")
+
+// Read replays the swap file at path. A truncated final record, as left by
+// a crash during a write, is ignored.
+func Read(path string) (*Recovered, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bufio.NewReader(f))
+	var rec Recovered
+	rec.ModTime = info.ModTime()
+	if err := dec.Decode(&rec.Header); err != nil {
+		return nil, fmt.Errorf("swap header: %w", err)
+	}
+	var base record
+	if err := dec.Decode(&base); err != nil || base.Base == nil {
+		return nil, ErrNoBase
+	}
+	text := []rune(*base.Base)
+	for {
+		var r record
+		if err := dec.Decode(&r); err != nil {
+			break
+		}
+		if r.Pos < 0 || r.Pos > len(text) || r.Pos+r.Del > len(text) {
+			return nil, fmt.Errorf("swap record out of range at %d", r.Pos)
+		}
+		if r.Del > 0 {
+			text = append(text[:r.Pos], text[r.Pos+r.Del:]...)
+		}
+		if r.Ins != "" {
+			ins := []rune(r.Ins)
+			text = append(text[:r.Pos], append(ins, text[r.Pos:]...)...)
+		}
+	}
+	rec.Text = string(text)
+	return &rec, nil
+}
+
+// Save writes text as a complete swap file in one step. It is used for the
+// emergency flush after a panic, when the journal may be behind.
+func Save(path string, hdr Header, text string) error {
+	w, err := Create(path, hdr, text)
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// InUse reports whether the editor process that wrote the swap file is
+// still running, meaning the file is most likely open in another editor
+// rather than left behind by a crash.
+func (h Header) InUse() bool {
+	return h.PID != os.Getpid() && processRunning(h.PID)
+}
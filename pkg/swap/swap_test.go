@@ -0,0 +1,52 @@
+package swap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"example.com/texteditor/pkg/buffer"
+)
+
+func TestJournal_ReplaysEdits(t *testing.T) {
+	dir := t.TempDir()
+	path := PathFor(dir, "/tmp/notes.txt")
+	w, err := Create(path, Header{Path: "/tmp/notes.txt", PID: 1}, "hello\nworld\n")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	buf := buffer.NewGapBufferFromString("hello\nworld\n")
+	var changes []buffer.Change
+	buf.SetChangeListener(func(c buffer.Change) { changes = append(changes, c) })
+	_ = buf.Insert(5, []rune(", wörld"))
+	_ = buf.Delete(0, 1)
+	_ = buf.Insert(0, []rune("H"))
+	if err := w.Append(changes); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	_ = w.Close()
+	// a crash in the middle of a write leaves a partial record behind
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	_, _ = f.WriteString(`{"pos":3,"ins":"tru`)
+	_ = f.Close()
+
+	rec, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if rec.Text != buf.String() || rec.Text != "Hello, wörld\nworld\n" {
+		t.Fatalf("unexpected recovered text %q", rec.Text)
+	}
+	if rec.Header.Path != "/tmp/notes.txt" || rec.Header.PID != 1 {
+		t.Fatalf("unexpected header %+v", rec.Header)
+	}
+}
+
+func TestPathFor_DistinctDirectories(t *testing.T) {
+	dir := t.TempDir()
+	a := PathFor(dir, filepath.Join("/src", "a", "main.go"))
+	b := PathFor(dir, filepath.Join("/src", "b", "main.go"))
+	if a == b || filepath.Dir(a) != dir {
+		t.Fatalf("unexpected swap paths %q %q", a, b)
+	}
+}